@@ -6,12 +6,16 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/cilium/ebpf/rlimit"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -20,6 +24,7 @@ import (
 	"github.com/kubescape/kapprofiler/pkg/controller"
 	"github.com/kubescape/kapprofiler/pkg/eventsink"
 	"github.com/kubescape/kapprofiler/pkg/tracing"
+	"github.com/kubescape/kapprofiler/pkg/webhook"
 )
 
 // Global variables
@@ -93,16 +98,40 @@ func main() {
 	if err := eventSink.Start(); err != nil {
 		log.Fatalf("Failed to start event sink: %v\n", err)
 	}
-	defer eventSink.Stop()
 
 	// Create the tracer
 	tracer := tracing.NewTracer(NodeName, k8sConfig, []tracing.EventSink{eventSink}, false)
+	if os.Getenv("CAPTURE_EXEC_ENV") == "true" {
+		execEnvConfig := &tracing.ExecEnvConfig{Capture: true, Redact: tracing.DefaultExecEnvRedact}
+		if os.Getenv("EXEC_ENV_ALLOW") != "" {
+			execEnvConfig.Allow = strings.Split(os.Getenv("EXEC_ENV_ALLOW"), ",")
+		}
+		if os.Getenv("EXEC_ENV_DENY") != "" {
+			execEnvConfig.Deny = strings.Split(os.Getenv("EXEC_ENV_DENY"), ",")
+		}
+		if os.Getenv("EXEC_ENV_REDACT") != "" {
+			execEnvConfig.Redact = strings.Split(os.Getenv("EXEC_ENV_REDACT"), ",")
+		}
+		tracer.SetExecEnvConfig(execEnvConfig)
+	}
 
 	// Start the collector manager
 	ignoreMounts := false
 	if os.Getenv("OPEN_IGNORE_MOUNTS") == "true" {
 		ignoreMounts = true
 	}
+	openExecutables := os.Getenv("OPEN_EXECUTABLES") == "true"
+	generalizeOpenPaths := os.Getenv("OPEN_GENERALIZE_PATHS") == "true"
+	generalizeExecArgs := os.Getenv("EXEC_GENERALIZE_ARGS") == "true"
+	openPathPatterns := []string{}
+	if os.Getenv("OPEN_PATH_PATTERNS") != "" {
+		openPathPatterns = strings.Split(os.Getenv("OPEN_PATH_PATTERNS"), ",")
+		for _, pattern := range openPathPatterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				log.Fatalf("Invalid OPEN_PATH_PATTERNS pattern %q: %v\n", pattern, err)
+			}
+		}
+	}
 	ignorePrefixes := []string{}
 	if os.Getenv("OPEN_IGNORE_PREFIXES") != "" {
 		ignorePrefixes = strings.Split(os.Getenv("OPEN_IGNORE_PREFIXES"), ",")
@@ -111,35 +140,94 @@ func main() {
 	if os.Getenv("STORE_NAMESPACE") != "" {
 		storeNamespace = os.Getenv("STORE_NAMESPACE")
 	}
+	quiescentIntervals := uint64(0)
+	if os.Getenv("QUIESCENT_INTERVALS") != "" {
+		value, err := strconv.ParseUint(os.Getenv("QUIESCENT_INTERVALS"), 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid QUIESCENT_INTERVALS: %v\n", err)
+		}
+		quiescentIntervals = value
+	}
+	maxLearningDuration := uint64(0)
+	if os.Getenv("MAX_LEARNING_DURATION") != "" {
+		value, err := time.ParseDuration(os.Getenv("MAX_LEARNING_DURATION"))
+		if err != nil {
+			log.Fatalf("Invalid MAX_LEARNING_DURATION: %v\n", err)
+		}
+		maxLearningDuration = uint64(value.Seconds())
+	}
+	var namespaceSelector labels.Selector
+	if os.Getenv("RECORD_NAMESPACE_SELECTOR") != "" {
+		namespaceSelector, err = labels.Parse(os.Getenv("RECORD_NAMESPACE_SELECTOR"))
+		if err != nil {
+			log.Fatalf("Invalid RECORD_NAMESPACE_SELECTOR: %v\n", err)
+		}
+	}
+	var podSelector labels.Selector
+	if os.Getenv("RECORD_POD_SELECTOR") != "" {
+		podSelector, err = labels.Parse(os.Getenv("RECORD_POD_SELECTOR"))
+		if err != nil {
+			log.Fatalf("Invalid RECORD_POD_SELECTOR: %v\n", err)
+		}
+	}
+	var eventTypes []tracing.EventType
+	if os.Getenv("EVENT_TYPES") != "" {
+		eventTypes, err = collector.ParseEventTypes(strings.Split(os.Getenv("EVENT_TYPES"), ","))
+		if err != nil {
+			log.Fatalf("Invalid EVENT_TYPES: %v\n", err)
+		}
+	}
+	defaultPolicyNamespace := os.Getenv("POD_NAMESPACE")
 	collectorManagerConfig := &collector.CollectorManagerConfig{
-		EventSink:      eventSink,
-		Tracer:         tracer,
-		Interval:       60, // 60 seconds for now, TODO: make it configurable
-		FinalizeTime:   80, // 0 seconds to disable finalization
-		FinalizeJitter: 10, // 0 seconds to disable finalization jitter
-		K8sConfig:      k8sConfig,
-		RecordStrategy: collector.RecordStrategyOnlyIfNotExists,
-		NodeName:       NodeName,
-		IgnoreMounts:   ignoreMounts,
-		IgnorePrefixes: ignorePrefixes,
-		StoreNamespace: storeNamespace,
+		EventSink:              eventSink,
+		Tracer:                 tracer,
+		Interval:               60, // 60 seconds for now, TODO: make it configurable
+		FinalizeTime:           80, // 0 seconds to disable finalization
+		FinalizeJitter:         10, // 0 seconds to disable finalization jitter
+		K8sConfig:              k8sConfig,
+		RecordStrategy:         collector.RecordStrategyOnlyIfNotExists,
+		NodeName:               NodeName,
+		IgnoreMounts:           ignoreMounts,
+		IgnorePrefixes:         ignorePrefixes,
+		StoreNamespace:         storeNamespace,
+		QuiescentIntervals:     quiescentIntervals,
+		MaxLearningDuration:    maxLearningDuration,
+		NamespaceSelector:      namespaceSelector,
+		PodSelector:            podSelector,
+		DefaultPolicyNamespace: defaultPolicyNamespace,
+		EventTypes:             eventTypes,
+		OpenExecutables:        openExecutables,
+		GeneralizeOpenPaths:    generalizeOpenPaths,
+		OpenPathPatterns:       openPathPatterns,
+		GeneralizeExecArgs:     generalizeExecArgs,
 	}
 	cm, err := collector.StartCollectorManager(collectorManagerConfig)
 	if err != nil {
 		log.Fatalf("Failed to start collector manager: %v\n", err)
 	}
-	defer cm.StopCollectorManager()
 
 	// Start the service
 	if err := tracer.Start(); err != nil {
 		log.Fatalf("Failed to start service: %v\n", err)
 	}
-	defer tracer.Stop()
 
 	// Start AppProfile controller
-	appProfileController := controller.NewController(k8sConfig, storeNamespace)
+	appProfileController := controller.NewController(k8sConfig, storeNamespace, NodeName)
 	appProfileController.StartController()
-	defer appProfileController.StopController()
+
+	// Start the ApplicationProfile conversion webhook
+	var conversionWebhook *webhook.ConversionWebhook
+	if certDir := os.Getenv("CONVERSION_WEBHOOK_CERT_DIR"); certDir != "" {
+		webhookAddress := ":8443"
+		if os.Getenv("CONVERSION_WEBHOOK_ADDRESS") != "" {
+			webhookAddress = os.Getenv("CONVERSION_WEBHOOK_ADDRESS")
+		}
+		conversionWebhook = webhook.NewConversionWebhook(webhookAddress, certDir)
+		if err := conversionWebhook.Start(); err != nil {
+			log.Printf("Failed to start conversion webhook: %v\n", err)
+			conversionWebhook = nil
+		}
+	}
 
 	// Wait for shutdown signal
 	shutdown := make(chan os.Signal, 1)
@@ -147,6 +235,45 @@ func main() {
 	<-shutdown
 	log.Println("Shutting down...")
 
-	// Exit with success
-	os.Exit(0)
+	// The shutdown must finish before the pod is killed (terminationGracePeriodSeconds)
+	shutdownTimeout := 25 * time.Second
+	if os.Getenv("SHUTDOWN_TIMEOUT") != "" {
+		timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+		if err != nil {
+			log.Printf("Invalid SHUTDOWN_TIMEOUT %q, using %s: %v\n", os.Getenv("SHUTDOWN_TIMEOUT"), shutdownTimeout, err)
+		} else {
+			shutdownTimeout = timeout
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		// Stop accepting new containers
+		cm.StopCollectorManager()
+
+		// Write everything that was collected since the last interval
+		if err := cm.FlushAllContainers(ctx); err != nil {
+			log.Printf("Failed to flush all containers: %v\n", err)
+		}
+
+		// Detach the tracers only after the last events were read
+		tracer.Stop()
+		appProfileController.StopController()
+		if conversionWebhook != nil {
+			conversionWebhook.Stop()
+		}
+		eventSink.Stop()
+	}()
+
+	select {
+	case <-done:
+		log.Println("Shutdown complete")
+	case <-ctx.Done():
+		log.Printf("Shutdown did not complete within %s\n", shutdownTimeout)
+		os.Exit(1)
+	}
 }
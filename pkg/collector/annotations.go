@@ -0,0 +1,170 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// Operator annotations, honoured on pods and on the workloads that own them.
+const (
+	// Finalize the profile right away
+	FinalizeNowAnnotation = "kapprofiler.kubescape.io/finalize-now"
+	// Clear the final label of the profile and record the containers again
+	RelearnAnnotation = "kapprofiler.kubescape.io/relearn"
+	// Learning duration of the pod (for example "30m"), overrides the configured finalization time
+	LearningDurationAnnotation = "kapprofiler.kubescape.io/learning-duration"
+)
+
+var podGvr = schema.GroupVersionResource{
+	Group:    "",
+	Version:  "v1",
+	Resource: "pods",
+}
+
+// getLearningDuration returns the learning duration override of the pod, if it has a valid one.
+func getLearningDuration(pod metav1.Object) (time.Duration, bool) {
+	raw, ok := pod.GetAnnotations()[LearningDurationAnnotation]
+	if !ok {
+		return 0, false
+	}
+	learningDuration, err := time.ParseDuration(raw)
+	if err != nil || learningDuration <= 0 {
+		log.Printf("invalid %s annotation %q on pod %s/%s\n", LearningDurationAnnotation, raw, pod.GetNamespace(), pod.GetName())
+		return 0, false
+	}
+	return learningDuration, true
+}
+
+// RemoveAnnotationsPatch returns a merge patch that removes the given annotations from an object.
+func RemoveAnnotationsPatch(keys ...string) []byte {
+	annotations := map[string]interface{}{}
+	for _, key := range keys {
+		annotations[key] = nil
+	}
+	patch, _ := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}})
+	return patch
+}
+
+// SetApplicationProfileFinal puts the final label on an application profile with the reason of the finalization.
+func SetApplicationProfileFinal(client dynamic.Interface, namespace string, name string, reason string) error {
+	patch := fmt.Sprintf("{\"metadata\":{\"labels\":{\"kapprofiler.kubescape.io/final\":\"true\"},\"annotations\":{\"%s\":\"%s\"}}}", FinalizationReasonAnnotation, reason)
+	_, err := client.Resource(AppProfileGvr).Namespace(namespace).Patch(context.Background(),
+		name, apitypes.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
+// UnfinalizeApplicationProfile clears the final label of an application profile so it can be recorded again.
+func UnfinalizeApplicationProfile(client dynamic.Interface, namespace string, name string) error {
+	patch := fmt.Sprintf("{\"metadata\":{\"labels\":{\"kapprofiler.kubescape.io/final\":null},\"annotations\":{\"%s\":null}}}", FinalizationReasonAnnotation)
+	_, err := client.Resource(AppProfileGvr).Namespace(namespace).Patch(context.Background(),
+		name, apitypes.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
+// handlePodAnnotations applies the operator annotations of a pod. The one-shot annotations are removed once handled.
+func (cm *CollectorManager) handlePodAnnotations(pod *v1.Pod) {
+	// Keep the learning duration override for the collection intervals
+	learningDuration, _ := getLearningDuration(pod)
+	cm.podFinalizerStateMutex.Lock()
+	if podState, ok := cm.podFinalizerState[generateTableKey(pod)]; ok {
+		podState.LearningDuration = learningDuration
+	}
+	cm.podFinalizerStateMutex.Unlock()
+
+	handled := []string{}
+	if _, ok := pod.GetAnnotations()[RelearnAnnotation]; ok {
+		log.Printf("Relearning application profile of pod %s/%s\n", pod.GetNamespace(), pod.GetName())
+		cm.relearnPod(pod)
+		handled = append(handled, RelearnAnnotation)
+	}
+	if _, ok := pod.GetAnnotations()[FinalizeNowAnnotation]; ok {
+		log.Printf("Finalizing application profile of pod %s/%s on request\n", pod.GetNamespace(), pod.GetName())
+		cm.finalizeApplicationProfile(pod.GetName(), pod.GetNamespace(), FinalizationReasonManual)
+		handled = append(handled, FinalizeNowAnnotation)
+	}
+	if len(handled) == 0 {
+		return
+	}
+
+	_, err := cm.dynamicClient.Resource(podGvr).Namespace(pod.GetNamespace()).Patch(context.Background(),
+		pod.GetName(), apitypes.MergePatchType, RemoveAnnotationsPatch(handled...), metav1.PatchOptions{})
+	if err != nil {
+		log.Printf("error removing annotations from pod %s/%s: %s\n", pod.GetNamespace(), pod.GetName(), err)
+	}
+}
+
+// relearnPod clears the final label of the pod profile and of the profile of its owner workload, and starts
+// recording the running containers of the pod again. The containers are not recorded while the owner profile is
+// final with the default strategy.
+func (cm *CollectorManager) relearnPod(pod *v1.Pod) {
+	namespace := pod.GetNamespace()
+	if cm.config.StoreNamespace != "" {
+		namespace = cm.config.StoreNamespace
+	}
+	podProfileName := cm.GetApplicationProfileName(pod.GetNamespace(), "pod", pod.GetName())
+	err := UnfinalizeApplicationProfile(cm.dynamicClient, namespace, podProfileName)
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("error patching application profile: %s\n", err)
+		return
+	}
+	ownerProfileName, err := cm.getWorkloadApplicationProfileName(pod.GetNamespace(), pod.GetName(), true)
+	if err != nil {
+		log.Printf("error getting application profile name of pod %s/%s: %s\n", pod.GetNamespace(), pod.GetName(), err)
+	} else if ownerProfileName != podProfileName {
+		err := UnfinalizeApplicationProfile(cm.dynamicClient, namespace, ownerProfileName)
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("error unfinalizing application profile %s: %s\n", ownerProfileName, err)
+		}
+	}
+
+	// Start the learning period over
+	cm.stopTimer(&pod.ObjectMeta)
+	cm.containersMutex.Lock()
+	delete(cm.podLearningStates, generateTableKey(pod))
+	containers := []ContainerId{}
+	for containerId := range cm.runningContainers {
+		if containerId.PodName != pod.GetName() || containerId.Namespace != pod.GetNamespace() {
+			continue
+		}
+		if _, ok := cm.containers[containerId]; !ok {
+			containers = append(containers, containerId)
+		}
+	}
+	cm.containersMutex.Unlock()
+
+	// The containers are already running, so they are attached to like after a restart of the agent
+	for i := range containers {
+		cm.ContainerStarted(&containers[i], true)
+	}
+}
+
+// getPodAnnotatedLearningDuration returns the learning duration the annotations of the pod set, 0 if they set none.
+// The annotations are read when the pod is added or updated.
+func (cm *CollectorManager) getPodAnnotatedLearningDuration(pod metav1.Object) time.Duration {
+	cm.podFinalizerStateMutex.Lock()
+	defer cm.podFinalizerStateMutex.Unlock()
+	if podState, ok := cm.podFinalizerState[generateTableKey(pod)]; ok {
+		return podState.LearningDuration
+	}
+	return 0
+}
+
+// getPodLearningDuration returns the maximum learning duration of a pod. Without quiescence based finalization
+// the annotation of the pod sets the finalization timer instead.
+func (cm *CollectorManager) getPodLearningDuration(podName string, namespace string) time.Duration {
+	learningDuration := cm.getPodAnnotatedLearningDuration(&metav1.ObjectMeta{Name: podName, Namespace: namespace})
+	if learningDuration > 0 && cm.quiescenceEnabled() {
+		return learningDuration
+	}
+	return time.Duration(cm.config.MaxLearningDuration) * time.Second
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHandlePodAnnotationsFinalizeNow(t *testing.T) {
+	client := newTestDynamicClient()
+	cm := newTestCollectorManager(client)
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "nginx",
+		Namespace:   "default",
+		Annotations: map[string]string{FinalizeNowAnnotation: "true", LearningDurationAnnotation: "30m"},
+	}}
+	podRaw := &unstructured.Unstructured{}
+	podRaw.SetAPIVersion("v1")
+	podRaw.SetKind("Pod")
+	podRaw.SetName(pod.Name)
+	podRaw.SetNamespace(pod.Namespace)
+	podRaw.SetAnnotations(pod.Annotations)
+	if _, err := client.Resource(podGvr).Namespace("default").Create(context.Background(), podRaw, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("error creating pod: %s\n", err)
+	}
+	if _, err := cm.storePodProfile(context.Background(), "default", "pod-nginx", []containerRecording{
+		{id: ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}, state: &ContainerState{}, profile: ContainerProfile{Name: "app"}},
+	}); err != nil {
+		t.Fatalf("error storing pod profile: %s\n", err)
+	}
+	cm.podFinalizerState[generateTableKey(pod)] = &PodProfileFinalizerState{PodName: "nginx", Namespace: "default"}
+
+	cm.handlePodAnnotations(pod)
+
+	profile, err := GetApplicationProfile(context.Background(), client, "default", "pod-nginx")
+	if err != nil {
+		t.Fatalf("error getting application profile: %s\n", err)
+	}
+	if profile.Labels["kapprofiler.kubescape.io/final"] != "true" || profile.Annotations[FinalizationReasonAnnotation] != FinalizationReasonManual {
+		t.Errorf("expected the profile to be finalized manually, got labels %v annotations %v\n", profile.Labels, profile.Annotations)
+	}
+
+	patchedPod, err := client.Resource(podGvr).Namespace("default").Get(context.Background(), "nginx", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting pod: %s\n", err)
+	}
+	if _, ok := patchedPod.GetAnnotations()[FinalizeNowAnnotation]; ok {
+		t.Errorf("expected the %s annotation to be removed from the pod\n", FinalizeNowAnnotation)
+	}
+	if patchedPod.GetAnnotations()[LearningDurationAnnotation] != "30m" {
+		t.Errorf("expected the %s annotation to be kept on the pod\n", LearningDurationAnnotation)
+	}
+
+	// The learning duration caps the learning only with quiescence based finalization
+	if duration := cm.getPodLearningDuration("nginx", "default"); duration != 0 {
+		t.Errorf("expected no maximum learning duration, got %s\n", duration)
+	}
+	cm.config.QuiescentIntervals = 5
+	if duration := cm.getPodLearningDuration("nginx", "default"); duration != 30*time.Minute {
+		t.Errorf("expected a maximum learning duration of 30m, got %s\n", duration)
+	}
+
+	// Relearning clears the final label
+	if err := UnfinalizeApplicationProfile(client, "default", "pod-nginx"); err != nil {
+		t.Fatalf("error unfinalizing application profile: %s\n", err)
+	}
+	profile, err = GetApplicationProfile(context.Background(), client, "default", "pod-nginx")
+	if err != nil {
+		t.Fatalf("error getting application profile: %s\n", err)
+	}
+	if _, ok := profile.Labels["kapprofiler.kubescape.io/final"]; ok {
+		t.Errorf("expected the final label to be removed, got %v\n", profile.Labels)
+	}
+}
+
+func TestRelearnPodUnfinalizesOwnerProfile(t *testing.T) {
+	client := newTestDynamicClient()
+	cm := newTestCollectorManager(client)
+	isController := true
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Name:            "nginx-7f9c",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "nginx", Controller: &isController}},
+	}}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            "nginx-7f9c-x2kq",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: replicaSet.Name, Controller: &isController}},
+	}}
+	cm.k8sClient = fake.NewSimpleClientset(replicaSet, pod)
+
+	profileNames := []string{}
+	for _, workload := range []struct{ kind, name string }{{"pod", pod.Name}, {"deployment", "nginx"}} {
+		profile := &ApplicationProfile{
+			TypeMeta:   metav1.TypeMeta{Kind: ApplicationProfileKind, APIVersion: ApplicationProfileApiVersion},
+			ObjectMeta: metav1.ObjectMeta{Name: cm.GetApplicationProfileName("default", workload.kind, workload.name), Labels: map[string]string{"kapprofiler.kubescape.io/final": "true"}},
+		}
+		SetApplicationProfileWorkload(profile, workload.kind, workload.name, "default", "")
+		if err := CreateApplicationProfile(context.Background(), client, "default", profile); err != nil {
+			t.Fatalf("error creating application profile: %s\n", err)
+		}
+		profileNames = append(profileNames, profile.Name)
+	}
+
+	cm.relearnPod(pod)
+
+	for _, profileName := range profileNames {
+		profile, err := GetApplicationProfile(context.Background(), client, "default", profileName)
+		if err != nil {
+			t.Fatalf("error getting application profile: %s\n", err)
+		}
+		if _, ok := profile.Labels["kapprofiler.kubescape.io/final"]; ok {
+			t.Errorf("expected the final label of %s to be removed, got %v\n", profileName, profile.Labels)
+		}
+	}
+}
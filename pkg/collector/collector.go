@@ -2,8 +2,10 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -13,35 +15,59 @@ import (
 	"github.com/kubescape/kapprofiler/pkg/watcher"
 
 	"golang.org/x/exp/slices"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/labels"
 	apitypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
 )
 
 const (
-	RecordStrategyAlways          = "always"
-	RecordStrategyOnlyIfNotExists = "only-if-not-exists"
-	MaxOpenEvents                 = 10000 // Per container profile.
-	MaxNetworkEvents              = 10000 // Per container profile.
+	RecordStrategyAlways               = "always"
+	RecordStrategyOnlyIfNotExists      = "only-if-not-exists"
+	RecordStrategyRelearnOnImageChange = "relearn-on-image-change" // Record again when a container runs another image than the one of the final profile.
+	RecordStrategyShadow               = "shadow"                  // Keep recording final profiles and store the new behaviour in a delta profile.
+	MaxOpenEvents                      = 10000                     // Per container profile.
+	MaxNetworkEvents                   = 10000                     // Per container profile.
+	MaxFileOperations                  = 10000                     // Per container profile.
+	MaxPrivilegedOperations            = 1000                      // Per container profile.
+	MaxSignals                         = 1000                      // Per container profile.
+	MaxOpenExecutables                 = 16                        // Per open entry.
+	MaxOpenDirectoryChildren           = 50                        // Per directory, when generalizing open paths.
+	MaxExecArgValues                   = 5                         // Per argument position, when generalizing exec arguments.
+	MaxExecVariants                    = 50                        // Per executable, when generalizing exec arguments.
+	MaxProfileNameCacheSize            = 10000                     // Workloads whose profile name is cached.
 )
 
+// Returned when the application profile is final and the container should not be recorded anymore
+var errApplicationProfileFinal = errors.New("application profile is final")
+
 type ContainerId struct {
 	Namespace string
 	PodName   string
+	PodUID    string
 	Container string
 	// Low level identifiers
 	ContainerID string
 	NsMntId     uint64
 	Pid         uint32
+	// Digest of the image of the container
+	ImageDigest string
 }
 
 type ContainerState struct {
 	running  bool
 	attached bool
+	// Event types traced in the container
+	eventTypes []tracing.EventType
+	// Name of the final profile the container is shadowing, empty if the container is learned
+	baseline string
+	// Executables of the processes of the container, to find the parents of the execs
+	processes *processTree
 }
 
 type CollectorManager struct {
@@ -51,9 +77,18 @@ type CollectorManager struct {
 	// Map mutex
 	containersMutex *sync.Mutex
 
+	// Running containers of the node, also the ones that are not recorded (guarded by containersMutex)
+	runningContainers map[ContainerId]struct{}
+
+	// Map of pod key to the timer of its flush loop (guarded by containersMutex)
+	podFlushTimers map[string]*time.Timer
+
+	// Map of pod key to the learning state used for quiescence based finalization (guarded by containersMutex)
+	podLearningStates map[string]*podLearningState
+
 	// Kubernetes connection clien
-	k8sClient     *kubernetes.Clientset
-	dynamicClient *dynamic.DynamicClient
+	k8sClient     kubernetes.Interface
+	dynamicClient dynamic.Interface
 
 	// Event sink
 	eventSink *eventsink.EventSink
@@ -64,8 +99,17 @@ type CollectorManager struct {
 	// config
 	config CollectorManagerConfig
 
-	// Pod finalizer watcher
+	// Pod finalizer watcher and the pods of the node it keeps
 	podFinalizerWatcher watcher.WatcherInterface
+	pods                *objectCache[*corev1.Pod]
+
+	// Namespace watcher and the namespaces it keeps, to check the recording opt-outs
+	namespaceWatcher watcher.WatcherInterface
+	namespaces       *objectCache[*corev1.Namespace]
+
+	// ProfilingPolicy watcher and the policies it keeps
+	policyWatcher watcher.WatcherInterface
+	policies      *policyCache
 
 	// Pod finalizer state table
 	podFinalizerState map[string]*PodProfileFinalizerState
@@ -78,6 +122,9 @@ type CollectorManager struct {
 
 	// Mutex for pod mount cache
 	podMountCacheMutex *sync.Mutex
+
+	// Names of the application profiles of the workloads, so that the name is looked up once per workload
+	profileNames *ApplicationProfileNameCache
 }
 
 type CollectorManagerConfig struct {
@@ -103,15 +150,40 @@ type CollectorManagerConfig struct {
 	IgnorePrefixes []string
 	// Should store profiles in the same namespace
 	StoreNamespace string
+	// Consecutive collection intervals without new behaviour after which a profile is finalized (0 to finalize FinalizeTime after the pod is ready)
+	QuiescentIntervals uint64
+	// Maximum time in seconds a pod is learned before its profile is finalized (0 to disable)
+	MaxLearningDuration uint64
+	// Only record the pods of the namespaces matching this selector (nil to record all namespaces)
+	NamespaceSelector labels.Selector
+	// Only record the pods matching this selector (nil to record all pods)
+	PodSelector labels.Selector
+	// Namespace of the cluster-wide default ProfilingPolicy
+	DefaultPolicyNamespace string
+	// Event types to trace in the containers (nil to trace the default ones)
+	EventTypes []tracing.EventType
+	// Record the executables that opened each file
+	OpenExecutables bool
+	// Replace the dynamic parts of the opened paths with wildcards
+	GeneralizeOpenPaths bool
+	// Patterns the opened paths are recorded as, see path.Match
+	OpenPathPatterns []string
+	// Learn templates of the exec arguments
+	GeneralizeExecArgs bool
 }
 
 type TotalEvents struct {
-	ExecEvents         []*tracing.ExecveEvent
-	OpenEvents         []*tracing.OpenEvent
-	SyscallEvents      []string
-	CapabilitiesEvents []*tracing.CapabilitiesEvent
-	DnsEvents          []*tracing.DnsEvent
-	NetworkEvents      []*tracing.NetworkEvent
+	ExecEvents                []*tracing.ExecveEvent
+	OpenEvents                []*tracing.OpenEvent
+	SyscallEvents             []string
+	CapabilitiesEvents        []*tracing.CapabilitiesEvent
+	DnsEvents                 []*tracing.DnsEvent
+	NetworkEvents             []*tracing.NetworkEvent
+	FileOperationEvents       []*tracing.FileOperationEvent
+	BindEvents                []*tracing.BindEvent
+	TcpConnectEvents          []*tracing.TcpConnectEvent
+	PrivilegedOperationEvents []*tracing.PrivilegedOperationEvent
+	SignalEvents              []*tracing.SignalEvent
 }
 
 func StartCollectorManager(config *CollectorManagerConfig) (*CollectorManager, error) {
@@ -133,6 +205,9 @@ func StartCollectorManager(config *CollectorManagerConfig) (*CollectorManager, e
 	cm := &CollectorManager{
 		containers:         make(map[ContainerId]*ContainerState),
 		containersMutex:    &sync.Mutex{},
+		runningContainers:  make(map[ContainerId]struct{}),
+		podFlushTimers:     make(map[string]*time.Timer),
+		podLearningStates:  make(map[string]*podLearningState),
 		k8sClient:          client,
 		dynamicClient:      dynamicClient,
 		config:             *config,
@@ -140,6 +215,10 @@ func StartCollectorManager(config *CollectorManagerConfig) (*CollectorManager, e
 		tracer:             config.Tracer,
 		podMountCache:      make(map[string][]string),
 		podMountCacheMutex: &sync.Mutex{},
+
+		profileNames: NewApplicationProfileNameCache(dynamicClient, config.StoreNamespace),
+		pods:         newObjectCache[*corev1.Pod](),
+		namespaces:   newObjectCache[*corev1.Namespace](),
 	}
 
 	// Setup container events listener
@@ -148,6 +227,12 @@ func StartCollectorManager(config *CollectorManagerConfig) (*CollectorManager, e
 	// Start finalizer watcher
 	cm.StartFinalizerWatcher()
 
+	// Start Namespace watcher
+	cm.StartNamespaceWatcher()
+
+	// Start ProfilingPolicy watcher
+	cm.StartPolicyWatcher()
+
 	return cm, nil
 }
 
@@ -158,57 +243,105 @@ func (cm *CollectorManager) StopCollectorManager() error {
 	// Stop finalizer watcher
 	cm.StopFinalizerWatcher()
 
+	// Stop Namespace watcher
+	cm.StopNamespaceWatcher()
+
+	// Stop ProfilingPolicy watcher
+	cm.StopPolicyWatcher()
+
 	return nil
 }
 
 func (cm *CollectorManager) ContainerStarted(id *ContainerId, attach bool) {
+	// Keep track of the running containers to be able to record them again when the pod is relearned
+	cm.containersMutex.Lock()
+	cm.runningContainers[*id] = struct{}{}
+	cm.containersMutex.Unlock()
+
+	// Check the opt-outs and selectors before spending any tracing resources on the container
+	pod, record := cm.shouldRecordContainer(id)
+	if !record {
+		return
+	}
+
 	// Check if applicaton profile already exists
+	baseline := ""
 	appProfileExists, err := cm.doesApplicationProfileExists(id.Namespace, id.PodName, true, true)
 	if err != nil {
 		// log.Printf("error checking if application profile exists: %s\n", err)
 	} else if appProfileExists {
 		// If application profile exists, check if record strategy is RecordStrategyOnlyIfNotExists
-		if cm.config.RecordStrategy == RecordStrategyOnlyIfNotExists {
+		switch cm.getRecordingSettings(id.Namespace).RecordStrategy {
+		case RecordStrategyOnlyIfNotExists:
 			// Do not start recording events for this container
 			return
+		case RecordStrategyRelearnOnImageChange:
+			// Do not start recording events for this container unless its image changed
+			if !cm.relearnOnImageChange(id) {
+				return
+			}
+		case RecordStrategyShadow:
+			// Record the container to find the behaviour that is not in the final profile
+			baseline, err = cm.getWorkloadApplicationProfileName(id.Namespace, id.PodName, true)
+			if err != nil {
+				log.Printf("error getting application profile name of pod %s/%s: %s\n", id.Namespace, id.PodName, err)
+				return
+			}
 		}
 	}
 
+	// A container that a previous instance of the agent recorded from its start is not partially recorded
+	recordedFromStart := attach && cm.wasRecordedFromStart(id)
+	if recordedFromStart {
+		log.Printf("Resuming recording of container %s in pod %s/%s\n", id.Container, id.Namespace, id.PodName)
+	}
+
 	// Add container to map with running state set to true
 	cm.containersMutex.Lock()
+	eventTypes := cm.getEventTypes(id.Namespace, pod)
 	cm.containers[*id] = &ContainerState{
-		running:  true,
-		attached: attach,
+		running:    true,
+		attached:   attach && !recordedFromStart,
+		eventTypes: eventTypes,
+		baseline:   baseline,
+		processes:  newProcessTree(),
 	}
 
-	// Start event sink filter for container
-	cm.eventSink.AddFilter(&eventsink.EventSinkFilter{
-		ContainerID: id.ContainerID,
-		EventType:   tracing.AllEventType,
-	})
+	// Start event sink filters for container
+	for _, eventType := range eventTypes {
+		cm.eventSink.AddFilter(&eventsink.EventSinkFilter{
+			ContainerID: id.ContainerID,
+			EventType:   eventType,
+		})
+	}
 	cm.containersMutex.Unlock()
 
 	// Fetch mounts for pod
 	cm.podMountCacheMutex.Lock()
 	if _, ok := cm.podMountCache[fmt.Sprintf("%s-%s", id.PodName, id.Namespace)]; !ok {
-		mounts, err := cm.getPodMounts(id.PodName, id.Namespace)
-		if err != nil {
-			log.Printf("error getting pod mounts: %s\n", err)
-		}
-		cm.podMountCache[fmt.Sprintf("%s-%s", id.PodName, id.Namespace)] = mounts
+		cm.podMountCache[fmt.Sprintf("%s-%s", id.PodName, id.Namespace)] = getPodMounts(pod)
 	}
 	cm.podMountCacheMutex.Unlock()
 
-	// Get all events for this container
-	err = cm.tracer.StartTraceContainer(id.NsMntId, id.Pid, tracing.AllEventType)
-	if err != nil {
-		log.Printf("error starting tracing container: %s - %v\n", err, id)
+	// Get the selected events for this container
+	for _, eventType := range eventTypes {
+		err = cm.tracer.StartTraceContainer(id.NsMntId, id.Pid, eventType)
+		if err != nil {
+			log.Printf("error starting tracing of %s events in container: %s - %v\n", eventType, err, id)
+		}
 	}
 
-	// Add a timer for collection of data from container events
-	startContainerTimer(id, cm.config.Interval, cm.CollectContainerEvents)
+	// Start the periodic collection of data from the containers of the pod
+	cm.startPodFlushLoop(id.PodName, id.Namespace)
 
-	if cm.config.FinalizeTime > 0 && cm.config.FinalizeTime > cm.config.Interval {
+	// Shadowed containers are recorded until they stop
+	if baseline != "" {
+		return
+	}
+	cm.containersMutex.Lock()
+	cm.startLearningState(fmt.Sprintf("%s-%s", id.PodName, id.Namespace), time.Now())
+	cm.containersMutex.Unlock()
+	if finalizeTime := cm.getRecordingSettings(id.Namespace).FinalizeTime; cm.quiescenceEnabled() || (finalizeTime > 0 && finalizeTime > cm.config.Interval) {
 		cm.MarkPodRecording(id.PodName, id.Namespace, attach)
 	}
 }
@@ -216,19 +349,17 @@ func (cm *CollectorManager) ContainerStarted(id *ContainerId, attach bool) {
 func (cm *CollectorManager) ContainerStopped(id *ContainerId) {
 	// Check if container is still running (is it in the map?)
 	cm.containersMutex.Lock()
-	defer cm.containersMutex.Unlock()
-	if _, ok := cm.containers[*id]; ok {
+	delete(cm.runningContainers, *id)
+	containerState, ok := cm.containers[*id]
+	if ok {
 		// Turn running state to false
-		cm.containers[*id].running = false
+		containerState.running = false
 
 		// Mark stop recording
 		cm.MarkPodNotRecording(id.PodName, id.Namespace)
 
 		// Stop tracing container
-		cm.tracer.StopTraceContainer(id.NsMntId, id.Pid, tracing.AllEventType)
-
-		// Remove this container from the filters of the event sink so that it does not collect events for it anymore
-		cm.eventSink.RemoveFilter(&eventsink.EventSinkFilter{EventType: tracing.AllEventType, ContainerID: id.ContainerID})
+		cm.stopTracingContainer(id, containerState)
 
 		// Remove container from map
 		delete(cm.containers, *id)
@@ -248,9 +379,12 @@ func (cm *CollectorManager) ContainerStopped(id *ContainerId) {
 			cm.podMountCacheMutex.Unlock()
 		}
 	}
+	cm.containersMutex.Unlock()
 
-	// Collect data from container events
-	go cm.CollectContainerEvents(id)
+	// Collect the remaining data from the container events
+	if ok {
+		go cm.flushContainers(context.Background(), id.PodName, id.Namespace, map[ContainerId]*ContainerState{*id: containerState})
+	}
 }
 
 func (cm *CollectorManager) loadTotalEvents(containerId *ContainerId) (*TotalEvents, error) {
@@ -302,130 +436,463 @@ func (cm *CollectorManager) loadTotalEvents(containerId *ContainerId) (*TotalEve
 		log.Printf("error getting network events: %s\n", err)
 	}
 
+	fileOperationEvents, err := cm.eventSink.GetFileOperationEvents(containerId.Namespace, containerId.PodName, containerId.Container)
+	if err == nil {
+		allEvents.FileOperationEvents = fileOperationEvents
+	} else {
+		log.Printf("error getting file operation events: %s\n", err)
+	}
+
+	bindEvents, err := cm.eventSink.GetBindEvents(containerId.Namespace, containerId.PodName, containerId.Container)
+	if err == nil {
+		allEvents.BindEvents = bindEvents
+	} else {
+		log.Printf("error getting bind events: %s\n", err)
+	}
+
+	tcpConnectEvents, err := cm.eventSink.GetTcpConnectEvents(containerId.Namespace, containerId.PodName, containerId.Container)
+	if err == nil {
+		allEvents.TcpConnectEvents = tcpConnectEvents
+	} else {
+		log.Printf("error getting tcp connect events: %s\n", err)
+	}
+
+	privilegedOperationEvents, err := cm.eventSink.GetPrivilegedOperationEvents(containerId.Namespace, containerId.PodName, containerId.Container)
+	if err == nil {
+		allEvents.PrivilegedOperationEvents = privilegedOperationEvents
+	} else {
+		log.Printf("error getting privileged operation events: %s\n", err)
+	}
+
+	signalEvents, err := cm.eventSink.GetSignalEvents(containerId.Namespace, containerId.PodName, containerId.Container)
+	if err == nil {
+		allEvents.SignalEvents = signalEvents
+	} else {
+		log.Printf("error getting signal events: %s\n", err)
+	}
+
 	return &allEvents, nil
 }
 
 func shouldProcessEvents(totalEvents *TotalEvents) bool {
-	return len(totalEvents.ExecEvents) > 0 || len(totalEvents.OpenEvents) > 0 || len(totalEvents.SyscallEvents) > 0 || len(totalEvents.CapabilitiesEvents) > 0 || len(totalEvents.DnsEvents) > 0 || len(totalEvents.NetworkEvents) > 0
+	return len(totalEvents.ExecEvents) > 0 || len(totalEvents.OpenEvents) > 0 || len(totalEvents.SyscallEvents) > 0 || len(totalEvents.CapabilitiesEvents) > 0 || len(totalEvents.DnsEvents) > 0 || len(totalEvents.NetworkEvents) > 0 || len(totalEvents.FileOperationEvents) > 0 || len(totalEvents.BindEvents) > 0 || len(totalEvents.TcpConnectEvents) > 0 || len(totalEvents.PrivilegedOperationEvents) > 0 || len(totalEvents.SignalEvents) > 0
 }
 
-func (cm *CollectorManager) CollectContainerEvents(id *ContainerId) {
-	// Check if container is still running (is it in the map?)
-	cm.containersMutex.Lock()
-	if containerState, ok := cm.containers[*id]; ok {
-		cm.containersMutex.Unlock()
-		// Collect data from container events
-		totalEvents, err := cm.loadTotalEvents(id)
-		if err != nil {
-			log.Printf("error loading total events: %s\n", err)
-			return
+// buildContainerProfile builds the container profile out of the events collected since the last interval
+func (cm *CollectorManager) buildContainerProfile(id *ContainerId, state *ContainerState, totalEvents *TotalEvents) ContainerProfile {
+	containerProfile := ContainerProfile{Name: id.Container, ImageDigest: id.ImageDigest}
+
+	// Add syscalls to container profile
+	containerProfile.SysCalls = append(containerProfile.SysCalls, totalEvents.SyscallEvents...)
+
+	// Add execve events to container profile
+	settings := cm.getRecordingSettings(id.Namespace)
+	parents := state.processes.addExecs(totalEvents.ExecEvents)
+	for _, event := range totalEvents.ExecEvents {
+		uid, gid := event.Uid, event.Gid
+		exec := ExecCalls{
+			Path:       event.PathName,
+			Args:       event.Args,
+			Envs:       event.Env,
+			ParentPath: parents[event],
+			Uid:        &uid,
+			Gid:        &gid,
+			Cwd:        event.Cwd,
+		}
+		// Check if execve event is already in container profile or if it has no path name (Some execve events do not have a path name).
+		if !slices.ContainsFunc(containerProfile.Execs, exec.Equals) || event.PathName == "" {
+			containerProfile.Execs = append(containerProfile.Execs, exec)
 		}
+	}
+	if settings.GeneralizeExecArgs {
+		containerProfile.Execs = generalizeExecs(containerProfile.Execs)
+	}
 
-		// If there are no events, return
-		if !shouldProcessEvents(totalEvents) {
-			return
+	// Add dns events to container profile
+	for _, event := range totalEvents.DnsEvents {
+		if !dnsEventExists(event, containerProfile.Dns) {
+			containerProfile.Dns = append(containerProfile.Dns, DnsCalls{
+				DnsName:   event.DnsName,
+				Addresses: event.Addresses,
+			})
 		}
+	}
 
-		containerProfile := ContainerProfile{Name: id.Container}
+	// Add capabilities events to container profile
+	for _, event := range totalEvents.CapabilitiesEvents {
+		var syscallExists bool
+		for i, capability := range containerProfile.Capabilities {
+			if capability.Syscall == event.Syscall {
+				syscallExists = true
+				if !slices.Contains(capability.Capabilities, event.CapabilityName) {
+					containerProfile.Capabilities[i].Capabilities = append(capability.Capabilities, event.CapabilityName)
+				}
+				break
+			}
+		}
 
-		// Add syscalls to container profile
-		containerProfile.SysCalls = append(containerProfile.SysCalls, totalEvents.SyscallEvents...)
+		if !syscallExists {
+			containerProfile.Capabilities = append(containerProfile.Capabilities, CapabilitiesCalls{
+				Capabilities: []string{event.CapabilityName},
+				Syscall:      event.Syscall,
+			})
+		}
+	}
 
-		// Add execve events to container profile
-		for _, event := range totalEvents.ExecEvents {
-			// Check if execve event is already in container profile or if it has no path name (Some execve events do not have a path name).
-			if !execEventExists(event, containerProfile.Execs) || event.PathName == "" {
-				containerProfile.Execs = append(containerProfile.Execs, ExecCalls{
-					Path: event.PathName,
-					Args: event.Args,
-					Envs: event.Env,
-				})
+	// Add open events to container profile
+	cm.podMountCacheMutex.Lock()
+	mounts := cm.podMountCache[fmt.Sprintf("%s-%s", id.PodName, id.Namespace)]
+	cm.podMountCacheMutex.Unlock()
+	for _, event := range totalEvents.OpenEvents {
+		var executables []OpenExecutable
+		if settings.OpenExecutables {
+			executables = []OpenExecutable{{Comm: event.Comm, Path: event.ExePath}}
+		}
+		openPath := normalizeOpenPath(event.PathName, &settings)
+		if cm.shouldIncludeOpenEvent(&tracing.OpenEvent{PathName: openPath, Flags: event.Flags}, containerProfile.Opens, mounts, &settings) {
+			openEvent := OpenCalls{
+				Path:        openPath,
+				Flags:       event.Flags,
+				Executables: executables,
 			}
+			containerProfile.Opens = append(containerProfile.Opens, openEvent)
+		} else if len(executables) > 0 {
+			addOpenExecutables(containerProfile.Opens, openPath, event.Flags, executables)
 		}
+	}
+	if settings.GeneralizeOpenPaths || len(settings.OpenPathPatterns) > 0 {
+		containerProfile.Opens = generalizeOpens(containerProfile.Opens, &settings)
+	}
 
-		// Add dns events to container profile
-		for _, event := range totalEvents.DnsEvents {
-			if !dnsEventExists(event, containerProfile.Dns) {
-				containerProfile.Dns = append(containerProfile.Dns, DnsCalls{
-					DnsName:   event.DnsName,
-					Addresses: event.Addresses,
+	// Add network activity to container profile
+	var outgoingConnections []NetworkCalls
+	var incomingConnections []NetworkCalls
+	for _, networkEvent := range totalEvents.NetworkEvents {
+		if networkEvent.PacketType == "OUTGOING" {
+			if !networkEventExists(networkEvent, outgoingConnections) {
+				outgoingConnections = append(outgoingConnections, NetworkCalls{
+					Protocol:    networkEvent.Protocol,
+					Port:        networkEvent.Port,
+					DstEndpoint: networkEvent.DstEndpoint,
+				})
+			}
+		} else if networkEvent.PacketType == "HOST" {
+			if !networkEventExists(networkEvent, incomingConnections) {
+				incomingConnections = append(incomingConnections, NetworkCalls{
+					Protocol:    networkEvent.Protocol,
+					Port:        networkEvent.Port,
+					DstEndpoint: networkEvent.DstEndpoint,
 				})
 			}
 		}
+	}
 
-		// Add capabilities events to container profile
-		for _, event := range totalEvents.CapabilitiesEvents {
-			var syscallExists bool
-			for i, capability := range containerProfile.Capabilities {
-				if capability.Syscall == event.Syscall {
-					syscallExists = true
-					if !slices.Contains(capability.Capabilities, event.CapabilityName) {
-						containerProfile.Capabilities[i].Capabilities = append(capability.Capabilities, event.CapabilityName)
-					}
-					break
-				}
-			}
+	containerProfile.NetworkActivity = NetworkActivity{
+		Incoming: incomingConnections,
+		Outgoing: outgoingConnections,
+	}
 
-			if !syscallExists {
-				containerProfile.Capabilities = append(containerProfile.Capabilities, CapabilitiesCalls{
-					Capabilities: []string{event.CapabilityName},
-					Syscall:      event.Syscall,
-				})
-			}
+	// Add file operations to container profile, their paths are normalized like the paths of the opens
+	for _, event := range totalEvents.FileOperationEvents {
+		fileOperation := FileOperationCalls{Operation: event.Operation, Comm: event.Comm}
+		if event.Path != "" {
+			fileOperation.Path = normalizeOpenPath(event.Path, &settings)
 		}
+		if len(containerProfile.FileOperations) < MaxFileOperations && !slices.ContainsFunc(containerProfile.FileOperations, fileOperation.Equals) {
+			containerProfile.FileOperations = append(containerProfile.FileOperations, fileOperation)
+		}
+	}
 
-		// Add open events to container profile
-		cm.podMountCacheMutex.Lock()
-		mounts := cm.podMountCache[fmt.Sprintf("%s-%s", id.PodName, id.Namespace)]
-		cm.podMountCacheMutex.Unlock()
-		for _, event := range totalEvents.OpenEvents {
-			if cm.shouldIncludeOpenEvent(event, containerProfile.Opens, mounts) {
-				openEvent := OpenCalls{
-					Path:  event.PathName,
-					Flags: event.Flags,
-				}
-				containerProfile.Opens = append(containerProfile.Opens, openEvent)
-			}
+	// Add listening ports to container profile, the sockets bound to port 0 get an ephemeral port to connect from
+	for _, event := range totalEvents.BindEvents {
+		if event.Port == 0 {
+			continue
+		}
+		listeningPort := ListeningPortCalls{
+			Protocol: event.Protocol,
+			Address:  event.Address,
+			Port:     event.Port,
+			Comm:     event.Comm,
+			Exe:      event.ExePath,
 		}
+		if len(containerProfile.ListeningPorts) < MaxNetworkEvents && !slices.ContainsFunc(containerProfile.ListeningPorts, listeningPort.Equals) {
+			containerProfile.ListeningPorts = append(containerProfile.ListeningPorts, listeningPort)
+		}
+	}
 
-		// Add network activity to container profile
-		var outgoingConnections []NetworkCalls
-		var incomingConnections []NetworkCalls
-		for _, networkEvent := range totalEvents.NetworkEvents {
-			if networkEvent.PacketType == "OUTGOING" {
-				if !networkEventExists(networkEvent, outgoingConnections) {
-					outgoingConnections = append(outgoingConnections, NetworkCalls{
-						Protocol:    networkEvent.Protocol,
-						Port:        networkEvent.Port,
-						DstEndpoint: networkEvent.DstEndpoint,
-					})
-				}
-			} else if networkEvent.PacketType == "HOST" {
-				if !networkEventExists(networkEvent, incomingConnections) {
-					incomingConnections = append(incomingConnections, NetworkCalls{
-						Protocol:    networkEvent.Protocol,
-						Port:        networkEvent.Port,
-						DstEndpoint: networkEvent.DstEndpoint,
-					})
-				}
-			}
+	// Add tcp connections to container profile
+	for _, event := range totalEvents.TcpConnectEvents {
+		tcpConnection := TcpConnectionCalls{
+			DstEndpoint: event.DstAddress,
+			Port:        event.DstPort,
+			Comm:        event.Comm,
+			Exe:         event.ExePath,
+		}
+		if event.Success {
+			tcpConnection.Successes = 1
+		} else {
+			tcpConnection.Failures = 1
 		}
+		containerProfile.TcpConnections = AddTcpConnection(containerProfile.TcpConnections, tcpConnection)
+	}
 
-		containerProfile.NetworkActivity = NetworkActivity{
-			Incoming: incomingConnections,
-			Outgoing: outgoingConnections,
+	// Add privileged operations to container profile
+	for _, event := range totalEvents.PrivilegedOperationEvents {
+		privilegedOperation := PrivilegedOperationCalls{
+			Operation:  event.Operation,
+			Namespaces: event.Namespaces,
+			TargetIds:  event.TargetIds,
+			Source:     event.Source,
+			Target:     event.Target,
+			FsType:     event.FsType,
+			Comm:       event.Comm,
+			Exe:        event.ExePath,
+		}
+		if len(containerProfile.PrivilegedOperations) < MaxPrivilegedOperations && !slices.ContainsFunc(containerProfile.PrivilegedOperations, privilegedOperation.Equals) {
+			containerProfile.PrivilegedOperations = append(containerProfile.PrivilegedOperations, privilegedOperation)
 		}
+	}
 
-		// The name of the ApplicationProfile you're looking for.
-		namespace := id.Namespace
-		appProfileName := cm.GetApplicationProfileName(id.Namespace, "pod", id.PodName)
-		if cm.config.StoreNamespace != "" {
-			namespace = cm.config.StoreNamespace
+	// Add signals to container profile
+	for _, event := range totalEvents.SignalEvents {
+		signal := SignalCalls{
+			Signal:    event.Signal,
+			Comm:      event.Comm,
+			Exe:       event.ExePath,
+			TargetExe: event.TargetExePath,
+		}
+		if len(containerProfile.Signals) < MaxSignals && !slices.ContainsFunc(containerProfile.Signals, signal.Equals) {
+			containerProfile.Signals = append(containerProfile.Signals, signal)
 		}
+	}
 
-		// Get the ApplicationProfile object with the name specified above.
-		existingApplicationProfile, err := cm.dynamicClient.Resource(AppProfileGvr).Namespace(namespace).Get(context.Background(), appProfileName, v1.GetOptions{})
+	return containerProfile
+}
+
+// CollectPodEvents writes the events of all the recorded containers of a pod into the pod application profile with a single write.
+func (cm *CollectorManager) CollectPodEvents(podName string, namespace string) {
+	podKey := fmt.Sprintf("%s-%s", podName, namespace)
+
+	// Get the containers of the pod that are still recorded
+	cm.containersMutex.Lock()
+	containers := make(map[ContainerId]*ContainerState)
+	learning := false
+	for containerId, containerState := range cm.containers {
+		if containerId.PodName == podName && containerId.Namespace == namespace {
+			containers[containerId] = containerState
+			learning = learning || containerState.baseline == ""
+		}
+	}
+	if len(containers) == 0 {
+		// Nothing is recorded in this pod anymore, stop the flush loop
+		delete(cm.podFlushTimers, podKey)
+		delete(cm.podLearningStates, podKey)
+		cm.containersMutex.Unlock()
+		return
+	}
+	cm.containersMutex.Unlock()
+
+	newBehaviour := cm.flushContainers(context.Background(), podName, namespace, containers)
+	maxLearningDuration := cm.getPodLearningDuration(podName, namespace)
+
+	// Restart timer
+	finalizationReason := ""
+	cm.containersMutex.Lock()
+	if _, ok := cm.podFlushTimers[podKey]; ok {
+		// Shadowed containers are never finalized
+		if learning {
+			finalizationReason = cm.updateLearningState(podKey, newBehaviour, maxLearningDuration, time.Now())
+		}
+		cm.podFlushTimers[podKey] = startTimer(cm.config.Interval, func() { cm.CollectPodEvents(podName, namespace) })
+	}
+	cm.containersMutex.Unlock()
+
+	// The next collection stops recording the containers of the pod once the profile is final
+	if finalizationReason != "" {
+		log.Printf("Finalizing application profile of pod %s/%s (%s)\n", namespace, podName, finalizationReason)
+		cm.finalizeApplicationProfile(podName, namespace, finalizationReason)
+	}
+}
+
+// startPodFlushLoop starts the periodic collection of a pod unless it is already running
+func (cm *CollectorManager) startPodFlushLoop(podName string, namespace string) {
+	podKey := fmt.Sprintf("%s-%s", podName, namespace)
+	cm.containersMutex.Lock()
+	defer cm.containersMutex.Unlock()
+	if _, ok := cm.podFlushTimers[podKey]; !ok {
+		cm.podFlushTimers[podKey] = startTimer(cm.config.Interval, func() { cm.CollectPodEvents(podName, namespace) })
+	}
+}
+
+// FlushAllContainers stops the periodic collection and writes the events of every recorded container.
+// It gives up on the pods that were not written yet when the context is done.
+func (cm *CollectorManager) FlushAllContainers(ctx context.Context) error {
+	// Group the recorded containers by pod and stop the flush loops so they do not race with the final write
+	type podKey struct {
+		podName   string
+		namespace string
+	}
+	pods := make(map[podKey]map[ContainerId]*ContainerState)
+	cm.containersMutex.Lock()
+	for key, timer := range cm.podFlushTimers {
+		timer.Stop()
+		delete(cm.podFlushTimers, key)
+	}
+	for containerId, containerState := range cm.containers {
+		key := podKey{podName: containerId.PodName, namespace: containerId.Namespace}
+		if _, ok := pods[key]; !ok {
+			pods[key] = make(map[ContainerId]*ContainerState)
+		}
+		pods[key][containerId] = containerState
+	}
+	cm.containersMutex.Unlock()
+
+	for key, containers := range pods {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("flushing containers: %w", ctx.Err())
+		default:
+		}
+		cm.flushContainers(ctx, key.podName, key.namespace, containers)
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("flushing containers: %w", err)
+	}
+
+	return nil
+}
+
+type containerRecording struct {
+	id      ContainerId
+	state   *ContainerState
+	profile ContainerProfile
+}
+
+// flushContainers collects the events of the given containers of a pod and merges them into the pod application profile.
+// It returns whether the profile got new behaviour.
+func (cm *CollectorManager) flushContainers(ctx context.Context, podName string, namespace string, containers map[ContainerId]*ContainerState) bool {
+	var recordings []containerRecording
+	shadowRecordings := map[string][]containerRecording{}
+	for containerId, containerState := range containers {
+		containerId := containerId
+		// Collect data from container events
+		totalEvents, err := cm.loadTotalEvents(&containerId)
 		if err != nil {
+			log.Printf("error loading total events: %s\n", err)
+			continue
+		}
+
+		// If there are no events, skip the container
+		if !shouldProcessEvents(totalEvents) {
+			continue
+		}
+
+		profile := cm.buildContainerProfile(&containerId, containerState, totalEvents)
+		profile.EventTypes = getEventTypeNames(containerState.eventTypes)
+		recording := containerRecording{
+			id:      containerId,
+			state:   containerState,
+			profile: profile,
+		}
+		if containerState.baseline != "" {
+			shadowRecordings[containerState.baseline] = append(shadowRecordings[containerState.baseline], recording)
+			continue
+		}
+		recordings = append(recordings, recording)
+	}
+
+	// The name of the ApplicationProfile you're looking for.
+	storeNamespace := namespace
+	appProfileName := cm.GetApplicationProfileName(namespace, "pod", podName)
+	if cm.config.StoreNamespace != "" {
+		storeNamespace = cm.config.StoreNamespace
+	}
+
+	for baseline, shadowed := range shadowRecordings {
+		if err := cm.storeDeltaProfile(ctx, storeNamespace, baseline, shadowed); err != nil {
+			log.Printf("error storing delta of application profile %s: %s\n", baseline, err)
+		}
+	}
+	if len(recordings) == 0 {
+		return false
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].id.Container < recordings[j].id.Container })
+
+	// Store the container profiles, retrying on conflicts with other writers of the same application profile.
+	newBehaviour, err := cm.storePodProfile(ctx, storeNamespace, appProfileName, recordings)
+	if err == errApplicationProfileFinal {
+		for _, recording := range recordings {
+			cm.stopRecordingContainer(&recording.id)
+		}
+	} else if err != nil && ctx.Err() != nil {
+		// The profile is not failed, the flush was cancelled
+		log.Printf("error storing application profile %s: %s\n", appProfileName, err)
+	} else if err != nil {
+		log.Printf("error storing application profile: %s\n", err)
+
+		for _, recording := range recordings {
+			cm.stopRecordingContainer(&recording.id)
+		}
+
+		// Mark pod as failed recording
+		_, err = cm.dynamicClient.Resource(AppProfileGvr).Namespace(storeNamespace).Patch(ctx,
+			appProfileName, apitypes.MergePatchType, []byte("{\"metadata\":{\"labels\":{\"kapprofiler.kubescape.io/failed\":\"true\"}}}"), v1.PatchOptions{})
+		if err != nil {
+			log.Printf("error patching application profile: %s\n", err)
+		}
+	}
+
+	return newBehaviour
+}
+
+// stopRecordingContainer stops tracing a container and removes it from the recorded containers
+func (cm *CollectorManager) stopRecordingContainer(id *ContainerId) {
+	cm.containersMutex.Lock()
+	defer cm.containersMutex.Unlock()
+	containerState, ok := cm.containers[*id]
+	if !ok {
+		return
+	}
+
+	// Stop tracing container
+	cm.stopTracingContainer(id, containerState)
+	// Mark stop recording
+	cm.MarkPodNotRecording(id.PodName, id.Namespace)
+
+	// Remove the container from the map
+	delete(cm.containers, *id)
+}
+
+// stopTracingContainer stops the tracers of the container and removes it from the filters of the event sink so
+// that it does not collect events for it anymore
+func (cm *CollectorManager) stopTracingContainer(id *ContainerId, containerState *ContainerState) {
+	for _, eventType := range containerState.eventTypes {
+		cm.tracer.StopTraceContainer(id.NsMntId, id.Pid, eventType)
+	}
+	cm.eventSink.RemoveFilter(&eventsink.EventSinkFilter{EventType: tracing.AllEventType, ContainerID: id.ContainerID})
+}
+
+// storePodProfile creates the application profile or merges the container profiles into the existing one and
+// returns whether the profile got new behaviour. Conflicting writes are retried on a fresh copy of the profile.
+func (cm *CollectorManager) storePodProfile(ctx context.Context, namespace string, appProfileName string, recordings []containerRecording) (bool, error) {
+	attached := false
+	failed := false
+	for _, recording := range recordings {
+		attached = attached || recording.state.attached
+		// Check if we have over the limit of open events, if so, mark as failed.
+		failed = failed || len(recording.profile.Opens) >= MaxOpenEvents
+	}
+
+	newBehaviour := false
+	err := retry.OnError(retry.DefaultBackoff, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Get the ApplicationProfile object with the name specified above.
+		existingApplicationProfile, err := GetApplicationProfile(ctx, cm.dynamicClient, namespace, appProfileName)
+		if apierrors.IsNotFound(err) {
 			// it does not exist, create it
 			appProfile := &ApplicationProfile{
 				TypeMeta: v1.TypeMeta{
@@ -435,125 +902,75 @@ func (cm *CollectorManager) CollectContainerEvents(id *ContainerId) {
 				ObjectMeta: v1.ObjectMeta{
 					Name: appProfileName,
 				},
-				Spec: ApplicationProfileSpec{
-					Containers: []ContainerProfile{containerProfile},
-				},
+			}
+			for _, recording := range recordings {
+				appProfile.Spec.Containers = append(appProfile.Spec.Containers, recording.profile)
 			}
 			labels := map[string]string{}
-			if containerState.attached {
+			if attached {
 				labels["kapprofiler.kubescape.io/partial"] = "true"
 			}
-			// Check if we have over the limit of open events, if so, mark as failed.
-			if len(containerProfile.Opens) >= MaxOpenEvents {
+			if failed {
 				labels["kapprofiler.kubescape.io/failed"] = "true"
 			}
-			if cm.config.StoreNamespace != "" {
-				labels["kapprofiler.kubescape.io/namespace"] = id.Namespace
-			}
 			appProfile.ObjectMeta.SetLabels(labels)
-			appProfileRawNew, err := runtime.DefaultUnstructuredConverter.ToUnstructured(appProfile)
-			if err != nil {
-				log.Printf("error converting application profile: %s\n", err)
-			}
-			_, err = cm.dynamicClient.Resource(AppProfileGvr).Namespace(namespace).Create(
-				context.Background(),
-				&unstructured.Unstructured{
-					Object: appProfileRawNew,
-				},
-				v1.CreateOptions{})
-			if err != nil {
-				log.Printf("error creating application profile: %s\n", err)
+			SetApplicationProfileWorkload(appProfile, "pod", recordings[0].id.PodName, recordings[0].id.Namespace, recordings[0].id.PodUID)
+			if err := setRecordedFromStart(appProfile, recordings); err != nil {
+				return err
 			}
-		} else {
-			// if the application profile is final (immutable), we cannot patch it
-			if existingApplicationProfile.GetLabels()["kapprofiler.kubescape.io/final"] == "true" {
-				// Remove this container from the filters of the event sink so that it does not collect events for it anymore
-				cm.eventSink.RemoveFilter(&eventsink.EventSinkFilter{EventType: tracing.AllEventType, ContainerID: id.ContainerID})
-				// Stop tracing container
-				cm.tracer.StopTraceContainer(id.NsMntId, id.Pid, tracing.AllEventType)
-
-				// Mark stop recording
-				cm.MarkPodNotRecording(id.PodName, id.Namespace)
-
-				// Remove the container from the map
-				cm.containersMutex.Lock()
-				delete(cm.containers, *id)
-				cm.containersMutex.Unlock()
+			newBehaviour = true
+			return CreateApplicationProfile(ctx, cm.dynamicClient, namespace, appProfile)
+		} else if err != nil {
+			return err
+		}
 
-				return
-			}
+		// if the application profile is final (immutable), we cannot patch it
+		if existingApplicationProfile.GetLabels()["kapprofiler.kubescape.io/final"] == "true" {
+			return errApplicationProfileFinal
+		}
 
-			// Check if we have over the limit of open events, if so, mark as failed.
-			if len(containerProfile.Opens) >= MaxOpenEvents {
-				// Mark as failed
-				_, err = cm.dynamicClient.Resource(AppProfileGvr).Namespace(namespace).Patch(context.Background(),
-					appProfileName, apitypes.MergePatchType, []byte("{\"metadata\":{\"labels\":{\"kapprofiler.kubescape.io/failed\":\"true\"}}}"), v1.PatchOptions{})
-				if err != nil {
-					log.Printf("error patching application profile: %s\n", err)
-				}
-			}
+		if existingApplicationProfile.Labels == nil {
+			existingApplicationProfile.Labels = map[string]string{}
+		}
 
-			// Add the container profile into the application profile. If the container profile already exists, it will be merged.
-			existingApplicationProfileObject := &ApplicationProfile{}
-			err = runtime.DefaultUnstructuredConverter.FromUnstructured(existingApplicationProfile.Object, existingApplicationProfileObject)
-			if err != nil {
-				log.Printf("error unmarshalling application profile: %s\n", err)
-			}
+		// If not attached (seen the containers from the start) and partial label is set, remove it
+		if !attached && existingApplicationProfile.Labels["kapprofiler.kubescape.io/partial"] == "true" {
+			log.Printf("Removing partial label from application profile %s\n", appProfileName)
+			existingApplicationProfile.Labels["kapprofiler.kubescape.io/partial"] = "false"
+		}
 
-			// If not attached (seen the container from the start) and partial label is set, remove it
-			if !containerState.attached && existingApplicationProfile.GetLabels()["kapprofiler.kubescape.io/partial"] == "true" {
-				log.Printf("Removing partial label from application profile %s\n", appProfileName)
-				existingApplicationProfileObject.ObjectMeta.Labels = map[string]string{"kapprofiler.kubescape.io/partial": "false"}
-			}
+		if failed {
+			existingApplicationProfile.Labels["kapprofiler.kubescape.io/failed"] = "true"
+		}
 
-			mergedAppProfile := cm.mergeApplicationProfiles(existingApplicationProfileObject, &containerProfile, id)
-			unstructuredAppProfile, err := runtime.DefaultUnstructuredConverter.ToUnstructured(mergedAppProfile)
-			if err != nil {
-				log.Printf("error converting application profile: %s\n", err)
-			}
-			_, err = cm.dynamicClient.Resource(AppProfileGvr).Namespace(namespace).Update(
-				context.Background(),
-				&unstructured.Unstructured{
-					Object: unstructuredAppProfile,
-				},
-				v1.UpdateOptions{})
-			if err != nil {
-				log.Printf("error updating application profile: %s\n", err)
-
-				// Remove this container from the filters of the event sink so that it does not collect events for it anymore
-				cm.eventSink.RemoveFilter(&eventsink.EventSinkFilter{EventType: tracing.AllEventType, ContainerID: id.ContainerID})
-				// Stop tracing container
-				cm.tracer.StopTraceContainer(id.NsMntId, id.Pid, tracing.AllEventType)
-				// Mark stop recording
-				cm.MarkPodNotRecording(id.PodName, id.Namespace)
-
-				// Remove the container from the map
-				cm.containersMutex.Lock()
-				delete(cm.containers, *id)
-				cm.containersMutex.Unlock()
-
-				// Mark pod as failed recording
-				_, err = cm.dynamicClient.Resource(AppProfileGvr).Namespace(namespace).Patch(context.Background(),
-					appProfileName, apitypes.MergePatchType, []byte("{\"metadata\":{\"labels\":{\"kapprofiler.kubescape.io/failed\":\"true\"}}}"), v1.PatchOptions{})
-				if err != nil {
-					log.Printf("error patching application profile: %s\n", err)
-				}
+		// Label the profiles created before the workload labels were introduced
+		SetApplicationProfileWorkload(existingApplicationProfile, "pod", recordings[0].id.PodName, recordings[0].id.Namespace, recordings[0].id.PodUID)
 
-				return
-			}
+		if err := setRecordedFromStart(existingApplicationProfile, recordings); err != nil {
+			return err
 		}
 
-		// Restart timer
-		startContainerTimer(id, cm.config.Interval, cm.CollectContainerEvents)
-	} else {
-		cm.containersMutex.Unlock()
-	}
+		// Add the container profiles into the application profile. If a container profile already exists, it will be merged.
+		newBehaviour = false
+		for i := range recordings {
+			var added bool
+			existingApplicationProfile, added = cm.mergeApplicationProfiles(existingApplicationProfile, &recordings[i].profile, &recordings[i].id)
+			newBehaviour = newBehaviour || added
+		}
+		return UpdateApplicationProfile(ctx, cm.dynamicClient, namespace, existingApplicationProfile)
+	})
+	return newBehaviour, err
 }
 
-func (cm *CollectorManager) mergeApplicationProfiles(existingApplicationProfile *ApplicationProfile, containerProfile *ContainerProfile, containerId *ContainerId) *ApplicationProfile {
+// mergeApplicationProfiles merges a container profile into an application profile and returns whether it brought
+// new behaviour: entries that the existing ones, templates and generalized paths included, do not cover.
+func (cm *CollectorManager) mergeApplicationProfiles(existingApplicationProfile *ApplicationProfile, containerProfile *ContainerProfile, containerId *ContainerId) (*ApplicationProfile, bool) {
 	// Add container profile to the list of containers or merge it with the existing one.
 	for i, existingContainerProfile := range existingApplicationProfile.Spec.Containers {
 		if existingContainerProfile.Name == containerProfile.Name {
+			// The generalization of the merge may fold entries together, so the new behaviour is found before merging
+			newBehaviour := hasBehaviour(subtractContainerProfile(*containerProfile, existingContainerProfile))
+
 			// Merge container profile
 			existingContainer := existingApplicationProfile.Spec.Containers[i]
 
@@ -567,13 +984,17 @@ func (cm *CollectorManager) mergeApplicationProfiles(existingApplicationProfile
 			existingContainer.SysCalls = append(existingContainer.SysCalls, filteredSyscalls...)
 
 			// Merge execve events
+			settings := cm.getRecordingSettings(containerId.Namespace)
 			filteredExecs := []ExecCalls{}
 			for _, exec := range containerProfile.Execs {
-				if !execEventExists(&tracing.ExecveEvent{PathName: exec.Path, Args: exec.Args, Env: exec.Envs}, existingContainer.Execs) {
+				if !slices.ContainsFunc(existingContainer.Execs, exec.Equals) {
 					filteredExecs = append(filteredExecs, exec)
 				}
 			}
 			existingContainer.Execs = append(existingContainer.Execs, filteredExecs...)
+			if settings.GeneralizeExecArgs {
+				existingContainer.Execs = generalizeExecs(existingContainer.Execs)
+			}
 
 			// Merge dns events
 			filteredDns := []DnsCalls{}
@@ -611,11 +1032,16 @@ func (cm *CollectorManager) mergeApplicationProfiles(existingApplicationProfile
 			mounts := cm.podMountCache[fmt.Sprintf("%s-%s", containerId.PodName, containerId.Namespace)]
 			cm.podMountCacheMutex.Unlock()
 			for _, open := range containerProfile.Opens {
-				if cm.shouldIncludeOpenEvent(&tracing.OpenEvent{PathName: open.Path, Flags: open.Flags}, existingContainer.Opens, mounts) {
+				if cm.shouldIncludeOpenEvent(&tracing.OpenEvent{PathName: open.Path, Flags: open.Flags}, existingContainer.Opens, mounts, &settings) {
 					filteredOpens = append(filteredOpens, open)
+				} else if len(open.Executables) > 0 {
+					addOpenExecutables(existingContainer.Opens, open.Path, open.Flags, open.Executables)
 				}
 			}
 			existingContainer.Opens = append(existingContainer.Opens, filteredOpens...)
+			if settings.GeneralizeOpenPaths || len(settings.OpenPathPatterns) > 0 {
+				existingContainer.Opens = generalizeOpens(existingContainer.Opens, &settings)
+			}
 
 			// Merge network activity
 			for _, networkEvent := range containerProfile.NetworkActivity.Incoming {
@@ -629,16 +1055,62 @@ func (cm *CollectorManager) mergeApplicationProfiles(existingApplicationProfile
 				}
 			}
 
+			// Merge file operations
+			for _, fileOperation := range containerProfile.FileOperations {
+				if len(existingContainer.FileOperations) < MaxFileOperations && !slices.ContainsFunc(existingContainer.FileOperations, fileOperation.Equals) {
+					existingContainer.FileOperations = append(existingContainer.FileOperations, fileOperation)
+				}
+			}
+
+			// Merge listening ports
+			for _, listeningPort := range containerProfile.ListeningPorts {
+				if len(existingContainer.ListeningPorts) < MaxNetworkEvents && !slices.ContainsFunc(existingContainer.ListeningPorts, listeningPort.Equals) {
+					existingContainer.ListeningPorts = append(existingContainer.ListeningPorts, listeningPort)
+				}
+			}
+
+			// Merge tcp connections
+			for _, tcpConnection := range containerProfile.TcpConnections {
+				existingContainer.TcpConnections = AddTcpConnection(existingContainer.TcpConnections, tcpConnection)
+			}
+
+			// Merge privileged operations
+			for _, privilegedOperation := range containerProfile.PrivilegedOperations {
+				if len(existingContainer.PrivilegedOperations) < MaxPrivilegedOperations && !slices.ContainsFunc(existingContainer.PrivilegedOperations, privilegedOperation.Equals) {
+					existingContainer.PrivilegedOperations = append(existingContainer.PrivilegedOperations, privilegedOperation)
+				}
+			}
+
+			// Merge signals
+			for _, signal := range containerProfile.Signals {
+				if len(existingContainer.Signals) < MaxSignals && !slices.ContainsFunc(existingContainer.Signals, signal.Equals) {
+					existingContainer.Signals = append(existingContainer.Signals, signal)
+				}
+			}
+
+			// Merge the collected event types
+			for _, eventType := range containerProfile.EventTypes {
+				if !slices.Contains(existingContainer.EventTypes, eventType) {
+					existingContainer.EventTypes = append(existingContainer.EventTypes, eventType)
+				}
+			}
+			sort.Strings(existingContainer.EventTypes)
+
+			// Keep the digest of the image that was recorded last
+			if containerProfile.ImageDigest != "" {
+				existingContainer.ImageDigest = containerProfile.ImageDigest
+			}
+
 			// Replace container profile
 			existingApplicationProfile.Spec.Containers[i] = existingContainer
-			return existingApplicationProfile
+			return existingApplicationProfile, newBehaviour
 		}
 	}
 
 	// Add container profile to the list of containers
 	existingApplicationProfile.Spec.Containers = append(existingApplicationProfile.Spec.Containers, *containerProfile)
 
-	return existingApplicationProfile
+	return existingApplicationProfile, true
 }
 
 func (cm *CollectorManager) FinalizeApplicationProfile(id *ContainerId) {
@@ -663,13 +1135,39 @@ func (cm *CollectorManager) FinalizeApplicationProfile(id *ContainerId) {
 }
 
 func (cm *CollectorManager) doesApplicationProfileExists(namespace string, podName string, checkFinal bool, checkOwner bool) (bool, error) {
+	// The name of the ApplicationProfile you're looking for.
+	appProfileName, err := cm.getWorkloadApplicationProfileName(namespace, podName, checkOwner)
+	if err != nil {
+		return false, err
+	}
+	if cm.config.StoreNamespace != "" {
+		namespace = cm.config.StoreNamespace
+	}
+
+	// Get the ApplicationProfile object with the name specified above.
+	existingApplicationProfile, err := cm.dynamicClient.Resource(AppProfileGvr).Namespace(namespace).Get(context.Background(), appProfileName, v1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	// if the application profile is final (immutable), we cannot patch it
+	if checkFinal && existingApplicationProfile.GetLabels()["kapprofiler.kubescape.io/final"] != "true" {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// getWorkloadApplicationProfileName returns the name of the application profile of the pod, or of its highest level
+// owner if checkOwner is set.
+func (cm *CollectorManager) getWorkloadApplicationProfileName(namespace string, podName string, checkOwner bool) (string, error) {
 	workloadKind := "Pod"
 	workloadName := podName
 	if checkOwner {
 		// Get the highest level owner of the pod
-		pod, err := cm.k8sClient.CoreV1().Pods(namespace).Get(context.Background(), podName, v1.GetOptions{})
+		pod, err := cm.getPod(namespace, podName)
 		if err != nil {
-			return false, err
+			return "", err
 		}
 		ownerReferences := pod.GetOwnerReferences()
 		if len(ownerReferences) > 0 {
@@ -684,7 +1182,7 @@ func (cm *CollectorManager) doesApplicationProfileExists(namespace string, podNa
 			if workloadKind == "ReplicaSet" {
 				replicaSet, err := cm.k8sClient.AppsV1().ReplicaSets(namespace).Get(context.Background(), workloadName, v1.GetOptions{})
 				if err != nil {
-					return false, err
+					return "", err
 				}
 				ownerReferences := replicaSet.GetOwnerReferences()
 				if len(ownerReferences) > 0 {
@@ -700,34 +1198,17 @@ func (cm *CollectorManager) doesApplicationProfileExists(namespace string, podNa
 		}
 	}
 
-	// The name of the ApplicationProfile you're looking for.
-	appProfileName := cm.GetApplicationProfileName(namespace, workloadKind, workloadName)
-	if cm.config.StoreNamespace != "" {
-		namespace = cm.config.StoreNamespace
-	}
-
-	// Get the ApplicationProfile object with the name specified above.
-	existingApplicationProfile, err := cm.dynamicClient.Resource(AppProfileGvr).Namespace(namespace).Get(context.Background(), appProfileName, v1.GetOptions{})
-	if err != nil {
-		return false, err
-	}
-
-	// if the application profile is final (immutable), we cannot patch it
-	if checkFinal && existingApplicationProfile.GetLabels()["kapprofiler.kubescape.io/final"] != "true" {
-		return false, nil
-	}
-
-	return true, nil
+	return cm.GetApplicationProfileName(namespace, workloadKind, workloadName), nil
 }
 
 // Timer function
-func startContainerTimer(id *ContainerId, seconds uint64, callback func(id *ContainerId)) *time.Timer {
+func startTimer(seconds uint64, callback func()) *time.Timer {
 	timer := time.NewTimer(time.Duration(seconds) * time.Second)
 
 	// This goroutine waits for the timer to finish.
 	go func() {
 		<-timer.C
-		callback(id)
+		callback()
 	}()
 
 	return timer
@@ -738,42 +1219,38 @@ func (cm *CollectorManager) OnContainerActivityEvent(event *tracing.ContainerAct
 		cm.ContainerStarted(&ContainerId{
 			Namespace:   event.Namespace,
 			PodName:     event.PodName,
+			PodUID:      event.PodUID,
 			Container:   event.ContainerName,
 			NsMntId:     event.NsMntId,
 			ContainerID: event.ContainerID,
 			Pid:         event.Pid,
+			ImageDigest: event.ImageDigest,
 		}, false)
 	} else if event.Activity == tracing.ContainerActivityEventStop {
 		cm.ContainerStopped(&ContainerId{
 			Namespace:   event.Namespace,
 			PodName:     event.PodName,
+			PodUID:      event.PodUID,
 			Container:   event.ContainerName,
 			NsMntId:     event.NsMntId,
 			ContainerID: event.ContainerID,
 			Pid:         event.Pid,
+			ImageDigest: event.ImageDigest,
 		})
 	} else if event.Activity == tracing.ContainerActivityEventAttached {
 		cm.ContainerStarted(&ContainerId{
 			Namespace:   event.Namespace,
 			PodName:     event.PodName,
+			PodUID:      event.PodUID,
 			Container:   event.ContainerName,
 			NsMntId:     event.NsMntId,
 			ContainerID: event.ContainerID,
 			Pid:         event.Pid,
+			ImageDigest: event.ImageDigest,
 		}, true)
 	}
 }
 
-func execEventExists(execEvent *tracing.ExecveEvent, execCalls []ExecCalls) bool {
-	for _, call := range execCalls {
-		if execEvent.PathName == call.Path && slices.Equal(execEvent.Args, call.Args) && slices.Equal(execEvent.Env, call.Envs) {
-			return true
-		}
-	}
-
-	return false
-}
-
 func networkEventExists(networkEvent *tracing.NetworkEvent, networkCalls []NetworkCalls) bool {
 	for _, call := range networkCalls {
 		if networkEvent.DstEndpoint == call.DstEndpoint && networkEvent.Port == call.Port && networkEvent.Protocol == call.Protocol {
@@ -832,15 +1309,42 @@ func openEventExists(openEvent *tracing.OpenEvent, openEvents []OpenCalls) (bool
 	return hasSamePath, hasSameFlags
 }
 
-func (cm *CollectorManager) shouldIncludeOpenEvent(openEvent *tracing.OpenEvent, openEvents []OpenCalls, mounts []string) bool {
+// findOpen returns the index of the open entry of a path that has all the flags, see openEventExists
+func findOpen(openEvents []OpenCalls, path string, flags []string) int {
+	for i := range openEvents {
+		if openEvents[i].Path != path {
+			continue
+		}
+		hasAllFlags := true
+		for _, flag := range flags {
+			if !slices.Contains(openEvents[i].Flags, flag) {
+				hasAllFlags = false
+				break
+			}
+		}
+		if hasAllFlags {
+			return i
+		}
+	}
+	return -1
+}
+
+// addOpenExecutables adds executables to the open entry of a path that has all the flags
+func addOpenExecutables(openEvents []OpenCalls, path string, flags []string, executables []OpenExecutable) {
+	if index := findOpen(openEvents, path, flags); index != -1 {
+		openEvents[index].AddExecutables(executables)
+	}
+}
+
+func (cm *CollectorManager) shouldIncludeOpenEvent(openEvent *tracing.OpenEvent, openEvents []OpenCalls, mounts []string, settings *RecordingSettings) bool {
 	// Check if we exceeded the maximum number of open events.
 	if len(openEvents) > MaxOpenEvents {
 		return false
 	}
 
 	// Check if we should ignore this path.
-	if len(cm.config.IgnorePrefixes) > 0 {
-		for _, prefix := range cm.config.IgnorePrefixes {
+	if len(settings.IgnorePrefixes) > 0 {
+		for _, prefix := range settings.IgnorePrefixes {
 			if strings.HasPrefix(openEvent.PathName, prefix) {
 				return false
 			}
@@ -854,7 +1358,7 @@ func (cm *CollectorManager) shouldIncludeOpenEvent(openEvent *tracing.OpenEvent,
 	}
 
 	// Check if we should ignore mounts.
-	if cm.config.IgnoreMounts {
+	if settings.IgnoreMounts {
 		for _, mount := range mounts {
 			if strings.HasPrefix(openEvent.PathName, mount) {
 				return false
@@ -865,13 +1369,7 @@ func (cm *CollectorManager) shouldIncludeOpenEvent(openEvent *tracing.OpenEvent,
 	return true
 }
 
-func (cm *CollectorManager) getPodMounts(podName, namespace string) ([]string, error) {
-	pod, err := cm.k8sClient.CoreV1().Pods(namespace).Get(context.Background(), podName, v1.GetOptions{})
-	if err != nil {
-		log.Printf("error getting pod: %s\n", err)
-		return nil, err
-	}
-
+func getPodMounts(pod *corev1.Pod) []string {
 	var mounts []string
 
 	for _, container := range pod.Spec.Containers {
@@ -880,12 +1378,16 @@ func (cm *CollectorManager) getPodMounts(podName, namespace string) ([]string, e
 		}
 	}
 
-	return mounts, nil
+	return mounts
 }
 
+// GetApplicationProfileName returns the name of the application profile of a workload, or the name it is created
+// with if it does not exist yet, see ApplicationProfileNameCache.
 func (cm *CollectorManager) GetApplicationProfileName(namespace, kind, name string) string {
-	if cm.config.StoreNamespace != "" {
-		return fmt.Sprintf("%s-%s-%s", strings.ToLower(kind), strings.ToLower(name), namespace)
-	}
-	return fmt.Sprintf("%s-%s", strings.ToLower(kind), strings.ToLower(name))
+	return cm.profileNames.Get(namespace, kind, name)
+}
+
+// forgetApplicationProfileName removes the cached name of the application profile of a workload
+func (cm *CollectorManager) forgetApplicationProfileName(namespace, kind, name string) {
+	cm.profileNames.Forget(namespace, kind, name)
 }
@@ -0,0 +1,224 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kubescape/kapprofiler/pkg/eventsink"
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+type testSyscallTracer struct {
+	tracing.ITracer
+}
+
+func (t *testSyscallTracer) PeekSyscallInContainer(nsMountId uint64) ([]string, error) {
+	return []string{"open", "close"}, nil
+}
+
+func (t *testSyscallTracer) StopTraceContainer(mntns uint64, pid uint32, eventType tracing.EventType) error {
+	return nil
+}
+
+func newTestCollectorManager(dynamicClient dynamic.Interface) *CollectorManager {
+	return &CollectorManager{
+		containers:             make(map[ContainerId]*ContainerState),
+		containersMutex:        &sync.Mutex{},
+		runningContainers:      make(map[ContainerId]struct{}),
+		podFlushTimers:         make(map[string]*time.Timer),
+		podLearningStates:      make(map[string]*podLearningState),
+		dynamicClient:          dynamicClient,
+		tracer:                 &testSyscallTracer{},
+		config:                 CollectorManagerConfig{Interval: 60},
+		podMountCache:          make(map[string][]string),
+		podMountCacheMutex:     &sync.Mutex{},
+		podFinalizerState:      make(map[string]*PodProfileFinalizerState),
+		podFinalizerStateMutex: &sync.Mutex{},
+		profileNames:           NewApplicationProfileNameCache(dynamicClient, ""),
+		pods:                   newObjectCache[*corev1.Pod](),
+		namespaces:             newObjectCache[*corev1.Namespace](),
+	}
+}
+
+func TestStorePodProfileRetriesOnConflict(t *testing.T) {
+	client := newTestDynamicClient()
+	cm := newTestCollectorManager(client)
+
+	_, err := cm.storePodProfile(context.Background(), "default", "pod-nginx", []containerRecording{
+		{id: ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}, state: &ContainerState{}, profile: ContainerProfile{Name: "app", SysCalls: []string{"open"}}},
+	})
+	if err != nil {
+		t.Fatalf("error storing container profile: %s\n", err)
+	}
+
+	// The first update conflicts, like when another container of the pod wrote the profile in the meantime
+	conflicts := 0
+	client.PrependReactor("update", AppProfileGvr.Resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			conflicts++
+			return true, nil, apierrors.NewConflict(AppProfileGvr.GroupResource(), "pod-nginx", nil)
+		}
+		return false, nil, nil
+	})
+
+	_, err = cm.storePodProfile(context.Background(), "default", "pod-nginx", []containerRecording{
+		{id: ContainerId{Namespace: "default", PodName: "nginx", Container: "sidecar"}, state: &ContainerState{}, profile: ContainerProfile{Name: "sidecar", SysCalls: []string{"read"}}},
+	})
+	if err != nil {
+		t.Fatalf("error storing container profile: %s\n", err)
+	}
+	if conflicts != 1 {
+		t.Errorf("expected 1 conflict, got %d\n", conflicts)
+	}
+
+	profile, err := GetApplicationProfile(context.Background(), cm.dynamicClient, "default", "pod-nginx")
+	if err != nil {
+		t.Fatalf("error getting application profile: %s\n", err)
+	}
+	if len(profile.Spec.Containers) != 2 {
+		t.Errorf("expected 2 containers, got %d\n", len(profile.Spec.Containers))
+	}
+}
+
+func TestStorePodProfileFinal(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	err := CreateApplicationProfile(context.Background(), cm.dynamicClient, "default", &ApplicationProfile{
+		TypeMeta: v1.TypeMeta{
+			Kind:       ApplicationProfileKind,
+			APIVersion: ApplicationProfileApiVersion,
+		},
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "pod-nginx",
+			Labels: map[string]string{"kapprofiler.kubescape.io/final": "true"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating application profile: %s\n", err)
+	}
+
+	_, err = cm.storePodProfile(context.Background(), "default", "pod-nginx", []containerRecording{
+		{id: ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}, state: &ContainerState{}, profile: ContainerProfile{Name: "app"}},
+	})
+	if err != errApplicationProfileFinal {
+		t.Errorf("expected final error, got %v\n", err)
+	}
+}
+
+func TestCollectPodEventsSingleWrite(t *testing.T) {
+	client := newTestDynamicClient()
+	cm := newTestCollectorManager(client)
+	eventSink, err := eventsink.NewEventSink("", false)
+	if err != nil {
+		t.Fatalf("error creating event sink: %s\n", err)
+	}
+	if err := eventSink.Start(); err != nil {
+		t.Fatalf("error starting event sink: %s\n", err)
+	}
+	defer eventSink.Stop()
+	cm.eventSink = eventSink
+
+	cm.containers[ContainerId{Namespace: "default", PodName: "nginx", Container: "app", NsMntId: 1}] = &ContainerState{running: true}
+	cm.containers[ContainerId{Namespace: "default", PodName: "nginx", Container: "sidecar", NsMntId: 2}] = &ContainerState{running: true}
+	cm.containers[ContainerId{Namespace: "default", PodName: "other", Container: "app", NsMntId: 3}] = &ContainerState{running: true}
+	cm.startPodFlushLoop("nginx", "default")
+
+	cm.CollectPodEvents("nginx", "default")
+
+	writes := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "create" || action.GetVerb() == "update" {
+			writes++
+		}
+	}
+	if writes != 1 {
+		t.Errorf("expected 1 write, got %d\n", writes)
+	}
+
+	profile, err := GetApplicationProfile(context.Background(), client, "default", "pod-nginx")
+	if err != nil {
+		t.Fatalf("error getting application profile: %s\n", err)
+	}
+	if len(profile.Spec.Containers) != 2 || profile.Spec.Containers[0].Name != "app" || profile.Spec.Containers[1].Name != "sidecar" {
+		t.Errorf("expected the app and sidecar containers, got %+v\n", profile.Spec.Containers)
+	}
+
+	// The flush loop of the pod stops once it has no recorded containers
+	cm.containersMutex.Lock()
+	for containerId := range cm.containers {
+		if containerId.PodName == "nginx" {
+			delete(cm.containers, containerId)
+		}
+	}
+	cm.containersMutex.Unlock()
+	cm.CollectPodEvents("nginx", "default")
+	if _, ok := cm.podFlushTimers["nginx-default"]; ok {
+		t.Errorf("expected the flush loop of the pod to stop\n")
+	}
+}
+
+func TestFlushAllContainers(t *testing.T) {
+	client := newTestDynamicClient()
+	cm := newTestCollectorManager(client)
+	eventSink, err := eventsink.NewEventSink("", false)
+	if err != nil {
+		t.Fatalf("error creating event sink: %s\n", err)
+	}
+	if err := eventSink.Start(); err != nil {
+		t.Fatalf("error starting event sink: %s\n", err)
+	}
+	defer eventSink.Stop()
+	cm.eventSink = eventSink
+
+	cm.containers[ContainerId{Namespace: "default", PodName: "nginx", Container: "app", NsMntId: 1}] = &ContainerState{running: true}
+	cm.containers[ContainerId{Namespace: "default", PodName: "redis", Container: "app", NsMntId: 2}] = &ContainerState{running: true}
+	cm.startPodFlushLoop("nginx", "default")
+	cm.startPodFlushLoop("redis", "default")
+
+	if err := cm.FlushAllContainers(context.Background()); err != nil {
+		t.Fatalf("error flushing containers: %s\n", err)
+	}
+	if len(cm.podFlushTimers) != 0 {
+		t.Errorf("expected the flush loops to be stopped, got %d\n", len(cm.podFlushTimers))
+	}
+	for _, name := range []string{"pod-nginx", "pod-redis"} {
+		if _, err := GetApplicationProfile(context.Background(), client, "default", name); err != nil {
+			t.Errorf("expected application profile %s to be written: %s\n", name, err)
+		}
+	}
+
+	// Nothing is written once the deadline has passed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cm.FlushAllContainers(ctx); err == nil {
+		t.Errorf("expected an error flushing with a done context\n")
+	}
+}
+
+func TestStorePodProfileCancelled(t *testing.T) {
+	client := newTestDynamicClient()
+	cm := newTestCollectorManager(client)
+	recordings := []containerRecording{{
+		id:      ContainerId{Namespace: "default", PodName: "nginx", Container: "app"},
+		state:   &ContainerState{},
+		profile: ContainerProfile{Name: "app", SysCalls: []string{"open"}},
+	}}
+
+	// A flush running out of time stops before writing the profile
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cm.storePodProfile(ctx, "default", "pod-nginx", recordings); err != context.Canceled {
+		t.Errorf("expected the store to be cancelled, got %v\n", err)
+	}
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("expected no requests once cancelled, got %d\n", len(actions))
+	}
+}
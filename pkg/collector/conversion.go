@@ -0,0 +1,290 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// V2ExtensionsAnnotation keeps the v2 only fields of a profile while it is stored as v1.
+const V2ExtensionsAnnotation = "kapprofiler.kubescape.io/v2-extensions"
+
+var openAccessFlags = []string{"O_RDONLY", "O_WRONLY", "O_RDWR"}
+
+type networkExtensionV2 struct {
+	Peer  *NetworkPeer `json:"peer,omitempty"`
+	Stats *CallStats   `json:"stats,omitempty"`
+}
+
+type containerExtensionsV2 struct {
+	Execs    map[string]*CallStats         `json:"execs,omitempty"`
+	Opens    map[string]*CallStats         `json:"opens,omitempty"`
+	Incoming map[string]networkExtensionV2 `json:"incoming,omitempty"`
+	Outgoing map[string]networkExtensionV2 `json:"outgoing,omitempty"`
+}
+
+func (e *containerExtensionsV2) isEmpty() bool {
+	return len(e.Execs) == 0 && len(e.Opens) == 0 && len(e.Incoming) == 0 && len(e.Outgoing) == 0
+}
+
+// execExtensionKey identifies an exec by all its fields, the execs of the same program differing in their parent,
+// ids, working directory or environment have their own stats.
+func execExtensionKey(exec ExecCalls) string {
+	key, _ := json.Marshal(exec)
+	return string(key)
+}
+
+// openExtensionKey identifies an open by its path and flags, with the access mode first like in the flags written
+// back to v1.
+func openExtensionKey(path string, flags []string) string {
+	return strings.Join(append([]string{path}, joinOpenFlags(splitOpenFlags(flags))...), "\x00")
+}
+
+func networkExtensionKey(protocol string, dstEndpoint string, port uint16) string {
+	return fmt.Sprintf("%s/%s:%d", protocol, dstEndpoint, port)
+}
+
+// splitOpenFlags separates the access mode from the rest of the open flags.
+func splitOpenFlags(flags []string) OpenFlags {
+	openFlags := OpenFlags{Modifiers: []string{}}
+	for _, flag := range flags {
+		if openFlags.Access == "" && slices.Contains(openAccessFlags, flag) {
+			openFlags.Access = flag
+		} else {
+			openFlags.Modifiers = append(openFlags.Modifiers, flag)
+		}
+	}
+	return openFlags
+}
+
+// joinOpenFlags is the inverse of splitOpenFlags, the access mode is always the first flag.
+func joinOpenFlags(flags OpenFlags) []string {
+	joined := []string{}
+	if flags.Access != "" {
+		joined = append(joined, flags.Access)
+	}
+	return append(joined, flags.Modifiers...)
+}
+
+func convertNetworkCallsToV2(calls []NetworkCalls, extensions map[string]networkExtensionV2) []NetworkCallsV2 {
+	var converted []NetworkCallsV2
+	for _, call := range calls {
+		extension := extensions[networkExtensionKey(call.Protocol, call.DstEndpoint, call.Port)]
+		converted = append(converted, NetworkCallsV2{
+			Protocol:    call.Protocol,
+			Port:        call.Port,
+			DstEndpoint: call.DstEndpoint,
+			Peer:        extension.Peer,
+			Stats:       extension.Stats,
+		})
+	}
+	return converted
+}
+
+func convertNetworkCallsToV1(calls []NetworkCallsV2, extensions map[string]networkExtensionV2) []NetworkCalls {
+	var converted []NetworkCalls
+	for _, call := range calls {
+		converted = append(converted, NetworkCalls{
+			Protocol:    call.Protocol,
+			Port:        call.Port,
+			DstEndpoint: call.DstEndpoint,
+		})
+		if call.Peer != nil || call.Stats != nil {
+			extensions[networkExtensionKey(call.Protocol, call.DstEndpoint, call.Port)] = networkExtensionV2{Peer: call.Peer, Stats: call.Stats}
+		}
+	}
+	return converted
+}
+
+// ConvertApplicationProfileToV2 converts a v1 application profile to v2, restoring the v2 only fields kept in the V2ExtensionsAnnotation.
+func ConvertApplicationProfileToV2(profile *ApplicationProfile) (*ApplicationProfileV2, error) {
+	extensions := map[string]containerExtensionsV2{}
+	annotations := map[string]string{}
+	for key, value := range profile.GetAnnotations() {
+		if key == V2ExtensionsAnnotation {
+			if err := json.Unmarshal([]byte(value), &extensions); err != nil {
+				return nil, fmt.Errorf("error unmarshalling %s annotation: %w", V2ExtensionsAnnotation, err)
+			}
+			continue
+		}
+		annotations[key] = value
+	}
+
+	converted := &ApplicationProfileV2{}
+	converted.TypeMeta = profile.TypeMeta
+	converted.ObjectMeta = *profile.ObjectMeta.DeepCopy()
+	converted.APIVersion = ApplicationProfileApiVersionV2
+	converted.Annotations = annotations
+	if len(annotations) == 0 {
+		converted.Annotations = nil
+	}
+
+	for _, container := range profile.Spec.Containers {
+		extension := extensions[container.Name]
+		containerV2 := ContainerProfileV2{
+			Name:                 container.Name,
+			Capabilities:         container.Capabilities,
+			Dns:                  container.Dns,
+			SysCalls:             container.SysCalls,
+			EventTypes:           container.EventTypes,
+			ImageDigest:          container.ImageDigest,
+			FileOperations:       container.FileOperations,
+			ListeningPorts:       container.ListeningPorts,
+			TcpConnections:       container.TcpConnections,
+			PrivilegedOperations: container.PrivilegedOperations,
+			Signals:              container.Signals,
+		}
+		for _, exec := range container.Execs {
+			containerV2.Execs = append(containerV2.Execs, ExecCallsV2{
+				Path:       exec.Path,
+				Args:       exec.Args,
+				Envs:       exec.Envs,
+				ParentPath: exec.ParentPath,
+				Uid:        exec.Uid,
+				Gid:        exec.Gid,
+				Cwd:        exec.Cwd,
+				Stats:      extension.Execs[execExtensionKey(exec)],
+			})
+		}
+		for _, open := range container.Opens {
+			containerV2.Opens = append(containerV2.Opens, OpenCallsV2{
+				Path:        open.Path,
+				Flags:       splitOpenFlags(open.Flags),
+				Executables: open.Executables,
+				Stats:       extension.Opens[openExtensionKey(open.Path, open.Flags)],
+			})
+		}
+		containerV2.NetworkActivity = NetworkActivityV2{
+			Incoming: convertNetworkCallsToV2(container.NetworkActivity.Incoming, extension.Incoming),
+			Outgoing: convertNetworkCallsToV2(container.NetworkActivity.Outgoing, extension.Outgoing),
+		}
+		converted.Spec.Containers = append(converted.Spec.Containers, containerV2)
+	}
+
+	return converted, nil
+}
+
+// ConvertApplicationProfileToV1 converts a v2 application profile to v1, the fields v1 cannot hold are kept in the V2ExtensionsAnnotation.
+func ConvertApplicationProfileToV1(profile *ApplicationProfileV2) (*ApplicationProfile, error) {
+	extensions := map[string]containerExtensionsV2{}
+
+	converted := &ApplicationProfile{}
+	converted.TypeMeta = profile.TypeMeta
+	converted.ObjectMeta = *profile.ObjectMeta.DeepCopy()
+	converted.APIVersion = ApplicationProfileApiVersion
+
+	for _, container := range profile.Spec.Containers {
+		extension := containerExtensionsV2{
+			Execs:    map[string]*CallStats{},
+			Opens:    map[string]*CallStats{},
+			Incoming: map[string]networkExtensionV2{},
+			Outgoing: map[string]networkExtensionV2{},
+		}
+		containerV1 := ContainerProfile{
+			Name:                 container.Name,
+			Capabilities:         container.Capabilities,
+			Dns:                  container.Dns,
+			SysCalls:             container.SysCalls,
+			EventTypes:           container.EventTypes,
+			ImageDigest:          container.ImageDigest,
+			FileOperations:       container.FileOperations,
+			ListeningPorts:       container.ListeningPorts,
+			TcpConnections:       container.TcpConnections,
+			PrivilegedOperations: container.PrivilegedOperations,
+			Signals:              container.Signals,
+		}
+		for _, exec := range container.Execs {
+			execV1 := ExecCalls{
+				Path:       exec.Path,
+				Args:       exec.Args,
+				Envs:       exec.Envs,
+				ParentPath: exec.ParentPath,
+				Uid:        exec.Uid,
+				Gid:        exec.Gid,
+				Cwd:        exec.Cwd,
+			}
+			containerV1.Execs = append(containerV1.Execs, execV1)
+			if exec.Stats != nil {
+				extension.Execs[execExtensionKey(execV1)] = exec.Stats
+			}
+		}
+		for _, open := range container.Opens {
+			flags := joinOpenFlags(open.Flags)
+			containerV1.Opens = append(containerV1.Opens, OpenCalls{
+				Path:        open.Path,
+				Flags:       flags,
+				Executables: open.Executables,
+			})
+			if open.Stats != nil {
+				extension.Opens[openExtensionKey(open.Path, flags)] = open.Stats
+			}
+		}
+		containerV1.NetworkActivity = NetworkActivity{
+			Incoming: convertNetworkCallsToV1(container.NetworkActivity.Incoming, extension.Incoming),
+			Outgoing: convertNetworkCallsToV1(container.NetworkActivity.Outgoing, extension.Outgoing),
+		}
+		converted.Spec.Containers = append(converted.Spec.Containers, containerV1)
+
+		if !extension.isEmpty() {
+			extensions[container.Name] = extension
+		}
+	}
+
+	delete(converted.Annotations, V2ExtensionsAnnotation)
+	if len(extensions) > 0 {
+		extensionsRaw, err := json.Marshal(extensions)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling %s annotation: %w", V2ExtensionsAnnotation, err)
+		}
+		if converted.Annotations == nil {
+			converted.Annotations = map[string]string{}
+		}
+		converted.Annotations[V2ExtensionsAnnotation] = string(extensionsRaw)
+	}
+
+	return converted, nil
+}
+
+// ConvertApplicationProfile converts an unstructured application profile to the desired api version.
+func ConvertApplicationProfile(obj *unstructured.Unstructured, desiredAPIVersion string) (*unstructured.Unstructured, error) {
+	currentAPIVersion := obj.GetAPIVersion()
+	if currentAPIVersion == desiredAPIVersion {
+		return obj.DeepCopy(), nil
+	}
+
+	var converted interface{}
+	switch {
+	case currentAPIVersion == ApplicationProfileApiVersion && desiredAPIVersion == ApplicationProfileApiVersionV2:
+		profile := &ApplicationProfile{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, profile); err != nil {
+			return nil, err
+		}
+		profileV2, err := ConvertApplicationProfileToV2(profile)
+		if err != nil {
+			return nil, err
+		}
+		converted = profileV2
+	case currentAPIVersion == ApplicationProfileApiVersionV2 && desiredAPIVersion == ApplicationProfileApiVersion:
+		profileV2 := &ApplicationProfileV2{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, profileV2); err != nil {
+			return nil, err
+		}
+		profile, err := ConvertApplicationProfileToV1(profileV2)
+		if err != nil {
+			return nil, err
+		}
+		converted = profile
+	default:
+		return nil, fmt.Errorf("unsupported conversion from %s to %s", currentAPIVersion, desiredAPIVersion)
+	}
+
+	convertedRaw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(converted)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: convertedRaw}, nil
+}
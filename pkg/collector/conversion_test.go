@@ -0,0 +1,180 @@
+package collector_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kubescape/kapprofiler/pkg/collector"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func testApplicationProfileV1() *collector.ApplicationProfile {
+	return &collector.ApplicationProfile{
+		TypeMeta: v1.TypeMeta{
+			Kind:       collector.ApplicationProfileKind,
+			APIVersion: collector.ApplicationProfileApiVersion,
+		},
+		ObjectMeta: v1.ObjectMeta{
+			Name:        "pod-nginx",
+			Namespace:   "default",
+			Labels:      map[string]string{"kapprofiler.kubescape.io/final": "true"},
+			Annotations: map[string]string{"test": "value"},
+		},
+		Spec: collector.ApplicationProfileSpec{
+			Containers: []collector.ContainerProfile{
+				{
+					Name:     "app",
+					Execs:    []collector.ExecCalls{{Path: "/bin/bash", Args: []string{"-c", "echo"}, Envs: []string{}}},
+					Opens:    []collector.OpenCalls{{Path: "/etc/hosts", Flags: []string{"O_RDONLY", "O_CLOEXEC"}}, {Path: "/tmp/log", Flags: []string{"O_CREAT"}}},
+					SysCalls: []string{"open", "close"},
+					Dns:      []collector.DnsCalls{{DnsName: "kubernetes.default.", Addresses: []string{"10.96.0.1"}}},
+					Capabilities: []collector.CapabilitiesCalls{
+						{Syscall: "bind", Capabilities: []string{"NET_BIND_SERVICE"}},
+					},
+					NetworkActivity: collector.NetworkActivity{
+						Incoming: []collector.NetworkCalls{{Protocol: "TCP", Port: 80, DstEndpoint: "10.0.0.1"}},
+						Outgoing: []collector.NetworkCalls{{Protocol: "UDP", Port: 53, DstEndpoint: "10.96.0.10"}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestConvertApplicationProfileV1RoundTrip(t *testing.T) {
+	profile := testApplicationProfileV1()
+
+	profileV2, err := collector.ConvertApplicationProfileToV2(profile)
+	if err != nil {
+		t.Fatalf("error converting to v2: %s\n", err)
+	}
+	if profileV2.APIVersion != collector.ApplicationProfileApiVersionV2 {
+		t.Errorf("expected api version %s, got %s\n", collector.ApplicationProfileApiVersionV2, profileV2.APIVersion)
+	}
+	if profileV2.Spec.Containers[0].Opens[0].Flags.Access != "O_RDONLY" {
+		t.Errorf("expected access O_RDONLY, got %s\n", profileV2.Spec.Containers[0].Opens[0].Flags.Access)
+	}
+	if profileV2.Spec.Containers[0].Opens[1].Flags.Access != "" {
+		t.Errorf("expected no access mode, got %s\n", profileV2.Spec.Containers[0].Opens[1].Flags.Access)
+	}
+
+	roundTrip, err := collector.ConvertApplicationProfileToV1(profileV2)
+	if err != nil {
+		t.Fatalf("error converting to v1: %s\n", err)
+	}
+	if !reflect.DeepEqual(profile, roundTrip) {
+		t.Errorf("round trip mismatch:\nexpected %+v\ngot      %+v\n", profile, roundTrip)
+	}
+}
+
+func TestConvertApplicationProfileV2RoundTrip(t *testing.T) {
+	profileV2, err := collector.ConvertApplicationProfileToV2(testApplicationProfileV1())
+	if err != nil {
+		t.Fatalf("error converting to v2: %s\n", err)
+	}
+	seen := v1.NewTime(time.Date(2023, 9, 10, 6, 42, 24, 0, time.UTC).Local())
+	profileV2.Spec.Containers[0].Execs[0].Stats = &collector.CallStats{Count: 3, FirstSeen: seen, LastSeen: seen}
+	profileV2.Spec.Containers[0].Opens[1].Stats = &collector.CallStats{Count: 7}
+	profileV2.Spec.Containers[0].NetworkActivity.Outgoing[0].Peer = &collector.NetworkPeer{Kind: "Pod", Name: "coredns", Namespace: "kube-system"}
+
+	profile, err := collector.ConvertApplicationProfileToV1(profileV2)
+	if err != nil {
+		t.Fatalf("error converting to v1: %s\n", err)
+	}
+	if _, ok := profile.Annotations[collector.V2ExtensionsAnnotation]; !ok {
+		t.Errorf("expected %s annotation on the v1 profile\n", collector.V2ExtensionsAnnotation)
+	}
+
+	// Go through unstructured to make sure the annotation survives the storage format
+	profileRaw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(profile)
+	if err != nil {
+		t.Fatalf("error converting to unstructured: %s\n", err)
+	}
+	roundTripRaw, err := collector.ConvertApplicationProfile(&unstructured.Unstructured{Object: profileRaw}, collector.ApplicationProfileApiVersionV2)
+	if err != nil {
+		t.Fatalf("error converting to v2: %s\n", err)
+	}
+	roundTrip := &collector.ApplicationProfileV2{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(roundTripRaw.Object, roundTrip); err != nil {
+		t.Fatalf("error converting from unstructured: %s\n", err)
+	}
+	if !reflect.DeepEqual(profileV2, roundTrip) {
+		t.Errorf("round trip mismatch:\nexpected %+v\ngot      %+v\n", profileV2, roundTrip)
+	}
+}
+
+func TestConvertApplicationProfileOpenFlagsOrder(t *testing.T) {
+	profile := testApplicationProfileV1()
+	profile.Spec.Containers[0].Opens[0].Flags = []string{"O_CLOEXEC", "O_RDONLY"}
+	original := profile.Spec.Containers[0].Opens[0]
+
+	profileV2, err := collector.ConvertApplicationProfileToV2(profile)
+	if err != nil {
+		t.Fatalf("error converting to v2: %s\n", err)
+	}
+	profileV2.Spec.Containers[0].Opens[0].Stats = &collector.CallStats{Count: 5}
+
+	profileV1, err := collector.ConvertApplicationProfileToV1(profileV2)
+	if err != nil {
+		t.Fatalf("error converting to v1: %s\n", err)
+	}
+	if open := profileV1.Spec.Containers[0].Opens[0]; !open.Equals(original) {
+		t.Errorf("expected %+v to equal %+v\n", open, original)
+	}
+
+	// The stats are found again whatever the order of the flags of the v1 profile
+	profileV1.Spec.Containers[0].Opens[0].Flags = original.Flags
+	roundTrip, err := collector.ConvertApplicationProfileToV2(profileV1)
+	if err != nil {
+		t.Fatalf("error converting to v2: %s\n", err)
+	}
+	if stats := roundTrip.Spec.Containers[0].Opens[0].Stats; stats == nil || stats.Count != 5 {
+		t.Errorf("expected the stats of the open, got %+v\n", stats)
+	}
+}
+
+func TestConvertApplicationProfileExecsDifferingInParent(t *testing.T) {
+	profile := testApplicationProfileV1()
+	exec := profile.Spec.Containers[0].Execs[0]
+	exec.ParentPath = "/usr/sbin/nginx"
+	fromParent := exec
+	fromParent.ParentPath = "/usr/bin/python3"
+	profile.Spec.Containers[0].Execs = []collector.ExecCalls{exec, fromParent}
+
+	profileV2, err := collector.ConvertApplicationProfileToV2(profile)
+	if err != nil {
+		t.Fatalf("error converting to v2: %s\n", err)
+	}
+	profileV2.Spec.Containers[0].Execs[1].Stats = &collector.CallStats{Count: 2}
+
+	profileV1, err := collector.ConvertApplicationProfileToV1(profileV2)
+	if err != nil {
+		t.Fatalf("error converting to v1: %s\n", err)
+	}
+	roundTrip, err := collector.ConvertApplicationProfileToV2(profileV1)
+	if err != nil {
+		t.Fatalf("error converting to v2: %s\n", err)
+	}
+	execs := roundTrip.Spec.Containers[0].Execs
+	if execs[0].Stats != nil {
+		t.Errorf("expected no stats for the exec of %s, got %+v\n", execs[0].ParentPath, execs[0].Stats)
+	}
+	if execs[1].Stats == nil || execs[1].Stats.Count != 2 {
+		t.Errorf("expected the stats of the exec of %s, got %+v\n", execs[1].ParentPath, execs[1].Stats)
+	}
+}
+
+func TestConvertApplicationProfileUnsupportedVersion(t *testing.T) {
+	profileRaw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(testApplicationProfileV1())
+	if err != nil {
+		t.Fatalf("error converting to unstructured: %s\n", err)
+	}
+	_, err = collector.ConvertApplicationProfile(&unstructured.Unstructured{Object: profileRaw}, "kubescape.io/v3")
+	if err == nil {
+		t.Errorf("expected error converting to an unsupported version\n")
+	}
+}
@@ -0,0 +1,142 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Placeholders of the generalized exec arguments
+const (
+	execArgAny       = "<any>"
+	execArgNumber    = "<number>"
+	execArgUUID      = "<uuid>"
+	execArgTimestamp = "<timestamp>"
+	execArgHash      = "<hash>"
+	execArgTemp      = "<tmp>"
+)
+
+var (
+	tempPathArg     = regexp.MustCompile(`((?:/var)?/tmp/)[^\s,;:'"]+`)
+	uuidArg         = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	isoTimestampArg = regexp.MustCompile(`[0-9]{4}-[0-9]{2}-[0-9]{2}[T ][0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?(Z|[+-][0-9]{2}:?[0-9]{2})?`)
+	hashArg         = regexp.MustCompile(`[0-9a-fA-F]{16,}`)
+	// Unix timestamps in seconds or milliseconds from 2001 to 2033
+	epochTimestampArg = regexp.MustCompile(`\b1[0-9]{9}([0-9]{3})?\b`)
+	numberArg         = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+)
+
+// generalizeExecArg replaces the temporary paths, UUIDs, timestamps and hashes in an argument with placeholders
+func generalizeExecArg(arg string) string {
+	arg = tempPathArg.ReplaceAllString(arg, "${1}"+execArgTemp)
+	arg = uuidArg.ReplaceAllString(arg, execArgUUID)
+	arg = isoTimestampArg.ReplaceAllString(arg, execArgTimestamp)
+	arg = hashArg.ReplaceAllString(arg, execArgHash)
+	return epochTimestampArg.ReplaceAllString(arg, execArgTimestamp)
+}
+
+// execShape identifies the execs that only differ by the values of their arguments
+func execShape(exec ExecCalls) string {
+	ids := ""
+	if exec.Uid != nil {
+		ids += fmt.Sprint(*exec.Uid)
+	}
+	ids += ":"
+	if exec.Gid != nil {
+		ids += fmt.Sprint(*exec.Gid)
+	}
+	return strings.Join(append([]string{exec.Path, fmt.Sprint(len(exec.Args)), exec.ParentPath, exec.Cwd, ids}, exec.Envs...), "\x00")
+}
+
+// execArgsMatch checks if the arguments of an exec template match the arguments of an exec
+func execArgsMatch(template []string, args []string) bool {
+	if len(template) != len(args) {
+		return false
+	}
+	for i, arg := range args {
+		switch template[i] {
+		case arg, execArgAny:
+		case execArgNumber:
+			if !numberArg.MatchString(arg) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// execCovers checks if an exec entry covers another one: they are equal, or the arguments of the entry are a
+// template matching the arguments of the other one.
+func execCovers(entry ExecCalls, exec ExecCalls) bool {
+	if entry.Equals(exec) {
+		return true
+	}
+	return execShape(entry) == execShape(exec) && execArgsMatch(entry.Args, exec.Args)
+}
+
+// generalizeExecs learns the templates of the arguments of the exec entries of a container profile. The arguments
+// are generalized with the built-in heuristics, then the positions of the arguments that take more than
+// MaxExecArgValues values across the execs of the same shape are replaced with placeholders. The entries matching
+// a template are folded into it, and at most MaxExecVariants entries are kept per executable.
+func generalizeExecs(execs []ExecCalls) []ExecCalls {
+	shapes := map[string][]int{}
+	generalized := make([]ExecCalls, len(execs))
+	for i, exec := range execs {
+		args := make([]string, len(exec.Args))
+		for j, arg := range exec.Args {
+			args[j] = generalizeExecArg(arg)
+		}
+		exec.Args = args
+		generalized[i] = exec
+		shape := execShape(exec)
+		shapes[shape] = append(shapes[shape], i)
+	}
+
+	for _, indexes := range shapes {
+		if len(indexes) <= MaxExecArgValues {
+			continue
+		}
+		for position := range generalized[indexes[0]].Args {
+			values := map[string]struct{}{}
+			numbers := true
+			for _, index := range indexes {
+				value := generalized[index].Args[position]
+				values[value] = struct{}{}
+				numbers = numbers && (value == execArgNumber || numberArg.MatchString(value))
+			}
+			if len(values) <= MaxExecArgValues {
+				continue
+			}
+			placeholder := execArgAny
+			if numbers {
+				placeholder = execArgNumber
+			}
+			for _, index := range indexes {
+				generalized[index].Args[position] = placeholder
+			}
+		}
+	}
+
+	folded := []ExecCalls{}
+	for _, exec := range generalized {
+		if slices.ContainsFunc(folded, func(entry ExecCalls) bool { return execCovers(entry, exec) }) {
+			continue
+		}
+		folded = slices.DeleteFunc(folded, func(entry ExecCalls) bool { return execCovers(exec, entry) })
+		folded = append(folded, exec)
+	}
+
+	capped := []ExecCalls{}
+	variants := map[string]int{}
+	for _, exec := range folded {
+		if variants[exec.Path] < MaxExecVariants {
+			variants[exec.Path]++
+			capped = append(capped, exec)
+		}
+	}
+	return capped
+}
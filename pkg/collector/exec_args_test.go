@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestGeneralizeExecArg(t *testing.T) {
+	args := map[string]string{
+		"https://api/v1/items?ts=1700000000":              "https://api/v1/items?ts=<timestamp>",
+		"--since=2024-01-02T03:04:05Z":                    "--since=<timestamp>",
+		"--request=0f8fad5b-d9cb-469f-a165-70867728950e":  "--request=<uuid>",
+		"/tmp/tmp.XyZ123/out":                             "/tmp/<tmp>",
+		"--output=/var/tmp/upload-1":                      "--output=/var/tmp/<tmp>",
+		"sha256:3f786850e387550fdab836ed7e6dc881de23001b": "sha256:<hash>",
+		"--port=8080": "--port=8080",
+		"-c":          "-c",
+	}
+	for arg, expected := range args {
+		if generalized := generalizeExecArg(arg); generalized != expected {
+			t.Errorf("expected %s to be generalized to %s, got %s", arg, expected, generalized)
+		}
+	}
+}
+
+func TestGeneralizeExecs(t *testing.T) {
+	execs := []ExecCalls{
+		{Path: "/usr/bin/git", Args: []string{"pull"}},
+		{Path: "/usr/bin/git", Args: []string{"push"}},
+	}
+	for i := 0; i <= MaxExecArgValues; i++ {
+		execs = append(execs, ExecCalls{Path: "/usr/bin/curl", Args: []string{"-s", fmt.Sprintf("https://api/items/%c", 'a'+i)}})
+		execs = append(execs, ExecCalls{Path: "/bin/kill", Args: []string{"-HUP", fmt.Sprint(100 + i)}})
+	}
+
+	generalized := generalizeExecs(execs)
+	expected := []ExecCalls{
+		{Path: "/usr/bin/git", Args: []string{"pull"}},
+		{Path: "/usr/bin/git", Args: []string{"push"}},
+		{Path: "/usr/bin/curl", Args: []string{"-s", execArgAny}},
+		{Path: "/bin/kill", Args: []string{"-HUP", execArgNumber}},
+	}
+	if !slices.EqualFunc(generalized, expected, ExecCalls.Equals) {
+		t.Fatalf("expected %+v, got %+v", expected, generalized)
+	}
+
+	// New variants are folded into the learned templates
+	generalized = generalizeExecs(append(generalized, ExecCalls{Path: "/bin/kill", Args: []string{"-HUP", "42"}}))
+	if !slices.EqualFunc(generalized, expected, ExecCalls.Equals) {
+		t.Errorf("expected %+v, got %+v", expected, generalized)
+	}
+}
+
+func TestGeneralizeExecsLimit(t *testing.T) {
+	execs := []ExecCalls{}
+	for i := 0; i < MaxExecVariants+10; i++ {
+		// Every argument takes few values, so no template is learned
+		execs = append(execs, ExecCalls{Path: "/bin/tool", Args: []string{fmt.Sprint(i % 2), fmt.Sprint(i % 3), fmt.Sprint(i % 5), fmt.Sprint(i / 30)}})
+	}
+	if generalized := generalizeExecs(execs); len(generalized) != MaxExecVariants {
+		t.Errorf("expected %d execs, got %d", MaxExecVariants, len(generalized))
+	}
+}
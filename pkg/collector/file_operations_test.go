@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+	"golang.org/x/exp/slices"
+)
+
+func fileOperationEvent(operation string, path string, comm string) *tracing.FileOperationEvent {
+	return &tracing.FileOperationEvent{
+		GeneralEvent: tracing.GeneralEvent{ProcessDetails: tracing.ProcessDetails{Comm: comm}},
+		Operation:    operation,
+		Path:         path,
+	}
+}
+
+func TestBuildContainerProfileFileOperations(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	cm.config.GeneralizeOpenPaths = true
+	id := &ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}
+	totalEvents := &TotalEvents{FileOperationEvents: []*tracing.FileOperationEvent{
+		fileOperationEvent(tracing.FileOperationMkdir, "/var/cache/nginx/1234", "nginx"),
+		fileOperationEvent(tracing.FileOperationMkdir, "/var/cache/nginx/5678", "nginx"),
+		fileOperationEvent(tracing.FileOperationRmdir, "", "nginx"),
+		fileOperationEvent(tracing.FileOperationUnlink, "", "nginx"),
+		fileOperationEvent(tracing.FileOperationUnlink, "", "nginx"),
+		fileOperationEvent(tracing.FileOperationRename, "", "sh"),
+		fileOperationEvent(tracing.FileOperationChmod, "", "sh"),
+		fileOperationEvent(tracing.FileOperationWrite, "/var/log/nginx/access.log", "nginx"),
+		fileOperationEvent(tracing.FileOperationWrite, "", "nginx"),
+	}}
+	if !shouldProcessEvents(totalEvents) {
+		t.Fatalf("expected the file operations to be processed")
+	}
+
+	profile := cm.buildContainerProfile(id, &ContainerState{}, totalEvents)
+	expected := []FileOperationCalls{
+		{Operation: "mkdir", Path: "/var/cache/nginx/*", Comm: "nginx"},
+		{Operation: "rmdir", Comm: "nginx"},
+		{Operation: "unlink", Comm: "nginx"},
+		{Operation: "rename", Comm: "sh"},
+		{Operation: "chmod", Comm: "sh"},
+		{Operation: "write", Path: "/var/log/nginx/access.log", Comm: "nginx"},
+		{Operation: "write", Comm: "nginx"},
+	}
+	if !slices.Equal(profile.FileOperations, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, profile.FileOperations)
+	}
+
+	// Merging only adds the new operations
+	existing := &ApplicationProfile{Spec: ApplicationProfileSpec{Containers: []ContainerProfile{{
+		Name:           "app",
+		FileOperations: []FileOperationCalls{expected[2], {Operation: "rename", Comm: "nginx"}},
+	}}}}
+	merged, _ := cm.mergeApplicationProfiles(existing, &profile, id)
+	if fileOperations := merged.Spec.Containers[0].FileOperations; len(fileOperations) != 8 {
+		t.Errorf("expected 8 file operations, got %+v", fileOperations)
+	}
+
+	// Shadowed containers report the operations that are not covered by the baseline
+	delta := subtractContainerProfile(ContainerProfile{Name: "app", FileOperations: []FileOperationCalls{
+		{Operation: "mkdir", Path: "/var/cache/nginx/9", Comm: "nginx"},
+		{Operation: "mkdir", Path: "/tmp/x", Comm: "nginx"},
+		{Operation: "chmod", Comm: "sh"},
+		{Operation: "write", Path: "/etc/passwd", Comm: "sh"},
+	}}, profile)
+	if expected := []FileOperationCalls{
+		{Operation: "mkdir", Path: "/tmp/x", Comm: "nginx"},
+		{Operation: "write", Path: "/etc/passwd", Comm: "sh"},
+	}; !slices.Equal(delta.FileOperations, expected) {
+		t.Errorf("expected %+v, got %+v", expected, delta.FileOperations)
+	}
+}
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"context"
+	"log"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// imageChanged checks if the container runs another image than the one it was recorded from. Containers recorded
+// before the digests were kept in the profile are not considered changed.
+func imageChanged(profile *ApplicationProfile, id *ContainerId) bool {
+	if id.ImageDigest == "" {
+		return false
+	}
+	for _, container := range profile.Spec.Containers {
+		if container.Name == id.Container {
+			return container.ImageDigest != "" && container.ImageDigest != id.ImageDigest
+		}
+	}
+	return false
+}
+
+// relearnOnImageChange starts a new learning cycle for the final profile of the container workload if the
+// container runs another image than the one of the profile. It returns whether the container has to be recorded.
+func (cm *CollectorManager) relearnOnImageChange(id *ContainerId) bool {
+	if id.ImageDigest == "" {
+		return false
+	}
+
+	appProfileName, err := cm.getWorkloadApplicationProfileName(id.Namespace, id.PodName, true)
+	if err != nil {
+		log.Printf("error getting application profile name of pod %s/%s: %s\n", id.Namespace, id.PodName, err)
+		return false
+	}
+	storeNamespace := id.Namespace
+	if cm.config.StoreNamespace != "" {
+		storeNamespace = cm.config.StoreNamespace
+	}
+	profile, err := GetApplicationProfile(context.Background(), cm.dynamicClient, storeNamespace, appProfileName)
+	if err != nil {
+		log.Printf("error getting application profile %s: %s\n", appProfileName, err)
+		return false
+	}
+	if !imageChanged(profile, id) {
+		return false
+	}
+
+	log.Printf("Image of container %s in pod %s/%s changed to %s, relearning application profile %s\n", id.Container, id.Namespace, id.PodName, id.ImageDigest, appProfileName)
+	if err := UnfinalizeApplicationProfile(cm.dynamicClient, storeNamespace, appProfileName); err != nil {
+		log.Printf("error unfinalizing application profile %s: %s\n", appProfileName, err)
+		return false
+	}
+	// The container may also be restarted in a pod that already has a final profile of its own
+	podProfileName := cm.GetApplicationProfileName(id.Namespace, "pod", id.PodName)
+	if podProfileName != appProfileName {
+		err := UnfinalizeApplicationProfile(cm.dynamicClient, storeNamespace, podProfileName)
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("error unfinalizing application profile %s: %s\n", podProfileName, err)
+		}
+	}
+
+	// Start the learning period of the pod over
+	cm.containersMutex.Lock()
+	delete(cm.podLearningStates, generateTableKey(&metav1.ObjectMeta{Name: id.PodName, Namespace: id.Namespace}))
+	cm.containersMutex.Unlock()
+	return true
+}
@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"testing"
+)
+
+func TestImageChanged(t *testing.T) {
+	profile := &ApplicationProfile{
+		Spec: ApplicationProfileSpec{
+			Containers: []ContainerProfile{
+				{Name: "app", ImageDigest: "sha256:aaaa"},
+				{Name: "sidecar"},
+			},
+		},
+	}
+
+	if imageChanged(profile, &ContainerId{Container: "app", ImageDigest: "sha256:aaaa"}) {
+		t.Errorf("expected the same digest not to be a change\n")
+	}
+	if !imageChanged(profile, &ContainerId{Container: "app", ImageDigest: "sha256:bbbb"}) {
+		t.Errorf("expected another digest to be a change\n")
+	}
+	if imageChanged(profile, &ContainerId{Container: "app"}) {
+		t.Errorf("expected an unknown digest not to be a change\n")
+	}
+	if imageChanged(profile, &ContainerId{Container: "sidecar", ImageDigest: "sha256:bbbb"}) {
+		t.Errorf("expected a profile without digest not to be a change\n")
+	}
+	if imageChanged(profile, &ContainerId{Container: "init", ImageDigest: "sha256:bbbb"}) {
+		t.Errorf("expected a container missing from the profile not to be a change\n")
+	}
+}
+
+func TestMergeApplicationProfilesImageDigest(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	id := &ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}
+	profile := &ApplicationProfile{
+		Spec: ApplicationProfileSpec{
+			Containers: []ContainerProfile{{Name: "app", ImageDigest: "sha256:aaaa"}},
+		},
+	}
+
+	profile, _ = cm.mergeApplicationProfiles(profile, &ContainerProfile{Name: "app", ImageDigest: "sha256:bbbb"}, id)
+	if digest := profile.Spec.Containers[0].ImageDigest; digest != "sha256:bbbb" {
+		t.Errorf("expected the digest of the last recording, got %s\n", digest)
+	}
+	profile, _ = cm.mergeApplicationProfiles(profile, &ContainerProfile{Name: "app"}, id)
+	if digest := profile.Spec.Containers[0].ImageDigest; digest != "sha256:bbbb" {
+		t.Errorf("expected an unknown digest to keep the recorded one, got %s\n", digest)
+	}
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+	"golang.org/x/exp/slices"
+)
+
+func bindEvent(protocol string, address string, port uint16, comm string, exe string) *tracing.BindEvent {
+	return &tracing.BindEvent{
+		GeneralEvent: tracing.GeneralEvent{ProcessDetails: tracing.ProcessDetails{Comm: comm}},
+		Protocol:     protocol,
+		Address:      address,
+		Port:         port,
+		ExePath:      exe,
+	}
+}
+
+func TestBuildContainerProfileListeningPorts(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	id := &ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}
+	totalEvents := &TotalEvents{BindEvents: []*tracing.BindEvent{
+		bindEvent("TCP", "0.0.0.0", 80, "nginx", "/usr/sbin/nginx"),
+		bindEvent("TCP", "0.0.0.0", 80, "nginx", "/usr/sbin/nginx"),
+		bindEvent("UDP", "::", 53, "dnsmasq", ""),
+		bindEvent("UDP", "0.0.0.0", 0, "curl", "/usr/bin/curl"),
+	}}
+	if !shouldProcessEvents(totalEvents) {
+		t.Fatalf("expected the bind events to be processed")
+	}
+
+	profile := cm.buildContainerProfile(id, &ContainerState{}, totalEvents)
+	expected := []ListeningPortCalls{
+		{Protocol: "TCP", Address: "0.0.0.0", Port: 80, Comm: "nginx", Exe: "/usr/sbin/nginx"},
+		{Protocol: "UDP", Address: "::", Port: 53, Comm: "dnsmasq"},
+	}
+	if !slices.Equal(profile.ListeningPorts, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, profile.ListeningPorts)
+	}
+
+	// Merging only adds the new ports
+	existing := &ApplicationProfile{Spec: ApplicationProfileSpec{Containers: []ContainerProfile{{
+		Name:           "app",
+		ListeningPorts: []ListeningPortCalls{expected[0], {Protocol: "TCP", Address: "127.0.0.1", Port: 8080, Comm: "nginx"}},
+	}}}}
+	merged, _ := cm.mergeApplicationProfiles(existing, &profile, id)
+	if listeningPorts := merged.Spec.Containers[0].ListeningPorts; len(listeningPorts) != 3 {
+		t.Errorf("expected 3 listening ports, got %+v", listeningPorts)
+	}
+
+	// Shadowed containers report the ports that are not in the baseline
+	delta := subtractContainerProfile(ContainerProfile{Name: "app", ListeningPorts: []ListeningPortCalls{
+		expected[0],
+		{Protocol: "TCP", Address: "0.0.0.0", Port: 4444, Comm: "nc", Exe: "/bin/nc"},
+	}}, profile)
+	if expected := []ListeningPortCalls{{Protocol: "TCP", Address: "0.0.0.0", Port: 4444, Comm: "nc", Exe: "/bin/nc"}}; !slices.Equal(delta.ListeningPorts, expected) {
+		t.Errorf("expected %+v, got %+v", expected, delta.ListeningPorts)
+	}
+}
@@ -0,0 +1,194 @@
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/dynamic"
+)
+
+// Labels identifying the workload an application profile belongs to. Label values are limited to 63 characters, so
+// the full workload name is also kept in the WorkloadNameAnnotation. The UID tells apart the workloads that are
+// deleted and created again with the same name.
+const (
+	WorkloadKindLabel      = "kapprofiler.kubescape.io/workload-kind"
+	WorkloadNameLabel      = "kapprofiler.kubescape.io/workload-name"
+	WorkloadNamespaceLabel = "kapprofiler.kubescape.io/namespace"
+	WorkloadUIDLabel       = "kapprofiler.kubescape.io/workload-uid"
+	WorkloadNameAnnotation = "kapprofiler.kubescape.io/workload-name"
+)
+
+const (
+	// Longest name of a Kubernetes object
+	maxObjectNameLength = 253
+	// Longest label value
+	maxLabelValueLength = 63
+	// Length of the hash suffix of the shortened names
+	hashSuffixLength = 8
+)
+
+// shortenName shortens a name to maxLength characters or less. Shortened names end with a hash of the full name,
+// so different names stay different.
+func shortenName(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
+	}
+	hash := sha256.Sum256([]byte(name))
+	prefix := strings.TrimRight(name[:maxLength-hashSuffixLength-1], "-.")
+	return fmt.Sprintf("%s-%s", prefix, hex.EncodeToString(hash[:])[:hashSuffixLength])
+}
+
+// ApplicationProfileName returns the name of the application profile of a workload. The kind never contains a dash,
+// and the namespace of the workload, appended when the profiles are stored in a single namespace, never contains a
+// dot, so the names of different workloads do not collide.
+func ApplicationProfileName(kind string, name string, namespace string, storeNamespace bool) string {
+	profileName := fmt.Sprintf("%s-%s", strings.ToLower(kind), strings.ToLower(name))
+	if storeNamespace {
+		profileName = fmt.Sprintf("%s.%s", profileName, namespace)
+	}
+	return shortenName(profileName, maxObjectNameLength)
+}
+
+// legacyApplicationProfileName returns the name of the application profiles stored in a single namespace by the
+// previous versions of the profiler.
+func legacyApplicationProfileName(kind string, name string, namespace string) string {
+	return fmt.Sprintf("%s-%s-%s", strings.ToLower(kind), strings.ToLower(name), namespace)
+}
+
+// SetApplicationProfileWorkload labels an application profile with the workload it belongs to. The UID is left
+// unchanged when it is not known.
+func SetApplicationProfileWorkload(profile metav1.Object, kind string, name string, namespace string, uid string) {
+	profileLabels := profile.GetLabels()
+	if profileLabels == nil {
+		profileLabels = map[string]string{}
+	}
+	profileLabels[WorkloadKindLabel] = strings.ToLower(kind)
+	profileLabels[WorkloadNameLabel] = shortenName(name, maxLabelValueLength)
+	profileLabels[WorkloadNamespaceLabel] = namespace
+	if uid != "" {
+		profileLabels[WorkloadUIDLabel] = uid
+	}
+	profile.SetLabels(profileLabels)
+
+	annotations := profile.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[WorkloadNameAnnotation] = name
+	profile.SetAnnotations(annotations)
+}
+
+// FindApplicationProfileName looks up the application profile of a workload in storeNamespace, or in the namespace
+// of the workload if storeNamespace is empty. It returns the name the profile is created with if it does not exist,
+// together with a NotFound error.
+func FindApplicationProfileName(client dynamic.Interface, storeNamespace string, kind string, name string, namespace string) (string, error) {
+	profileNamespace := namespace
+	candidates := []string{ApplicationProfileName(kind, name, namespace, storeNamespace != "")}
+	if storeNamespace != "" {
+		profileNamespace = storeNamespace
+		candidates = append(candidates, legacyApplicationProfileName(kind, name, namespace))
+	}
+
+	resource := client.Resource(AppProfileGvr).Namespace(profileNamespace)
+	for _, candidate := range candidates {
+		_, err := resource.Get(context.Background(), candidate, metav1.GetOptions{})
+		if err == nil {
+			return candidate, nil
+		} else if !apierrors.IsNotFound(err) {
+			return candidates[0], err
+		}
+	}
+
+	// Fall back to the labels for the profiles whose name does not follow the naming scheme
+	selector := labels.SelectorFromSet(labels.Set{
+		WorkloadKindLabel:      strings.ToLower(kind),
+		WorkloadNameLabel:      shortenName(name, maxLabelValueLength),
+		WorkloadNamespaceLabel: namespace,
+	})
+	notDelta, _ := labels.NewRequirement(DeltaLabel, selection.NotEquals, []string{"true"})
+	selector = selector.Add(*notDelta)
+	list, err := resource.List(context.Background(), metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return candidates[0], err
+	}
+	for _, item := range list.Items {
+		if item.GetAnnotations()[WorkloadNameAnnotation] == name {
+			return item.GetName(), nil
+		}
+	}
+	return candidates[0], apierrors.NewNotFound(AppProfileGvr.GroupResource(), candidates[0])
+}
+
+// FindApplicationProfile returns the application profile of a workload with all of its shards, see FindApplicationProfileName.
+func FindApplicationProfile(client dynamic.Interface, storeNamespace string, kind string, name string, namespace string) (*ApplicationProfile, error) {
+	profileName, err := FindApplicationProfileName(client, storeNamespace, kind, name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	profileNamespace := namespace
+	if storeNamespace != "" {
+		profileNamespace = storeNamespace
+	}
+	return GetApplicationProfile(context.Background(), client, profileNamespace, profileName)
+}
+
+// ApplicationProfileNameCache caches the names of the application profiles of the workloads, so that the name is
+// looked up once per workload. A profile that does not exist is created with the returned name, and a profile keeps
+// its name until the workload is deleted.
+type ApplicationProfileNameCache struct {
+	client         dynamic.Interface
+	storeNamespace string
+	// Map of workload key to the name of its application profile
+	names map[string]string
+	mutex sync.Mutex
+}
+
+func NewApplicationProfileNameCache(client dynamic.Interface, storeNamespace string) *ApplicationProfileNameCache {
+	return &ApplicationProfileNameCache{client: client, storeNamespace: storeNamespace, names: make(map[string]string)}
+}
+
+// Get returns the name of the application profile of a workload, or the name it is created with if it does not
+// exist yet, see FindApplicationProfileName. Names that could not be looked up are not cached.
+func (c *ApplicationProfileNameCache) Get(namespace, kind, name string) string {
+	key := profileNameCacheKey(namespace, kind, name)
+	c.mutex.Lock()
+	profileName, ok := c.names[key]
+	c.mutex.Unlock()
+	if ok {
+		return profileName
+	}
+
+	profileName, err := FindApplicationProfileName(c.client, c.storeNamespace, kind, name, namespace)
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("error looking up application profile of %s %s/%s: %s\n", kind, namespace, name, err)
+		return profileName
+	}
+	c.mutex.Lock()
+	// The names of the workloads that are deleted without being seen are dropped from time to time
+	if len(c.names) >= MaxProfileNameCacheSize {
+		c.names = make(map[string]string)
+	}
+	c.names[key] = profileName
+	c.mutex.Unlock()
+	return profileName
+}
+
+// Forget removes the cached name of the application profile of a workload
+func (c *ApplicationProfileNameCache) Forget(namespace, kind, name string) {
+	c.mutex.Lock()
+	delete(c.names, profileNameCacheKey(namespace, kind, name))
+	c.mutex.Unlock()
+}
+
+func profileNameCacheKey(namespace, kind, name string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.ToLower(kind), namespace, name)
+}
@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestApplicationProfileName(t *testing.T) {
+	if name := ApplicationProfileName("Deployment", "nginx", "default", false); name != "deployment-nginx" {
+		t.Errorf("unexpected name %s\n", name)
+	}
+	if name := ApplicationProfileName("Deployment", "nginx", "default", true); name != "deployment-nginx.default" {
+		t.Errorf("unexpected name %s\n", name)
+	}
+
+	// The namespace is not mistaken for a part of the workload name
+	if ApplicationProfileName("pod", "a-b", "c", true) == ApplicationProfileName("pod", "a", "b-c", true) {
+		t.Errorf("expected different names for different workloads\n")
+	}
+
+	// Long names are shortened with a hash of the full name
+	long := strings.Repeat("x", 250)
+	first := ApplicationProfileName("pod", long+"a", "default", true)
+	second := ApplicationProfileName("pod", long+"b", "default", true)
+	if len(first) > maxObjectNameLength || len(second) > maxObjectNameLength {
+		t.Errorf("expected names of at most %d characters, got %d and %d\n", maxObjectNameLength, len(first), len(second))
+	}
+	if first == second {
+		t.Errorf("expected different names for different long workload names\n")
+	}
+	if first != ApplicationProfileName("pod", long+"a", "default", true) {
+		t.Errorf("expected the names to be deterministic\n")
+	}
+}
+
+func TestFindApplicationProfileName(t *testing.T) {
+	client := newTestDynamicClient()
+	newProfile := func(name string) *ApplicationProfile {
+		return &ApplicationProfile{
+			TypeMeta:   v1.TypeMeta{Kind: ApplicationProfileKind, APIVersion: ApplicationProfileApiVersion},
+			ObjectMeta: v1.ObjectMeta{Name: name},
+		}
+	}
+
+	name, err := FindApplicationProfileName(client, "kubescape", "pod", "nginx", "default")
+	if !apierrors.IsNotFound(err) || name != "pod-nginx.default" {
+		t.Errorf("expected the name to create the profile with, got %s and %v\n", name, err)
+	}
+
+	// Profiles written by the previous versions of the profiler
+	if err := CreateApplicationProfile(context.Background(), client, "kubescape", newProfile("pod-nginx-default")); err != nil {
+		t.Fatalf("error creating application profile: %s\n", err)
+	}
+	if name, err := FindApplicationProfileName(client, "kubescape", "pod", "nginx", "default"); err != nil || name != "pod-nginx-default" {
+		t.Errorf("expected the legacy profile, got %s and %v\n", name, err)
+	}
+
+	// Profiles found by their labels
+	long := strings.Repeat("x", 100)
+	profile := newProfile("renamed")
+	SetApplicationProfileWorkload(profile, "Deployment", long, "default", "")
+	if len(profile.Labels[WorkloadNameLabel]) > maxLabelValueLength {
+		t.Errorf("expected a label value of at most %d characters, got %d\n", maxLabelValueLength, len(profile.Labels[WorkloadNameLabel]))
+	}
+	if err := CreateApplicationProfile(context.Background(), client, "default", profile); err != nil {
+		t.Fatalf("error creating application profile: %s\n", err)
+	}
+	delta := newProfile("delta-renamed")
+	SetApplicationProfileWorkload(delta, "Deployment", long, "default", "")
+	delta.Labels[DeltaLabel] = "true"
+	if err := CreateApplicationProfile(context.Background(), client, "default", delta); err != nil {
+		t.Fatalf("error creating application profile: %s\n", err)
+	}
+	if name, err := FindApplicationProfileName(client, "", "deployment", long, "default"); err != nil || name != "renamed" {
+		t.Errorf("expected the labelled profile, got %s and %v\n", name, err)
+	}
+}
+
+func TestStorePodProfileWorkloadLabels(t *testing.T) {
+	client := newTestDynamicClient()
+	cm := newTestCollectorManager(client)
+	id := ContainerId{Namespace: "default", PodName: "nginx", PodUID: "5c3f7a52-7d0e-4d8e-9c1b-3f0e2c1a9b7d", Container: "app"}
+
+	_, err := cm.storePodProfile(context.Background(), "default", "pod-nginx", []containerRecording{
+		{id: id, state: &ContainerState{}, profile: ContainerProfile{Name: "app"}},
+	})
+	if err != nil {
+		t.Fatalf("error storing application profile: %s\n", err)
+	}
+
+	profile, err := FindApplicationProfile(client, "", "pod", "nginx", "default")
+	if err != nil {
+		t.Fatalf("error finding application profile: %s\n", err)
+	}
+	expected := map[string]string{
+		WorkloadKindLabel:      "pod",
+		WorkloadNameLabel:      "nginx",
+		WorkloadNamespaceLabel: "default",
+		WorkloadUIDLabel:       id.PodUID,
+	}
+	for key, value := range expected {
+		if profile.Labels[key] != value {
+			t.Errorf("expected label %s to be %s, got %s\n", key, value, profile.Labels[key])
+		}
+	}
+	if profile.Annotations[WorkloadNameAnnotation] != "nginx" {
+		t.Errorf("expected the workload name annotation, got %v\n", profile.Annotations)
+	}
+}
+
+func TestGetApplicationProfileNameIsCached(t *testing.T) {
+	client := newTestDynamicClient()
+	cm := newTestCollectorManager(client)
+
+	name := cm.GetApplicationProfileName("default", "pod", "nginx")
+	lookups := len(client.Actions())
+	if lookups == 0 {
+		t.Fatalf("expected the name to be looked up\n")
+	}
+	for i := 0; i < 3; i++ {
+		if cached := cm.GetApplicationProfileName("default", "pod", "nginx"); cached != name {
+			t.Errorf("expected %s, got %s\n", name, cached)
+		}
+	}
+	if actions := len(client.Actions()); actions != lookups {
+		t.Errorf("expected the cached name to be used, got %d more requests\n", actions-lookups)
+	}
+
+	// The name is looked up again once the pod is deleted
+	pod, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "nginx", Namespace: "default"}})
+	if err != nil {
+		t.Fatalf("error converting the pod: %s\n", err)
+	}
+	cm.handlePodDeleteEvent(&unstructured.Unstructured{Object: pod})
+	lookups = len(client.Actions())
+	cm.GetApplicationProfileName("default", "pod", "nginx")
+	if len(client.Actions()) == lookups {
+		t.Errorf("expected the name to be looked up again after the pod was deleted\n")
+	}
+}
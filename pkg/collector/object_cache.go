@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// objectCache keeps the last version of the objects seen by a watcher, by namespace and name
+type objectCache[T metav1.Object] struct {
+	objects map[string]T
+	mutex   sync.Mutex
+}
+
+func newObjectCache[T metav1.Object]() *objectCache[T] {
+	return &objectCache[T]{objects: make(map[string]T)}
+}
+
+func objectCacheKey(namespace string, name string) string {
+	return namespace + "/" + name
+}
+
+func (oc *objectCache[T]) set(obj T) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+	oc.objects[objectCacheKey(obj.GetNamespace(), obj.GetName())] = obj
+}
+
+func (oc *objectCache[T]) delete(namespace string, name string) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+	delete(oc.objects, objectCacheKey(namespace, name))
+}
+
+func (oc *objectCache[T]) get(namespace string, name string) (T, bool) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+	obj, ok := oc.objects[objectCacheKey(namespace, name)]
+	return obj, ok
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+	"golang.org/x/exp/slices"
+)
+
+func openEvent(path string, comm string, exe string, flags ...string) *tracing.OpenEvent {
+	return &tracing.OpenEvent{
+		GeneralEvent: tracing.GeneralEvent{ProcessDetails: tracing.ProcessDetails{Comm: comm}},
+		PathName:     path,
+		Flags:        flags,
+		ExePath:      exe,
+	}
+}
+
+func TestBuildContainerProfileOpenExecutables(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	id := &ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}
+	totalEvents := &TotalEvents{OpenEvents: []*tracing.OpenEvent{
+		openEvent("/etc/shadow", "server", "/usr/bin/server", "O_RDONLY"),
+		openEvent("/etc/shadow", "sh", "/bin/busybox", "O_RDONLY"),
+		openEvent("/etc/shadow", "server", "/usr/bin/server", "O_RDONLY"),
+	}}
+
+	// Not recorded by default
+	profile := cm.buildContainerProfile(id, &ContainerState{}, totalEvents)
+	if len(profile.Opens) != 1 || profile.Opens[0].Executables != nil {
+		t.Fatalf("expected an open without executables, got %+v", profile.Opens)
+	}
+
+	cm.config.OpenExecutables = true
+	profile = cm.buildContainerProfile(id, &ContainerState{}, totalEvents)
+	expected := []OpenExecutable{{Comm: "server", Path: "/usr/bin/server"}, {Comm: "sh", Path: "/bin/busybox"}}
+	if len(profile.Opens) != 1 || !slices.Equal(profile.Opens[0].Executables, expected) {
+		t.Fatalf("expected an open by %v, got %+v", expected, profile.Opens)
+	}
+
+	// Merging adds the new executables to the existing entry
+	existing := &ApplicationProfile{Spec: ApplicationProfileSpec{Containers: []ContainerProfile{{
+		Name:  "app",
+		Opens: []OpenCalls{{Path: "/etc/shadow", Flags: []string{"O_RDONLY", "O_CLOEXEC"}, Executables: []OpenExecutable{{Comm: "server", Path: "/usr/bin/server"}}}},
+	}}}}
+	merged, _ := cm.mergeApplicationProfiles(existing, &profile, id)
+	if opens := merged.Spec.Containers[0].Opens; len(opens) != 1 || !slices.Equal(opens[0].Executables, expected) {
+		t.Errorf("expected an open by %v, got %+v", expected, opens)
+	}
+}
+
+func TestAddExecutablesLimit(t *testing.T) {
+	open := OpenCalls{Path: "/etc/hosts"}
+	for i := 0; i < MaxOpenExecutables+2; i++ {
+		open.AddExecutables([]OpenExecutable{{Comm: string(rune('a' + i))}})
+	}
+	if len(open.Executables) != MaxOpenExecutables {
+		t.Errorf("expected %d executables, got %d", MaxOpenExecutables, len(open.Executables))
+	}
+}
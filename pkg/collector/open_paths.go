@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Wildcard replacing the dynamic parts of the generalized open paths. Generalized paths are path.Match patterns.
+const openPathWildcard = "*"
+
+var (
+	numberSegment   = regexp.MustCompile(`^[0-9]+$`)
+	uuidSegment     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexHash         = regexp.MustCompile(`[0-9a-fA-F]{16,}`)
+	tempFileSegment = regexp.MustCompile(`^(tmp|temp)\.[0-9A-Za-z]{6,}$`)
+	rotatedLog      = regexp.MustCompile(`log\.[0-9]+(\.gz)?$`)
+)
+
+// generalizeOpenPath replaces the dynamic parts of a path: PIDs and other numbers, UUIDs, hex hashes, the names of
+// temporary files and the numbers of rotated logs.
+func generalizeOpenPath(openPath string) string {
+	segments := strings.Split(openPath, "/")
+	for i, segment := range segments {
+		switch {
+		case numberSegment.MatchString(segment), uuidSegment.MatchString(segment):
+			segments[i] = openPathWildcard
+		case tempFileSegment.MatchString(segment):
+			segments[i] = segment[:strings.Index(segment, ".")+1] + openPathWildcard
+		default:
+			segment = hexHash.ReplaceAllString(segment, openPathWildcard)
+			segments[i] = rotatedLog.ReplaceAllString(segment, "log."+openPathWildcard)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isOpenPathPattern checks if the path of an open entry is a pattern
+func isOpenPathPattern(openPath string) bool {
+	return strings.ContainsAny(openPath, "*?[")
+}
+
+// matchOpenPathPattern returns the first pattern matching a path, empty if none does
+func matchOpenPathPattern(patterns []string, openPath string) string {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, openPath); matched {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// openCovers checks if an open entry covers another one: they are equal, or the path of the entry is a pattern
+// matching the path of the other one.
+func openCovers(entry OpenCalls, open OpenCalls) bool {
+	if entry.Equals(open) {
+		return true
+	}
+	if !isOpenPathPattern(entry.Path) {
+		return false
+	}
+	matched, _ := path.Match(entry.Path, open.Path)
+	return matched && sameOpenFlags(entry.Flags, open.Flags)
+}
+
+// fileOperationCovers checks if a file operation entry covers another one: they are equal, or the path of the entry
+// is a pattern matching the path of the other one.
+func fileOperationCovers(entry FileOperationCalls, fileOperation FileOperationCalls) bool {
+	if entry.Equals(fileOperation) {
+		return true
+	}
+	if entry.Operation != fileOperation.Operation || entry.Comm != fileOperation.Comm || !isOpenPathPattern(entry.Path) {
+		return false
+	}
+	matched, _ := path.Match(entry.Path, fileOperation.Path)
+	return matched
+}
+
+// normalizeOpenPath returns the path an open is recorded with: the configured pattern it matches, or the
+// generalized path if the built-in heuristics are enabled.
+func normalizeOpenPath(openPath string, settings *RecordingSettings) string {
+	if pattern := matchOpenPathPattern(settings.OpenPathPatterns, openPath); pattern != "" {
+		return pattern
+	}
+	if settings.GeneralizeOpenPaths {
+		return generalizeOpenPath(openPath)
+	}
+	return openPath
+}
+
+// generalizeOpens folds the open entries of a container profile into the patterns of the configured rules and of
+// the other entries. With the built-in heuristics, the children of the directories with more than
+// MaxOpenDirectoryChildren entries are also folded into a wildcard.
+func generalizeOpens(opens []OpenCalls, settings *RecordingSettings) []OpenCalls {
+	patterns := append([]string{}, settings.OpenPathPatterns...)
+	for _, open := range opens {
+		if isOpenPathPattern(open.Path) {
+			patterns = append(patterns, open.Path)
+		}
+	}
+
+	paths := make([]string, len(opens))
+	children := map[string]map[string]struct{}{}
+	for i, open := range opens {
+		paths[i] = open.Path
+		if !isOpenPathPattern(open.Path) {
+			if pattern := matchOpenPathPattern(patterns, open.Path); pattern != "" {
+				paths[i] = pattern
+			}
+		}
+		if settings.GeneralizeOpenPaths {
+			directory, child := path.Split(paths[i])
+			if children[directory] == nil {
+				children[directory] = map[string]struct{}{}
+			}
+			children[directory][child] = struct{}{}
+		}
+	}
+
+	generalized := []OpenCalls{}
+	for i, open := range opens {
+		if directory, _ := path.Split(paths[i]); len(children[directory]) > MaxOpenDirectoryChildren {
+			paths[i] = directory + openPathWildcard
+		}
+		if index := findOpen(generalized, paths[i], open.Flags); index != -1 {
+			generalized[index].AddExecutables(open.Executables)
+			continue
+		}
+		open.Path = paths[i]
+		generalized = append(generalized, open)
+	}
+	return generalized
+}
@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+)
+
+func TestGeneralizeOpenPath(t *testing.T) {
+	paths := map[string]string{
+		"/proc/1234/status":         "/proc/*/status",
+		"/proc/1234/task/1240/stat": "/proc/*/task/*/stat",
+		"/proc/self/maps":           "/proc/self/maps",
+		"/tmp/tmp.XyZ123":           "/tmp/tmp.*",
+		"/var/run/secrets/0f8fad5b-d9cb-469f-a165-70867728950e":        "/var/run/secrets/*",
+		"/var/cache/app/3f786850e387550fdab836ed7e6dc881de23001b.json": "/var/cache/app/*.json",
+		"/var/log/app.log.3":                  "/var/log/app.log.*",
+		"/var/log/syslog.2.gz":                "/var/log/syslog.*",
+		"/usr/lib/x86_64-linux-gnu/libc.so.6": "/usr/lib/x86_64-linux-gnu/libc.so.6",
+		"/usr/lib/python3.11/os.py":           "/usr/lib/python3.11/os.py",
+		"/etc/nginx/nginx.conf":               "/etc/nginx/nginx.conf",
+	}
+	for openPath, expected := range paths {
+		if generalized := generalizeOpenPath(openPath); generalized != expected {
+			t.Errorf("expected %s to be generalized to %s, got %s", openPath, expected, generalized)
+		}
+	}
+}
+
+func TestGeneralizeOpens(t *testing.T) {
+	settings := &RecordingSettings{GeneralizeOpenPaths: true, OpenPathPatterns: []string{"/data/*/index"}}
+	opens := []OpenCalls{
+		{Path: "/proc/*/status", Flags: []string{"O_RDONLY"}},
+		{Path: "/data/shard1/index", Flags: []string{"O_RDONLY"}},
+		{Path: "/data/shard2/index", Flags: []string{"O_RDONLY"}, Executables: []OpenExecutable{{Comm: "server"}}},
+		{Path: "/etc/hosts", Flags: []string{"O_RDONLY"}},
+	}
+	for i := 0; i <= MaxOpenDirectoryChildren; i++ {
+		opens = append(opens, OpenCalls{Path: fmt.Sprintf("/var/cache/app/entry-%c%d", 'a'+i%26, i), Flags: []string{"O_RDWR"}})
+	}
+
+	generalized := generalizeOpens(opens, settings)
+	expected := []string{"/proc/*/status", "/data/*/index", "/etc/hosts", "/var/cache/app/*"}
+	if len(generalized) != len(expected) {
+		t.Fatalf("expected %d opens, got %+v", len(expected), generalized)
+	}
+	for i, open := range generalized {
+		if open.Path != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], open.Path)
+		}
+	}
+	if len(generalized[1].Executables) != 1 {
+		t.Errorf("expected the executables of the folded entries to be kept, got %+v", generalized[1])
+	}
+}
+
+func TestBuildContainerProfileGeneralizesOpens(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	cm.config.GeneralizeOpenPaths = true
+	id := &ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}
+	profile := cm.buildContainerProfile(id, &ContainerState{}, &TotalEvents{OpenEvents: []*tracing.OpenEvent{
+		openEvent("/proc/1/status", "server", "", "O_RDONLY"),
+		openEvent("/proc/2/status", "server", "", "O_RDONLY"),
+	}})
+	if len(profile.Opens) != 1 || profile.Opens[0].Path != "/proc/*/status" {
+		t.Fatalf("expected a single generalized open, got %+v", profile.Opens)
+	}
+
+	// New paths matching a generalized entry of the profile are folded into it
+	existing := &ApplicationProfile{Spec: ApplicationProfileSpec{Containers: []ContainerProfile{{Name: "app", Opens: profile.Opens}}}}
+	cm.config.GeneralizeOpenPaths = false
+	cm.config.OpenPathPatterns = []string{"/run/app/*"}
+	profile = cm.buildContainerProfile(id, &ContainerState{}, &TotalEvents{OpenEvents: []*tracing.OpenEvent{
+		openEvent("/run/app/1.sock", "server", "", "O_RDONLY"),
+		openEvent("/proc/3/status", "server", "", "O_RDONLY"),
+	}})
+	merged, _ := cm.mergeApplicationProfiles(existing, &profile, id)
+	if opens := merged.Spec.Containers[0].Opens; len(opens) != 2 || opens[1].Path != "/run/app/*" {
+		t.Errorf("expected the opens to be recorded as their patterns, got %+v", opens)
+	}
+}
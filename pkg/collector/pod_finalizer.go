@@ -14,7 +14,6 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	apitypes "k8s.io/apimachinery/pkg/types"
 )
 
 type PodProfileFinalizerState struct {
@@ -26,6 +25,8 @@ type PodProfileFinalizerState struct {
 	FinalizationTimer *time.Timer
 	// Recording state
 	Recording bool
+	// Learning duration from the pod annotations (0 if not set), for the finalization timer or the collection intervals
+	LearningDuration time.Duration
 }
 
 func (cm *CollectorManager) StartFinalizerWatcher() {
@@ -73,6 +74,7 @@ func (cm *CollectorManager) handlePodAddEvent(obj interface{}) {
 		log.Printf("the interface is not a Pod %v", err)
 		return
 	}
+	cm.pods.set(pod)
 
 	podReady := false
 	for _, condition := range pod.Status.Conditions {
@@ -92,12 +94,13 @@ func (cm *CollectorManager) handlePodAddEvent(obj interface{}) {
 			Namespace: pod.GetNamespace(),
 		}
 		cm.podFinalizerStateMutex.Unlock()
+		cm.handlePodAnnotations(pod)
 	} else {
 		cm.podFinalizerStateMutex.Unlock()
 		// Check if pod is ready
 		if podReady {
 			// Start finalization timer
-			cm.startFinalizationTimer(pod)
+			cm.startFinalizationTimer(pod, cm.getPodAnnotatedLearningDuration(pod))
 		}
 	}
 }
@@ -109,6 +112,10 @@ func (cm *CollectorManager) handlePodUpdateEvent(obj interface{}) {
 		log.Printf("the interface is not a Pod %v", err)
 		return
 	}
+	cm.pods.set(pod)
+
+	// Operator annotations apply to the pods that are not recorded too
+	cm.handlePodAnnotations(pod)
 
 	// Check if recoding
 	cm.podFinalizerStateMutex.Lock()
@@ -148,16 +155,25 @@ func (cm *CollectorManager) handlePodUpdateEvent(obj interface{}) {
 		}
 
 		// Timer is not running, add finalizer
-		podState.FinalizationTimer = cm.startFinalizationTimer(pod)
+		podState.FinalizationTimer = cm.startFinalizationTimer(pod, podState.LearningDuration)
 	} else {
 		cm.stopTimer(&pod.ObjectMeta)
 	}
 }
 
-// Timer function
-func (cm *CollectorManager) startFinalizationTimer(pod *v1.Pod) *time.Timer {
+// Timer function, the learning duration of the pod annotations replaces the finalization time if it is set
+func (cm *CollectorManager) startFinalizationTimer(pod *v1.Pod, learningDuration time.Duration) *time.Timer {
+	// Quiescence based finalization is driven by the collection intervals instead
+	if cm.quiescenceEnabled() {
+		return nil
+	}
+
 	jitter := uint64(rand.Intn(int(cm.config.FinalizeJitter)))
-	finalizationTimer := time.NewTimer(time.Duration(cm.config.FinalizeTime+jitter) * time.Second)
+	finalizeTime := time.Duration(cm.getRecordingSettings(pod.GetNamespace()).FinalizeTime+jitter) * time.Second
+	if learningDuration > 0 {
+		finalizeTime = learningDuration
+	}
+	finalizationTimer := time.NewTimer(finalizeTime)
 
 	// This goroutine waits for the timer to finish.
 	go func() {
@@ -169,16 +185,17 @@ func (cm *CollectorManager) startFinalizationTimer(pod *v1.Pod) *time.Timer {
 }
 
 func (cm *CollectorManager) finalizePodProfile(pod *v1.Pod) {
+	cm.finalizeApplicationProfile(pod.GetName(), pod.GetNamespace(), FinalizationReasonTimer)
+}
+
+func (cm *CollectorManager) finalizeApplicationProfile(podName string, namespace string, reason string) {
 	// Generate pod application profile name
-	namespace := pod.GetNamespace()
-	appProfileName := cm.GetApplicationProfileName(namespace, "pod", pod.GetName())
+	appProfileName := cm.GetApplicationProfileName(namespace, "pod", podName)
 	// Put label on pod application profile to mark it as finalized
 	if cm.config.StoreNamespace != "" {
 		namespace = cm.config.StoreNamespace
 	}
-	_, err := cm.dynamicClient.Resource(AppProfileGvr).Namespace(namespace).Patch(context.Background(),
-		appProfileName, apitypes.MergePatchType, []byte("{\"metadata\":{\"labels\":{\"kapprofiler.kubescape.io/final\":\"true\"}}}"), metav1.PatchOptions{})
-	if err != nil {
+	if err := SetApplicationProfileFinal(cm.dynamicClient, namespace, appProfileName, reason); err != nil {
 		log.Printf("error patching application profile: %s\n", err)
 	}
 }
@@ -190,6 +207,7 @@ func (cm *CollectorManager) handlePodDeleteEvent(obj interface{}) {
 		log.Printf("Error getting Pod object %v", err)
 		return
 	}
+	cm.pods.delete(pod.Namespace, pod.Name)
 
 	// Delete timer if there is
 	cm.stopTimer(&pod.ObjectMeta)
@@ -200,8 +218,9 @@ func (cm *CollectorManager) handlePodDeleteEvent(obj interface{}) {
 	if cm.config.StoreNamespace != "" {
 		namespace = cm.config.StoreNamespace
 	}
+	cm.forgetApplicationProfileName(pod.Namespace, "pod", pod.Name)
 	// Delete pod application profile CRD
-	err = cm.dynamicClient.Resource(AppProfileGvr).Namespace(namespace).Delete(context.TODO(), appProfileName, metav1.DeleteOptions{})
+	err = DeleteApplicationProfile(context.Background(), cm.dynamicClient, namespace, appProfileName)
 	if err != nil {
 		log.Printf("Error deleting pod application profile: %v", err)
 		return
@@ -232,30 +251,18 @@ func (cm *CollectorManager) stopTimer(pod *metav1.ObjectMeta) {
 }
 
 func (cm *CollectorManager) MarkPodRecording(pod, namespace string, attach bool) {
+	var podObj *v1.Pod
 	if attach {
-		// Check if pod is ready
-		pod, err := cm.k8sClient.CoreV1().Pods(namespace).Get(context.Background(), pod, metav1.GetOptions{})
+		var err error
+		podObj, err = cm.getPod(namespace, pod)
 		if err != nil {
 			log.Printf("Error getting pod %s in namespace %s: %v", pod, namespace, err)
 			return
 		}
-
-		podReady := false
-		for _, condition := range pod.Status.Conditions {
-			if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
-				podReady = true
-			}
-		}
-
-		if podReady {
-			// Start finalization timer
-			cm.startFinalizationTimer(pod)
-		}
 	}
 
 	// Get mutex
 	cm.podFinalizerStateMutex.Lock()
-	defer cm.podFinalizerStateMutex.Unlock()
 
 	// Check if pod is in map
 	podState, ok := cm.podFinalizerState[generateTableKey(&metav1.ObjectMeta{
@@ -264,16 +271,35 @@ func (cm *CollectorManager) MarkPodRecording(pod, namespace string, attach bool)
 	})]
 	if !ok {
 		// Add pod to map
+		podState = &PodProfileFinalizerState{
+			PodName:   pod,
+			Namespace: namespace,
+		}
+		if podObj != nil {
+			podState.LearningDuration, _ = getLearningDuration(podObj)
+		}
 		cm.podFinalizerState[generateTableKey(&metav1.ObjectMeta{
 			Name:      pod,
 			Namespace: namespace,
-		})] = &PodProfileFinalizerState{
-			PodName:   pod,
-			Namespace: namespace,
-			Recording: true,
+		})] = podState
+	}
+	podState.Recording = true
+	learningDuration := podState.LearningDuration
+	cm.podFinalizerStateMutex.Unlock()
+
+	if podObj != nil {
+		// Check if pod is ready
+		podReady := false
+		for _, condition := range podObj.Status.Conditions {
+			if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+				podReady = true
+			}
+		}
+
+		if podReady {
+			// Start finalization timer
+			cm.startFinalizationTimer(podObj, learningDuration)
 		}
-	} else {
-		podState.Recording = true
 	}
 }
 
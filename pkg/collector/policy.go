@@ -0,0 +1,256 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+	"github.com/kubescape/kapprofiler/pkg/watcher"
+
+	"golang.org/x/exp/slices"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	ProfilingPolicyKind       string = "ProfilingPolicy"
+	ProfilingPolicyPlural     string = "profilingpolicies"
+	ProfilingPolicyApiVersion string = "kubescape.io/v1"
+	// Name of the policy in the namespace of the agent that applies to the namespaces without a policy
+	DefaultProfilingPolicyName string = "default"
+)
+
+// Record strategies a policy can set
+var recordStrategies = []string{RecordStrategyAlways, RecordStrategyOnlyIfNotExists, RecordStrategyRelearnOnImageChange, RecordStrategyShadow}
+
+var ProfilingPolicyGvr schema.GroupVersionResource = schema.GroupVersionResource{
+	Group:    "kubescape.io",
+	Version:  "v1",
+	Resource: ProfilingPolicyPlural,
+}
+
+// ProfilingPolicySpec overrides the recording settings of the collector configuration, unset fields keep them.
+type ProfilingPolicySpec struct {
+	IgnorePrefixes []string `json:"ignorePrefixes,omitempty"`
+	IgnoreMounts   *bool    `json:"ignoreMounts,omitempty"`
+	RecordStrategy string   `json:"recordStrategy,omitempty"`
+	// Seconds after the pod is ready to finalize its profile
+	FinalizeTime *uint64 `json:"finalizeTime,omitempty"`
+	// Event types to trace in the containers, see ParseEventTypes
+	EventTypes []string `json:"eventTypes,omitempty"`
+	// Record the executables that opened each file
+	OpenExecutables *bool `json:"openExecutables,omitempty"`
+	// Replace the dynamic parts of the opened paths with wildcards
+	GeneralizeOpenPaths *bool `json:"generalizeOpenPaths,omitempty"`
+	// Patterns the opened paths are recorded as, see path.Match
+	OpenPathPatterns []string `json:"openPathPatterns,omitempty"`
+	// Learn templates of the exec arguments
+	GeneralizeExecArgs *bool `json:"generalizeExecArgs,omitempty"`
+
+	// EventTypes parsed by Validate
+	eventTypes []tracing.EventType
+}
+
+type ProfilingPolicy struct {
+	v1.TypeMeta   `json:",inline"`
+	v1.ObjectMeta `json:"metadata,omitempty"`
+	Spec          ProfilingPolicySpec `json:"spec,omitempty"`
+}
+
+// RecordingSettings are the recording settings of a namespace.
+type RecordingSettings struct {
+	IgnorePrefixes []string
+	IgnoreMounts   bool
+	RecordStrategy string
+	FinalizeTime   uint64
+	// nil to trace the default event types
+	EventTypes          []tracing.EventType
+	OpenExecutables     bool
+	GeneralizeOpenPaths bool
+	OpenPathPatterns    []string
+	GeneralizeExecArgs  bool
+}
+
+// Validate checks the fields of the policy and caches the parsed event types, policies are validated once when they
+// are added or updated.
+func (p *ProfilingPolicySpec) Validate() error {
+	if p.RecordStrategy != "" && !slices.Contains(recordStrategies, p.RecordStrategy) {
+		return fmt.Errorf("invalid record strategy %q", p.RecordStrategy)
+	}
+	for _, pattern := range p.OpenPathPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid open path pattern %q: %w", pattern, err)
+		}
+	}
+	p.eventTypes = nil
+	if p.EventTypes != nil {
+		eventTypes, err := ParseEventTypes(p.EventTypes)
+		if err != nil {
+			return fmt.Errorf("invalid event types: %w", err)
+		}
+		p.eventTypes = eventTypes
+	}
+	return nil
+}
+
+// Apply returns the settings overridden by the policy, the event types apply once the policy is validated.
+func (p *ProfilingPolicySpec) Apply(settings RecordingSettings) RecordingSettings {
+	if p.IgnorePrefixes != nil {
+		settings.IgnorePrefixes = p.IgnorePrefixes
+	}
+	if p.IgnoreMounts != nil {
+		settings.IgnoreMounts = *p.IgnoreMounts
+	}
+	if p.RecordStrategy != "" {
+		settings.RecordStrategy = p.RecordStrategy
+	}
+	if p.FinalizeTime != nil {
+		settings.FinalizeTime = *p.FinalizeTime
+	}
+	if p.OpenExecutables != nil {
+		settings.OpenExecutables = *p.OpenExecutables
+	}
+	if p.GeneralizeOpenPaths != nil {
+		settings.GeneralizeOpenPaths = *p.GeneralizeOpenPaths
+	}
+	if p.OpenPathPatterns != nil {
+		settings.OpenPathPatterns = p.OpenPathPatterns
+	}
+	if p.GeneralizeExecArgs != nil {
+		settings.GeneralizeExecArgs = *p.GeneralizeExecArgs
+	}
+	if p.eventTypes != nil {
+		settings.EventTypes = p.eventTypes
+	}
+	return settings
+}
+
+// Policies of the cluster by namespace and name
+type policyCache struct {
+	policies map[string]map[string]*ProfilingPolicy
+	mutex    sync.Mutex
+}
+
+func newPolicyCache() *policyCache {
+	return &policyCache{policies: make(map[string]map[string]*ProfilingPolicy)}
+}
+
+func (pc *policyCache) set(policy *ProfilingPolicy) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	if _, ok := pc.policies[policy.Namespace]; !ok {
+		pc.policies[policy.Namespace] = make(map[string]*ProfilingPolicy)
+	}
+	pc.policies[policy.Namespace][policy.Name] = policy
+}
+
+func (pc *policyCache) delete(namespace string, name string) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	delete(pc.policies[namespace], name)
+	if len(pc.policies[namespace]) == 0 {
+		delete(pc.policies, namespace)
+	}
+}
+
+// get returns the policy of a namespace, the first one by name if there are several.
+func (pc *policyCache) get(namespace string) *ProfilingPolicy {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	names := make([]string, 0, len(pc.policies[namespace]))
+	for name := range pc.policies[namespace] {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return pc.policies[namespace][names[0]]
+}
+
+func (pc *policyCache) getByName(namespace string, name string) *ProfilingPolicy {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	return pc.policies[namespace][name]
+}
+
+// getRecordingSettings returns the settings of a namespace. The policy of the namespace applies first, then the
+// cluster-wide default policy, then the collector configuration.
+func (cm *CollectorManager) getRecordingSettings(namespace string) RecordingSettings {
+	settings := RecordingSettings{
+		IgnorePrefixes:      cm.config.IgnorePrefixes,
+		IgnoreMounts:        cm.config.IgnoreMounts,
+		RecordStrategy:      cm.config.RecordStrategy,
+		FinalizeTime:        cm.config.FinalizeTime,
+		EventTypes:          cm.config.EventTypes,
+		OpenExecutables:     cm.config.OpenExecutables,
+		GeneralizeOpenPaths: cm.config.GeneralizeOpenPaths,
+		OpenPathPatterns:    cm.config.OpenPathPatterns,
+		GeneralizeExecArgs:  cm.config.GeneralizeExecArgs,
+	}
+	if cm.policies == nil {
+		return settings
+	}
+	if policy := cm.policies.get(namespace); policy != nil {
+		return policy.Spec.Apply(settings)
+	}
+	if cm.config.DefaultPolicyNamespace != "" {
+		if policy := cm.policies.getByName(cm.config.DefaultPolicyNamespace, DefaultProfilingPolicyName); policy != nil {
+			return policy.Spec.Apply(settings)
+		}
+	}
+	return settings
+}
+
+func convertUnstructuredToPolicy(obj *unstructured.Unstructured) (*ProfilingPolicy, error) {
+	policy := &ProfilingPolicy{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (cm *CollectorManager) StartPolicyWatcher() {
+	cm.policies = newPolicyCache()
+	cm.policyWatcher = watcher.NewWatcher(cm.dynamicClient, false)
+
+	setPolicy := func(obj *unstructured.Unstructured) {
+		policy, err := convertUnstructuredToPolicy(obj)
+		if err != nil {
+			log.Printf("the object is not a ProfilingPolicy %v", err)
+			return
+		}
+		if err := policy.Spec.Validate(); err != nil {
+			// The previous version of the policy, if any, stays in effect
+			log.Printf("ignoring ProfilingPolicy %s/%s: %v\n", policy.Namespace, policy.Name, err)
+			return
+		}
+		cm.policies.set(policy)
+	}
+	err := cm.policyWatcher.Start(watcher.WatchNotifyFunctions{
+		AddFunc:    setPolicy,
+		UpdateFunc: setPolicy,
+		DeleteFunc: func(obj *unstructured.Unstructured) {
+			cm.policies.delete(obj.GetNamespace(), obj.GetName())
+		},
+	}, ProfilingPolicyGvr, v1.ListOptions{})
+
+	if err != nil {
+		// Without the CRD the collector configuration applies to all namespaces
+		log.Printf("Error starting ProfilingPolicy watcher: %v", err)
+		cm.policyWatcher = nil
+		return
+	}
+}
+
+func (cm *CollectorManager) StopPolicyWatcher() {
+	if cm.policyWatcher != nil {
+		cm.policyWatcher.Stop()
+	}
+}
@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetRecordingSettings(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	cm.config.IgnorePrefixes = []string{"/proc"}
+	cm.config.RecordStrategy = RecordStrategyOnlyIfNotExists
+	cm.config.FinalizeTime = 80
+	cm.config.DefaultPolicyNamespace = "kubescape"
+	cm.policies = newPolicyCache()
+
+	ignoreMounts := true
+	finalizeTime := uint64(600)
+	cm.policies.set(&ProfilingPolicy{
+		ObjectMeta: v1.ObjectMeta{Name: DefaultProfilingPolicyName, Namespace: "kubescape"},
+		Spec:       ProfilingPolicySpec{IgnoreMounts: &ignoreMounts},
+	})
+	cm.policies.set(&ProfilingPolicy{
+		ObjectMeta: v1.ObjectMeta{Name: "policy", Namespace: "shop"},
+		Spec:       ProfilingPolicySpec{IgnorePrefixes: []string{"/tmp"}, RecordStrategy: RecordStrategyAlways, FinalizeTime: &finalizeTime},
+	})
+
+	// The policy of the namespace overrides the configuration, the fields it leaves out are kept
+	expected := RecordingSettings{IgnorePrefixes: []string{"/tmp"}, RecordStrategy: RecordStrategyAlways, FinalizeTime: 600}
+	if settings := cm.getRecordingSettings("shop"); !reflect.DeepEqual(settings, expected) {
+		t.Errorf("expected %+v, got %+v\n", expected, settings)
+	}
+
+	// Namespaces without a policy get the cluster-wide default
+	expected = RecordingSettings{IgnorePrefixes: []string{"/proc"}, IgnoreMounts: true, RecordStrategy: RecordStrategyOnlyIfNotExists, FinalizeTime: 80}
+	if settings := cm.getRecordingSettings("default"); !reflect.DeepEqual(settings, expected) {
+		t.Errorf("expected %+v, got %+v\n", expected, settings)
+	}
+
+	// And the configuration once the default policy is deleted
+	cm.policies.delete("kubescape", DefaultProfilingPolicyName)
+	expected.IgnoreMounts = false
+	if settings := cm.getRecordingSettings("default"); !reflect.DeepEqual(settings, expected) {
+		t.Errorf("expected %+v, got %+v\n", expected, settings)
+	}
+}
+
+func TestValidateProfilingPolicy(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  ProfilingPolicySpec
+		valid bool
+	}{
+		{"empty", ProfilingPolicySpec{}, true},
+		{"record strategy", ProfilingPolicySpec{RecordStrategy: RecordStrategyShadow}, true},
+		{"unknown record strategy", ProfilingPolicySpec{RecordStrategy: "sometimes"}, false},
+		{"open path patterns", ProfilingPolicySpec{OpenPathPatterns: []string{"/run/app/*"}}, true},
+		{"malformed open path pattern", ProfilingPolicySpec{OpenPathPatterns: []string{"/run/app/["}}, false},
+		{"event types", ProfilingPolicySpec{EventTypes: []string{"exec", "open"}}, true},
+		{"unknown event type", ProfilingPolicySpec{EventTypes: []string{"exec", "keyboard"}}, false},
+	}
+	for _, test := range tests {
+		if err := test.spec.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %t, got %v\n", test.name, test.valid, err)
+		}
+	}
+
+	// The event types are parsed once by the validation
+	spec := ProfilingPolicySpec{EventTypes: []string{"exec"}}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("error validating the policy: %s\n", err)
+	}
+	spec.EventTypes = []string{"keyboard"}
+	if settings := spec.Apply(RecordingSettings{}); !reflect.DeepEqual(settings.EventTypes, []tracing.EventType{tracing.ExecveEventType}) {
+		t.Errorf("expected the validated event types, got %v\n", settings.EventTypes)
+	}
+}
@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+	"golang.org/x/exp/slices"
+)
+
+func TestBuildContainerProfilePrivilegedOperations(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	id := &ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}
+	mount := &tracing.PrivilegedOperationEvent{
+		GeneralEvent: tracing.GeneralEvent{ProcessDetails: tracing.ProcessDetails{Comm: "mount"}},
+		Operation:    tracing.PrivilegedOperationMount,
+		Source:       "tmpfs",
+		Target:       "/mnt",
+		FsType:       "tmpfs",
+		ExePath:      "/bin/mount",
+	}
+	setuid := &tracing.PrivilegedOperationEvent{
+		GeneralEvent: tracing.GeneralEvent{ProcessDetails: tracing.ProcessDetails{Comm: "su"}},
+		Operation:    tracing.PrivilegedOperationSetuid,
+		TargetIds:    "65534,65534,-1",
+		ExePath:      "/bin/su",
+	}
+	unshare := &tracing.PrivilegedOperationEvent{
+		GeneralEvent: tracing.GeneralEvent{ProcessDetails: tracing.ProcessDetails{Comm: "unshare"}},
+		Operation:    tracing.PrivilegedOperationUnshare,
+		Namespaces:   "mnt,user",
+		ExePath:      "/usr/bin/unshare",
+	}
+	totalEvents := &TotalEvents{PrivilegedOperationEvents: []*tracing.PrivilegedOperationEvent{mount, setuid, mount, unshare}}
+	if !shouldProcessEvents(totalEvents) {
+		t.Fatalf("expected the privileged operations to be processed")
+	}
+
+	profile := cm.buildContainerProfile(id, &ContainerState{}, totalEvents)
+	expected := []PrivilegedOperationCalls{
+		{Operation: "mount", Source: "tmpfs", Target: "/mnt", FsType: "tmpfs", Comm: "mount", Exe: "/bin/mount"},
+		{Operation: "setuid", TargetIds: "65534,65534,-1", Comm: "su", Exe: "/bin/su"},
+		{Operation: "unshare", Namespaces: "mnt,user", Comm: "unshare", Exe: "/usr/bin/unshare"},
+	}
+	if !slices.Equal(profile.PrivilegedOperations, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, profile.PrivilegedOperations)
+	}
+
+	// Merging only adds the new operations
+	existing := &ApplicationProfile{Spec: ApplicationProfileSpec{Containers: []ContainerProfile{{
+		Name:                 "app",
+		PrivilegedOperations: []PrivilegedOperationCalls{expected[1]},
+	}}}}
+	merged, _ := cm.mergeApplicationProfiles(existing, &profile, id)
+	if privilegedOperations := merged.Spec.Containers[0].PrivilegedOperations; len(privilegedOperations) != 3 {
+		t.Errorf("expected 3 privileged operations, got %+v", privilegedOperations)
+	}
+
+	// Shadowed containers report the operations their baseline does not list, switching to other ids included
+	delta := subtractContainerProfile(profile, ContainerProfile{Name: "app", PrivilegedOperations: expected[1:]})
+	if !slices.Equal(delta.PrivilegedOperations, expected[:1]) {
+		t.Errorf("expected %+v, got %+v", expected[:1], delta.PrivilegedOperations)
+	}
+	setroot := PrivilegedOperationCalls{Operation: "setuid", TargetIds: "0,0,-1", Comm: "su", Exe: "/bin/su"}
+	delta = subtractContainerProfile(ContainerProfile{Name: "app", PrivilegedOperations: []PrivilegedOperationCalls{setroot}}, profile)
+	if expected := []PrivilegedOperationCalls{setroot}; !slices.Equal(delta.PrivilegedOperations, expected) {
+		t.Errorf("expected %+v, got %+v", expected, delta.PrivilegedOperations)
+	}
+}
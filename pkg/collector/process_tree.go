@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+)
+
+// Most processes remembered per container. Processes do not report their exit, so the tree starts over when it
+// gets this large.
+const maxProcessTreeSize = 4096
+
+// processTree keeps the executable every process of a container ran last, to find the parents of the execs.
+type processTree struct {
+	mutex       sync.Mutex
+	executables map[uint32]string
+}
+
+func newProcessTree() *processTree {
+	return &processTree{executables: map[uint32]string{}}
+}
+
+// addExecs adds the execs to the tree in the order they happened and returns the executable of the parent of each
+// of them. The parents that were not seen executing fall back to the executable the tracer found for them.
+func (tree *processTree) addExecs(events []*tracing.ExecveEvent) map[*tracing.ExecveEvent]string {
+	sorted := make([]*tracing.ExecveEvent, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+
+	if tree == nil {
+		tree = newProcessTree()
+	}
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	parents := make(map[*tracing.ExecveEvent]string, len(sorted))
+	for _, event := range sorted {
+		if parent, ok := tree.executables[event.Ppid]; ok {
+			parents[event] = parent
+		} else {
+			parents[event] = event.ParentPathName
+		}
+		if len(tree.executables) >= maxProcessTreeSize {
+			tree.executables = map[uint32]string{}
+		}
+		tree.executables[event.Pid] = event.PathName
+	}
+	return parents
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+)
+
+func execEvent(pid uint32, ppid uint32, path string, timestamp int64) *tracing.ExecveEvent {
+	return &tracing.ExecveEvent{
+		GeneralEvent: tracing.GeneralEvent{
+			ProcessDetails: tracing.ProcessDetails{Pid: pid, Ppid: ppid, Uid: 1000, Gid: 1000, Cwd: "/app"},
+			Timestamp:      timestamp,
+		},
+		PathName:       path,
+		ParentPathName: "/usr/bin/containerd-shim",
+	}
+}
+
+func TestProcessTree(t *testing.T) {
+	tree := newProcessTree()
+	entrypoint := execEvent(10, 1, "/usr/bin/entrypoint.sh", 1)
+	shell := execEvent(11, 10, "/bin/sh", 2)
+	// Out of order events are sorted by time
+	parents := tree.addExecs([]*tracing.ExecveEvent{shell, entrypoint})
+	if parents[entrypoint] != "/usr/bin/containerd-shim" {
+		t.Errorf("expected the parent found by the tracer, got %q", parents[entrypoint])
+	}
+	if parents[shell] != "/usr/bin/entrypoint.sh" {
+		t.Errorf("expected /usr/bin/entrypoint.sh, got %q", parents[shell])
+	}
+
+	// The processes are remembered across intervals
+	sleep := execEvent(12, 11, "/bin/sleep", 3)
+	if parents := tree.addExecs([]*tracing.ExecveEvent{sleep}); parents[sleep] != "/bin/sh" {
+		t.Errorf("expected /bin/sh, got %q", parents[sleep])
+	}
+}
+
+func TestBuildContainerProfileExecLineage(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	id := &ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}
+	state := &ContainerState{processes: newProcessTree()}
+	totalEvents := &TotalEvents{ExecEvents: []*tracing.ExecveEvent{
+		execEvent(10, 1, "/usr/bin/entrypoint.sh", 1),
+		execEvent(11, 10, "/bin/sh", 2),
+		execEvent(12, 1, "/bin/sh", 3),
+	}}
+
+	profile := cm.buildContainerProfile(id, state, totalEvents)
+	if len(profile.Execs) != 3 {
+		t.Fatalf("expected an exec per parent, got %v", profile.Execs)
+	}
+	exec := profile.Execs[1]
+	if exec.ParentPath != "/usr/bin/entrypoint.sh" || exec.Cwd != "/app" || exec.Uid == nil || *exec.Uid != 1000 || exec.Gid == nil || *exec.Gid != 1000 {
+		t.Errorf("unexpected lineage of %s: %+v", exec.Path, exec)
+	}
+	if profile.Execs[2].ParentPath != "/usr/bin/containerd-shim" {
+		t.Errorf("expected the parent found by the tracer, got %q", profile.Execs[2].ParentPath)
+	}
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"time"
+)
+
+const (
+	// Annotation recording why the profile was finalized
+	FinalizationReasonAnnotation = "kapprofiler.kubescape.io/finalization-reason"
+	// Finalized a fixed time after the pod became ready
+	FinalizationReasonTimer = "timer"
+	// Finalized after QuiescentIntervals collection intervals without new behaviour
+	FinalizationReasonQuiescence = "quiescence"
+	// Finalized after MaxLearningDuration even though new behaviour was still seen
+	FinalizationReasonMaxLearningDuration = "max-learning-duration"
+	// Finalized on request with the finalize-now annotation
+	FinalizationReasonManual = "manual"
+)
+
+type podLearningState struct {
+	// Time the first recorded container of the pod started
+	start time.Time
+	// Number of consecutive collection intervals without new behaviour
+	quietIntervals uint64
+}
+
+func (cm *CollectorManager) quiescenceEnabled() bool {
+	return cm.config.QuiescentIntervals > 0
+}
+
+// hasBehaviour checks if a container profile holds any behaviour entry
+func hasBehaviour(profile ContainerProfile) bool {
+	return len(profile.SysCalls) > 0 || len(profile.Execs) > 0 || len(profile.Opens) > 0 || len(profile.Dns) > 0 ||
+		len(profile.Capabilities) > 0 || len(profile.NetworkActivity.Incoming) > 0 || len(profile.NetworkActivity.Outgoing) > 0 ||
+		len(profile.FileOperations) > 0 || len(profile.ListeningPorts) > 0 || len(profile.TcpConnections) > 0 ||
+		len(profile.PrivilegedOperations) > 0 || len(profile.Signals) > 0
+}
+
+// startLearningState starts the learning period of a pod when its first container starts, the maximum learning
+// duration is measured from then. Must be called with containersMutex held.
+func (cm *CollectorManager) startLearningState(podKey string, now time.Time) {
+	if _, ok := cm.podLearningStates[podKey]; !ok {
+		cm.podLearningStates[podKey] = &podLearningState{start: now}
+	}
+}
+
+// updateLearningState records the result of a collection interval of a pod and returns the reason to finalize
+// its profile, or an empty string if the pod is still learning. Must be called with containersMutex held.
+func (cm *CollectorManager) updateLearningState(podKey string, newBehaviour bool, maxLearningDuration time.Duration, now time.Time) string {
+	cm.startLearningState(podKey, now)
+	state := cm.podLearningStates[podKey]
+
+	if newBehaviour {
+		state.quietIntervals = 0
+	} else {
+		state.quietIntervals++
+	}
+
+	if cm.quiescenceEnabled() && state.quietIntervals >= cm.config.QuiescentIntervals {
+		return FinalizationReasonQuiescence
+	}
+	if maxLearningDuration > 0 && now.Sub(state.start) >= maxLearningDuration {
+		return FinalizationReasonMaxLearningDuration
+	}
+	return ""
+}
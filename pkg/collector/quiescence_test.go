@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUpdateLearningStateQuiescence(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	cm.config.QuiescentIntervals = 2
+
+	now := time.Now()
+	if reason := cm.updateLearningState("nginx-default", true, 0, now); reason != "" {
+		t.Errorf("expected no finalization, got %s\n", reason)
+	}
+	if reason := cm.updateLearningState("nginx-default", false, 0, now); reason != "" {
+		t.Errorf("expected no finalization after one quiet interval, got %s\n", reason)
+	}
+	// New behaviour resets the count
+	if reason := cm.updateLearningState("nginx-default", true, 0, now); reason != "" {
+		t.Errorf("expected no finalization, got %s\n", reason)
+	}
+	cm.updateLearningState("nginx-default", false, 0, now)
+	if reason := cm.updateLearningState("nginx-default", false, 0, now); reason != FinalizationReasonQuiescence {
+		t.Errorf("expected %s, got %q\n", FinalizationReasonQuiescence, reason)
+	}
+}
+
+func TestUpdateLearningStateMaxLearningDuration(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	cm.config.QuiescentIntervals = 100
+
+	start := time.Now()
+	if reason := cm.updateLearningState("nginx-default", true, 10*time.Minute, start); reason != "" {
+		t.Errorf("expected no finalization, got %s\n", reason)
+	}
+	if reason := cm.updateLearningState("nginx-default", true, 10*time.Minute, start.Add(10*time.Minute)); reason != FinalizationReasonMaxLearningDuration {
+		t.Errorf("expected %s, got %q\n", FinalizationReasonMaxLearningDuration, reason)
+	}
+}
+
+func TestStorePodProfileNewBehaviour(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	recording := func(syscalls ...string) []containerRecording {
+		return []containerRecording{{
+			id:      ContainerId{Namespace: "default", PodName: "nginx", Container: "app"},
+			state:   &ContainerState{},
+			profile: ContainerProfile{Name: "app", SysCalls: syscalls},
+		}}
+	}
+
+	for i, step := range []struct {
+		syscalls     []string
+		newBehaviour bool
+	}{
+		{[]string{"open"}, true},
+		{[]string{"open"}, false},
+		{[]string{"open", "read"}, true},
+	} {
+		newBehaviour, err := cm.storePodProfile(context.Background(), "default", "pod-nginx", recording(step.syscalls...))
+		if err != nil {
+			t.Fatalf("error storing pod profile: %s\n", err)
+		}
+		if newBehaviour != step.newBehaviour {
+			t.Errorf("step %d: expected new behaviour %t, got %t\n", i, step.newBehaviour, newBehaviour)
+		}
+	}
+}
+
+func TestUpdateLearningStateStartsAtContainerStart(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	cm.config.QuiescentIntervals = 100
+
+	start := time.Now()
+	cm.startLearningState("nginx-default", start)
+	// The first flush happens after the container started, the learning period is counted from the start
+	if reason := cm.updateLearningState("nginx-default", true, 10*time.Minute, start.Add(10*time.Minute)); reason != FinalizationReasonMaxLearningDuration {
+		t.Errorf("expected %s, got %q\n", FinalizationReasonMaxLearningDuration, reason)
+	}
+}
+
+func TestMergeApplicationProfilesNewBehaviour(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	cm.config.GeneralizeOpenPaths = true
+	id := &ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}
+	existing := &ApplicationProfile{Spec: ApplicationProfileSpec{Containers: []ContainerProfile{{Name: "app", Opens: []OpenCalls{
+		{Path: "/proc/*/status", Flags: []string{"O_RDONLY"}},
+	}}}}}
+
+	// An open folded into an entry of the profile is not new behaviour
+	_, newBehaviour := cm.mergeApplicationProfiles(existing, &ContainerProfile{Name: "app", Opens: []OpenCalls{
+		{Path: "/proc/3/status", Flags: []string{"O_RDONLY"}},
+	}}, id)
+	if newBehaviour {
+		t.Errorf("expected no new behaviour for an open covered by the profile\n")
+	}
+
+	// A new open is new behaviour, even when folded with the existing entries
+	merged, newBehaviour := cm.mergeApplicationProfiles(existing, &ContainerProfile{Name: "app", Opens: []OpenCalls{
+		{Path: "/proc/4/status", Flags: []string{"O_RDWR"}},
+	}}, id)
+	if !newBehaviour {
+		t.Errorf("expected new behaviour for an open with new flags, got %+v\n", merged.Spec.Containers[0].Opens)
+	}
+}
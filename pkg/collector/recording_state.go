@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+)
+
+// Containers of the profile that were recorded from their start, as a JSON map of container name to container ID.
+// A restarted agent uses it to resume the recording of a container without marking the profile partial.
+const RecordedFromStartAnnotation = "kapprofiler.kubescape.io/recorded-from-start"
+
+func getRecordedFromStart(profile *ApplicationProfile) map[string]string {
+	recordedFromStart := map[string]string{}
+	raw, ok := profile.GetAnnotations()[RecordedFromStartAnnotation]
+	if !ok {
+		return recordedFromStart
+	}
+	if err := json.Unmarshal([]byte(raw), &recordedFromStart); err != nil {
+		log.Printf("error parsing %s annotation of application profile %s: %s\n", RecordedFromStartAnnotation, profile.GetName(), err)
+		return map[string]string{}
+	}
+	return recordedFromStart
+}
+
+// setRecordedFromStart records the containers that were seen from their start in the profile annotations.
+func setRecordedFromStart(profile *ApplicationProfile, recordings []containerRecording) error {
+	recordedFromStart := getRecordedFromStart(profile)
+	changed := false
+	for _, recording := range recordings {
+		if recording.state.attached || recording.id.ContainerID == "" {
+			continue
+		}
+		if recordedFromStart[recording.id.Container] != recording.id.ContainerID {
+			recordedFromStart[recording.id.Container] = recording.id.ContainerID
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	raw, err := json.Marshal(recordedFromStart)
+	if err != nil {
+		return err
+	}
+	if profile.Annotations == nil {
+		profile.Annotations = map[string]string{}
+	}
+	profile.Annotations[RecordedFromStartAnnotation] = string(raw)
+	return nil
+}
+
+// wasRecordedFromStart checks if a previous instance of the agent recorded the container from its start.
+func (cm *CollectorManager) wasRecordedFromStart(id *ContainerId) bool {
+	if id.ContainerID == "" {
+		return false
+	}
+
+	storeNamespace := id.Namespace
+	if cm.config.StoreNamespace != "" {
+		storeNamespace = cm.config.StoreNamespace
+	}
+	profile, err := GetApplicationProfile(context.Background(), cm.dynamicClient, storeNamespace, cm.GetApplicationProfileName(id.Namespace, "pod", id.PodName))
+	if err != nil {
+		return false
+	}
+
+	return getRecordedFromStart(profile)[id.Container] == id.ContainerID
+}
@@ -0,0 +1,32 @@
+package collector
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRecordedFromStart(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+
+	app := ContainerId{Namespace: "default", PodName: "nginx", Container: "app", ContainerID: "containerd://app"}
+	sidecar := ContainerId{Namespace: "default", PodName: "nginx", Container: "sidecar", ContainerID: "containerd://sidecar"}
+	_, err := cm.storePodProfile(context.Background(), "default", "pod-nginx", []containerRecording{
+		{id: app, state: &ContainerState{}, profile: ContainerProfile{Name: "app"}},
+		{id: sidecar, state: &ContainerState{attached: true}, profile: ContainerProfile{Name: "sidecar"}},
+	})
+	if err != nil {
+		t.Fatalf("error storing pod profile: %s\n", err)
+	}
+
+	if !cm.wasRecordedFromStart(&app) {
+		t.Errorf("expected the app container to be recorded from its start\n")
+	}
+	if cm.wasRecordedFromStart(&sidecar) {
+		t.Errorf("expected the attached sidecar container not to be recorded from its start\n")
+	}
+	restarted := app
+	restarted.ContainerID = "containerd://app-restarted"
+	if cm.wasRecordedFromStart(&restarted) {
+		t.Errorf("expected a restarted container not to be recorded from its start\n")
+	}
+}
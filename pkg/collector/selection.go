@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+	"github.com/kubescape/kapprofiler/pkg/watcher"
+
+	"golang.org/x/exp/slices"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Set to "false" on a pod or a namespace to opt out of recording.
+	RecordAnnotation = "kapprofiler.kubescape.io/record"
+	// Comma separated event types to trace in the containers of a pod, for example "exec,network".
+	EventTypesAnnotation = "kapprofiler.kubescape.io/event-types"
+)
+
+// recordingAllowed checks the recording opt-outs and the selectors of the configuration against a pod and its namespace.
+func (cm *CollectorManager) recordingAllowed(namespace *v1.Namespace, pod *v1.Pod) bool {
+	if namespace != nil {
+		if namespace.GetAnnotations()[RecordAnnotation] == "false" {
+			return false
+		}
+		if cm.config.NamespaceSelector != nil && !cm.config.NamespaceSelector.Matches(labels.Set(namespace.GetLabels())) {
+			return false
+		}
+	}
+	if pod != nil {
+		if pod.GetAnnotations()[RecordAnnotation] == "false" {
+			return false
+		}
+		if cm.config.PodSelector != nil && !cm.config.PodSelector.Matches(labels.Set(pod.GetLabels())) {
+			return false
+		}
+	}
+	return true
+}
+
+// getPod returns a pod of the node as last seen by the pod watcher, or from the API server if the watcher did not
+// see it yet.
+func (cm *CollectorManager) getPod(namespace string, name string) (*v1.Pod, error) {
+	if pod, ok := cm.pods.get(namespace, name); ok {
+		return pod, nil
+	}
+	return cm.k8sClient.CoreV1().Pods(namespace).Get(context.Background(), name, metav1.GetOptions{})
+}
+
+// getNamespace returns a namespace as last seen by the namespace watcher, or from the API server if the watcher did
+// not see it yet.
+func (cm *CollectorManager) getNamespace(name string) (*v1.Namespace, error) {
+	if namespace, ok := cm.namespaces.get("", name); ok {
+		return namespace, nil
+	}
+	return cm.k8sClient.CoreV1().Namespaces().Get(context.Background(), name, metav1.GetOptions{})
+}
+
+// shouldRecordContainer checks if the container has to be traced and returns its pod. Containers whose pod or
+// namespace cannot be checked are not recorded, as they may have opted out.
+func (cm *CollectorManager) shouldRecordContainer(id *ContainerId) (*v1.Pod, bool) {
+	namespace, err := cm.getNamespace(id.Namespace)
+	if err != nil {
+		log.Printf("not recording container %s of pod %s/%s, error getting its namespace: %s\n", id.Container, id.Namespace, id.PodName, err)
+		return nil, false
+	}
+	pod, err := cm.getPod(id.Namespace, id.PodName)
+	if err != nil {
+		log.Printf("not recording container %s of pod %s/%s, error getting its pod: %s\n", id.Container, id.Namespace, id.PodName, err)
+		return nil, false
+	}
+	return pod, cm.recordingAllowed(namespace, pod)
+}
+
+func (cm *CollectorManager) StartNamespaceWatcher() {
+	cm.namespaceWatcher = watcher.NewWatcher(cm.dynamicClient, false)
+
+	setNamespace := func(obj *unstructured.Unstructured) {
+		namespace := &v1.Namespace{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, namespace); err != nil {
+			log.Printf("the object is not a Namespace %v", err)
+			return
+		}
+		cm.namespaces.set(namespace)
+	}
+	err := cm.namespaceWatcher.Start(watcher.WatchNotifyFunctions{
+		AddFunc:    setNamespace,
+		UpdateFunc: setNamespace,
+		DeleteFunc: func(obj *unstructured.Unstructured) {
+			cm.namespaces.delete("", obj.GetName())
+		},
+	}, schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}, metav1.ListOptions{})
+
+	if err != nil {
+		// The namespaces are fetched from the API server when the containers start
+		log.Printf("Error starting Namespace watcher: %v", err)
+		cm.namespaceWatcher = nil
+	}
+}
+
+func (cm *CollectorManager) StopNamespaceWatcher() {
+	if cm.namespaceWatcher != nil {
+		cm.namespaceWatcher.Stop()
+	}
+}
+
+// ParseEventTypes parses the names of the event types traced per container, "all" stands for all of them.
+func ParseEventTypes(names []string) ([]tracing.EventType, error) {
+	eventTypes := []tracing.EventType{}
+	for _, name := range names {
+		eventType, err := tracing.ParseEventType(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		if eventType == tracing.AllEventType {
+			return tracing.ContainerEventTypes, nil
+		}
+		if !slices.Contains(tracing.ContainerEventTypes, eventType) {
+			return nil, fmt.Errorf("event type %s is not traced per container", eventType)
+		}
+		if !slices.Contains(eventTypes, eventType) {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	return eventTypes, nil
+}
+
+// getEventTypes returns the event types to trace in a container. The annotation of the pod applies first, then the
+// recording settings of the namespace, and the default event types are traced if none of them sets any.
+func (cm *CollectorManager) getEventTypes(namespace string, pod *v1.Pod) []tracing.EventType {
+	if pod != nil {
+		if raw, ok := pod.GetAnnotations()[EventTypesAnnotation]; ok {
+			eventTypes, err := ParseEventTypes(strings.Split(raw, ","))
+			if err == nil {
+				return eventTypes
+			}
+			log.Printf("invalid %s annotation on pod %s/%s: %s\n", EventTypesAnnotation, pod.GetNamespace(), pod.GetName(), err)
+		}
+	}
+	if eventTypes := cm.getRecordingSettings(namespace).EventTypes; eventTypes != nil {
+		return eventTypes
+	}
+	return tracing.DefaultEventTypes
+}
+
+// getEventTypeNames returns the categories collected for a container, the syscalls are always collected.
+func getEventTypeNames(eventTypes []tracing.EventType) []string {
+	names := []string{tracing.SyscallEventType.String()}
+	for _, eventType := range eventTypes {
+		names = append(names, eventType.String())
+	}
+	sort.Strings(names)
+	return names
+}
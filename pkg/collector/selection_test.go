@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+
+	"golang.org/x/exp/slices"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecordingAllowed(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	namespace := func(name string, annotations map[string]string) *v1.Namespace {
+		return &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"kubernetes.io/metadata.name": name}, Annotations: annotations}}
+	}
+	pod := func(podLabels map[string]string, annotations map[string]string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Labels: podLabels, Annotations: annotations}}
+	}
+
+	if !cm.recordingAllowed(namespace("default", nil), pod(nil, nil)) {
+		t.Errorf("expected recording to be allowed without selectors\n")
+	}
+	if cm.recordingAllowed(namespace("default", nil), pod(nil, map[string]string{RecordAnnotation: "false"})) {
+		t.Errorf("expected the pod annotation to opt out of recording\n")
+	}
+	if cm.recordingAllowed(namespace("default", map[string]string{RecordAnnotation: "false"}), pod(nil, nil)) {
+		t.Errorf("expected the namespace annotation to opt out of recording\n")
+	}
+
+	namespaceSelector, err := labels.Parse("kubernetes.io/metadata.name notin (kube-system,kubescape)")
+	if err != nil {
+		t.Fatalf("error parsing selector: %s\n", err)
+	}
+	podSelector, err := labels.Parse("app=nginx")
+	if err != nil {
+		t.Fatalf("error parsing selector: %s\n", err)
+	}
+	cm.config.NamespaceSelector = namespaceSelector
+	cm.config.PodSelector = podSelector
+	if cm.recordingAllowed(namespace("kube-system", nil), pod(map[string]string{"app": "nginx"}, nil)) {
+		t.Errorf("expected the namespace selector to exclude kube-system\n")
+	}
+	if cm.recordingAllowed(namespace("default", nil), pod(map[string]string{"app": "redis"}, nil)) {
+		t.Errorf("expected the pod selector to exclude the redis pod\n")
+	}
+	if !cm.recordingAllowed(namespace("default", nil), pod(map[string]string{"app": "nginx"}, nil)) {
+		t.Errorf("expected the nginx pod to be recorded\n")
+	}
+}
+
+func TestGetEventTypes(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	cm.policies = newPolicyCache()
+
+	if eventTypes := cm.getEventTypes("default", nil); !slices.Equal(eventTypes, tracing.DefaultEventTypes) {
+		t.Errorf("expected the default event types, got %v\n", eventTypes)
+	}
+
+	cm.config.EventTypes = []tracing.EventType{tracing.ExecveEventType}
+	if eventTypes := cm.getEventTypes("default", nil); !slices.Equal(eventTypes, []tracing.EventType{tracing.ExecveEventType}) {
+		t.Errorf("expected the configured event types, got %v\n", eventTypes)
+	}
+
+	policy := &ProfilingPolicy{ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: "default"}, Spec: ProfilingPolicySpec{EventTypes: []string{"dns", "network"}}}
+	if err := policy.Spec.Validate(); err != nil {
+		t.Fatalf("error validating the policy: %s\n", err)
+	}
+	cm.policies.set(policy)
+	if eventTypes := cm.getEventTypes("default", nil); !slices.Equal(eventTypes, []tracing.EventType{tracing.DnsEventType, tracing.NetworkEventType}) {
+		t.Errorf("expected the event types of the policy, got %v\n", eventTypes)
+	}
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Annotations: map[string]string{EventTypesAnnotation: "open, exec"}}}
+	if eventTypes := cm.getEventTypes("default", pod); !slices.Equal(eventTypes, []tracing.EventType{tracing.OpenEventType, tracing.ExecveEventType}) {
+		t.Errorf("expected the event types of the pod annotation, got %v\n", eventTypes)
+	}
+
+	// An invalid annotation falls back to the policy
+	pod.Annotations[EventTypesAnnotation] = "exec,syscall"
+	if eventTypes := cm.getEventTypes("default", pod); !slices.Equal(eventTypes, []tracing.EventType{tracing.DnsEventType, tracing.NetworkEventType}) {
+		t.Errorf("expected the event types of the policy, got %v\n", eventTypes)
+	}
+
+	if names := getEventTypeNames([]tracing.EventType{tracing.NetworkEventType, tracing.ExecveEventType}); !slices.Equal(names, []string{"exec", "network", "syscall"}) {
+		t.Errorf("unexpected event type names %v\n", names)
+	}
+}
+
+func TestShouldRecordContainer(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	cm := newTestCollectorManager(newTestDynamicClient())
+	cm.k8sClient = client
+	id := &ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}
+
+	// The selection cannot be decided without the pod, the container may have opted out
+	if _, record := cm.shouldRecordContainer(id); record {
+		t.Errorf("expected the container not to be recorded when its pod cannot be fetched\n")
+	}
+
+	// The pods and namespaces seen by the watchers are not fetched again
+	cm.namespaces.set(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+	cm.pods.set(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"}})
+	client.ClearActions()
+	pod, record := cm.shouldRecordContainer(id)
+	if !record || pod == nil || pod.Name != "nginx" {
+		t.Errorf("expected the container to be recorded with its pod, got %t %v\n", record, pod)
+	}
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("expected the cached pod and namespace to be used, got %d requests\n", len(actions))
+	}
+
+	cm.pods.set(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Annotations: map[string]string{RecordAnnotation: "false"}}})
+	if _, record := cm.shouldRecordContainer(id); record {
+		t.Errorf("expected the opt-out of the cached pod to apply\n")
+	}
+}
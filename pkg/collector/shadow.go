@@ -0,0 +1,185 @@
+package collector
+
+import (
+	"context"
+
+	"golang.org/x/exp/slices"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// Set on the profiles that hold the behaviour seen after their baseline profile was finalized
+	DeltaLabel = "kapprofiler.kubescape.io/delta"
+	// Name of the final profile a delta profile extends
+	DeltaOfAnnotation = "kapprofiler.kubescape.io/delta-of"
+)
+
+// deltaApplicationProfileName returns the name of the delta profile of a final profile. Profile names start with
+// the kind of their workload, so the prefix cannot collide with them.
+func deltaApplicationProfileName(baseline string) string {
+	return shortenName("delta-"+baseline, maxObjectNameLength)
+}
+
+// subtractContainerProfile returns the behaviour of a container profile that is not in the baseline profile of
+// the container. DNS entries are compared by name only, so that rotating addresses do not show up as new behaviour,
+// and the execs, opens and file operations matching a template or a generalized path of the baseline are known.
+func subtractContainerProfile(profile ContainerProfile, baseline ContainerProfile) ContainerProfile {
+	delta := ContainerProfile{
+		Name:        profile.Name,
+		ImageDigest: profile.ImageDigest,
+		EventTypes:  profile.EventTypes,
+	}
+	for _, syscall := range profile.SysCalls {
+		if !slices.Contains(baseline.SysCalls, syscall) {
+			delta.SysCalls = append(delta.SysCalls, syscall)
+		}
+	}
+	for _, exec := range profile.Execs {
+		if !slices.ContainsFunc(baseline.Execs, func(b ExecCalls) bool { return execCovers(b, exec) }) {
+			delta.Execs = append(delta.Execs, exec)
+		}
+	}
+	for _, open := range profile.Opens {
+		index := slices.IndexFunc(baseline.Opens, func(b OpenCalls) bool { return openCovers(b, open) })
+		if index == -1 {
+			delta.Opens = append(delta.Opens, open)
+			continue
+		}
+		// A known file opened by another executable is new behaviour too
+		newExecutables := []OpenExecutable{}
+		for _, executable := range open.Executables {
+			if !slices.Contains(baseline.Opens[index].Executables, executable) {
+				newExecutables = append(newExecutables, executable)
+			}
+		}
+		if len(newExecutables) > 0 {
+			delta.Opens = append(delta.Opens, OpenCalls{Path: open.Path, Flags: open.Flags, Executables: newExecutables})
+		}
+	}
+	for _, dns := range profile.Dns {
+		if !slices.ContainsFunc(baseline.Dns, func(b DnsCalls) bool { return b.DnsName == dns.DnsName }) {
+			delta.Dns = append(delta.Dns, dns)
+		}
+	}
+	for _, capability := range profile.Capabilities {
+		known := []string{}
+		for _, baselineCapability := range baseline.Capabilities {
+			if baselineCapability.Syscall == capability.Syscall {
+				known = baselineCapability.Capabilities
+				break
+			}
+		}
+		newCapabilities := []string{}
+		for _, cap := range capability.Capabilities {
+			if !slices.Contains(known, cap) {
+				newCapabilities = append(newCapabilities, cap)
+			}
+		}
+		if len(newCapabilities) > 0 {
+			delta.Capabilities = append(delta.Capabilities, CapabilitiesCalls{Syscall: capability.Syscall, Capabilities: newCapabilities})
+		}
+	}
+	for _, incoming := range profile.NetworkActivity.Incoming {
+		if !slices.ContainsFunc(baseline.NetworkActivity.Incoming, incoming.Equals) {
+			delta.NetworkActivity.Incoming = append(delta.NetworkActivity.Incoming, incoming)
+		}
+	}
+	for _, outgoing := range profile.NetworkActivity.Outgoing {
+		if !slices.ContainsFunc(baseline.NetworkActivity.Outgoing, outgoing.Equals) {
+			delta.NetworkActivity.Outgoing = append(delta.NetworkActivity.Outgoing, outgoing)
+		}
+	}
+	for _, fileOperation := range profile.FileOperations {
+		if !slices.ContainsFunc(baseline.FileOperations, func(b FileOperationCalls) bool { return fileOperationCovers(b, fileOperation) }) {
+			delta.FileOperations = append(delta.FileOperations, fileOperation)
+		}
+	}
+	for _, listeningPort := range profile.ListeningPorts {
+		if !slices.ContainsFunc(baseline.ListeningPorts, listeningPort.Equals) {
+			delta.ListeningPorts = append(delta.ListeningPorts, listeningPort)
+		}
+	}
+	for _, tcpConnection := range profile.TcpConnections {
+		if !slices.ContainsFunc(baseline.TcpConnections, tcpConnection.Equals) {
+			delta.TcpConnections = append(delta.TcpConnections, tcpConnection)
+		}
+	}
+	for _, privilegedOperation := range profile.PrivilegedOperations {
+		if !slices.ContainsFunc(baseline.PrivilegedOperations, privilegedOperation.Equals) {
+			delta.PrivilegedOperations = append(delta.PrivilegedOperations, privilegedOperation)
+		}
+	}
+	for _, signal := range profile.Signals {
+		if !slices.ContainsFunc(baseline.Signals, signal.Equals) {
+			delta.Signals = append(delta.Signals, signal)
+		}
+	}
+	return delta
+}
+
+// storeDeltaProfile merges the behaviour of the shadowed containers that is not in their final profile into the
+// delta profile of the final profile.
+func (cm *CollectorManager) storeDeltaProfile(ctx context.Context, namespace string, baseline string, recordings []containerRecording) error {
+	baselineProfile, err := GetApplicationProfile(ctx, cm.dynamicClient, namespace, baseline)
+	if err != nil {
+		return err
+	}
+
+	deltas := []containerRecording{}
+	for _, recording := range recordings {
+		baselineContainer := ContainerProfile{}
+		for _, container := range baselineProfile.Spec.Containers {
+			if container.Name == recording.profile.Name {
+				baselineContainer = container
+				break
+			}
+		}
+		recording.profile = subtractContainerProfile(recording.profile, baselineContainer)
+		if hasBehaviour(recording.profile) {
+			deltas = append(deltas, recording)
+		}
+	}
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	deltaName := deltaApplicationProfileName(baseline)
+	return retry.OnError(retry.DefaultBackoff, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		existingDelta, err := GetApplicationProfile(ctx, cm.dynamicClient, namespace, deltaName)
+		if apierrors.IsNotFound(err) {
+			delta := &ApplicationProfile{
+				TypeMeta: v1.TypeMeta{
+					Kind:       ApplicationProfileKind,
+					APIVersion: ApplicationProfileApiVersion,
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:        deltaName,
+					Labels:      map[string]string{DeltaLabel: "true"},
+					Annotations: map[string]string{DeltaOfAnnotation: baseline},
+				},
+			}
+			// The delta belongs to the workload of its final profile
+			if kind, ok := baselineProfile.Labels[WorkloadKindLabel]; ok {
+				SetApplicationProfileWorkload(delta, kind, baselineProfile.Annotations[WorkloadNameAnnotation], baselineProfile.Labels[WorkloadNamespaceLabel], baselineProfile.Labels[WorkloadUIDLabel])
+			} else if cm.config.StoreNamespace != "" {
+				delta.Labels[WorkloadNamespaceLabel] = deltas[0].id.Namespace
+			}
+			for _, recording := range deltas {
+				delta.Spec.Containers = append(delta.Spec.Containers, recording.profile)
+			}
+			return CreateApplicationProfile(ctx, cm.dynamicClient, namespace, delta)
+		} else if err != nil {
+			return err
+		}
+
+		for i := range deltas {
+			existingDelta, _ = cm.mergeApplicationProfiles(existingDelta, &deltas[i].profile, &deltas[i].id)
+		}
+		return UpdateApplicationProfile(ctx, cm.dynamicClient, namespace, existingDelta)
+	})
+}
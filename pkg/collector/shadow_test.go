@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/eventsink"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSubtractContainerProfile(t *testing.T) {
+	baseline := ContainerProfile{
+		Name:         "app",
+		SysCalls:     []string{"open"},
+		Execs:        []ExecCalls{{Path: "/bin/server", Args: []string{"--port", "8080"}}},
+		Dns:          []DnsCalls{{DnsName: "db.default.svc.cluster.local.", Addresses: []string{"10.0.0.1"}}},
+		Capabilities: []CapabilitiesCalls{{Syscall: "setuid", Capabilities: []string{"SETUID"}}},
+		Opens:        []OpenCalls{{Path: "/etc/hosts", Flags: []string{"O_RDONLY"}, Executables: []OpenExecutable{{Comm: "server"}}}},
+	}
+	profile := ContainerProfile{
+		Name:         "app",
+		SysCalls:     []string{"open", "close"},
+		Execs:        []ExecCalls{{Path: "/bin/server", Args: []string{"--port", "8080"}}, {Path: "/bin/sh"}},
+		Dns:          []DnsCalls{{DnsName: "db.default.svc.cluster.local.", Addresses: []string{"10.0.0.2"}}},
+		Capabilities: []CapabilitiesCalls{{Syscall: "setuid", Capabilities: []string{"SETUID", "SETGID"}}},
+		Opens: []OpenCalls{
+			{Path: "/etc/hosts", Flags: []string{"O_RDONLY"}, Executables: []OpenExecutable{{Comm: "server"}, {Comm: "sh"}}},
+			{Path: "/etc/shadow", Flags: []string{"O_RDONLY"}},
+		},
+	}
+
+	expected := ContainerProfile{
+		Name:         "app",
+		SysCalls:     []string{"close"},
+		Execs:        []ExecCalls{{Path: "/bin/sh"}},
+		Capabilities: []CapabilitiesCalls{{Syscall: "setuid", Capabilities: []string{"SETGID"}}},
+		Opens: []OpenCalls{
+			{Path: "/etc/hosts", Flags: []string{"O_RDONLY"}, Executables: []OpenExecutable{{Comm: "sh"}}},
+			{Path: "/etc/shadow", Flags: []string{"O_RDONLY"}},
+		},
+	}
+	if delta := subtractContainerProfile(profile, baseline); !reflect.DeepEqual(delta, expected) {
+		t.Errorf("unexpected delta %+v\n", delta)
+	}
+}
+
+func TestFlushShadowedContainers(t *testing.T) {
+	client := newTestDynamicClient()
+	cm := newTestCollectorManager(client)
+	eventSink, err := eventsink.NewEventSink("", false)
+	if err != nil {
+		t.Fatalf("error creating event sink: %s\n", err)
+	}
+	if err := eventSink.Start(); err != nil {
+		t.Fatalf("error starting event sink: %s\n", err)
+	}
+	defer eventSink.Stop()
+	cm.eventSink = eventSink
+
+	err = CreateApplicationProfile(context.Background(), client, "default", &ApplicationProfile{
+		TypeMeta: v1.TypeMeta{
+			Kind:       ApplicationProfileKind,
+			APIVersion: ApplicationProfileApiVersion,
+		},
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "deployment-nginx",
+			Labels: map[string]string{"kapprofiler.kubescape.io/final": "true"},
+		},
+		Spec: ApplicationProfileSpec{
+			Containers: []ContainerProfile{{Name: "app", SysCalls: []string{"open"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating application profile: %s\n", err)
+	}
+
+	id := ContainerId{Namespace: "default", PodName: "nginx-5d8f9", Container: "app", NsMntId: 1}
+	containers := map[ContainerId]*ContainerState{id: {running: true, baseline: "deployment-nginx"}}
+	if cm.flushContainers(context.Background(), id.PodName, id.Namespace, containers) {
+		t.Errorf("expected shadowed containers not to count as new behaviour\n")
+	}
+
+	delta, err := GetApplicationProfile(context.Background(), client, "default", "delta-deployment-nginx")
+	if err != nil {
+		t.Fatalf("error getting delta application profile: %s\n", err)
+	}
+	if delta.Labels[DeltaLabel] != "true" || delta.Annotations[DeltaOfAnnotation] != "deployment-nginx" {
+		t.Errorf("expected the delta to be marked, got labels %v and annotations %v\n", delta.Labels, delta.Annotations)
+	}
+	if len(delta.Spec.Containers) != 1 || !reflect.DeepEqual(delta.Spec.Containers[0].SysCalls, []string{"close"}) {
+		t.Errorf("expected only the close syscall in the delta, got %+v\n", delta.Spec.Containers)
+	}
+
+	baseline, err := GetApplicationProfile(context.Background(), client, "default", "deployment-nginx")
+	if err != nil {
+		t.Fatalf("error getting application profile: %s\n", err)
+	}
+	if !reflect.DeepEqual(baseline.Spec.Containers[0].SysCalls, []string{"open"}) {
+		t.Errorf("expected the final profile to be unchanged, got %+v\n", baseline.Spec.Containers)
+	}
+	if _, err := GetApplicationProfile(context.Background(), client, "default", "pod-nginx-5d8f9"); !apierrors.IsNotFound(err) {
+		t.Errorf("expected no pod profile for a shadowed container, got %v\n", err)
+	}
+}
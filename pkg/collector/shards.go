@@ -0,0 +1,410 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// Serialized size above which a profile is split into shards, etcd rejects objects over ~1.5MiB.
+	MaxApplicationProfileSize = 1024 * 1024
+	// Number of shards holding the rest of the profile, set on the main object.
+	ShardsAnnotation = "kapprofiler.kubescape.io/shards"
+	// Generation of the shards of the main object, part of the names of its shards. Every write of a sharded profile
+	// writes a new generation, the shards of the previous one are only deleted once the main object points to it.
+	ShardGenerationAnnotation = "kapprofiler.kubescape.io/shard-generation"
+	// Name of the main object, set on every shard.
+	ShardOfAnnotation = "kapprofiler.kubescape.io/shard-of"
+	// Marks an object as a shard of another profile.
+	ShardLabel = "kapprofiler.kubescape.io/shard"
+)
+
+// GetApplicationProfileShardName returns the name of a shard of a generation, the profiles sharded before the
+// generations were introduced have no generation. The names of the shards start with "shard." while the names of
+// the profiles start with the kind of their workload followed by a dash, so they never collide.
+func GetApplicationProfileShardName(name string, generation string, index int) string {
+	if generation == "" {
+		return shortenName(fmt.Sprintf("%s-shard-%d", name, index), maxObjectNameLength)
+	}
+	return shortenName(fmt.Sprintf("shard.%s.%s.%d", name, generation, index), maxObjectNameLength)
+}
+
+// applicationProfileShardOwner returns the owner references of the shards of a main object, none if the main object
+// was not created yet.
+func applicationProfileShardOwner(main *ApplicationProfile) []v1.OwnerReference {
+	if main.UID == "" {
+		return nil
+	}
+	return []v1.OwnerReference{{
+		APIVersion: ApplicationProfileApiVersion,
+		Kind:       ApplicationProfileKind,
+		Name:       main.Name,
+		UID:        main.UID,
+	}}
+}
+
+func estimateSize(obj interface{}) int {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return 0
+	}
+	return len(raw) + 1
+}
+
+func getShardCount(profile *ApplicationProfile) int {
+	count, err := strconv.Atoi(profile.GetAnnotations()[ShardsAnnotation])
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+func getShardGeneration(profile *ApplicationProfile) string {
+	return profile.GetAnnotations()[ShardGenerationAnnotation]
+}
+
+// newShardGeneration returns a generation for the shards of a write, unique so that concurrent writers of the same
+// profile never write to the shards of each other
+func newShardGeneration() string {
+	return utilrand.String(5)
+}
+
+// splitApplicationProfileSpec splits the spec into specs whose serialized size is about maxSize or less.
+func splitApplicationProfileSpec(spec ApplicationProfileSpec, maxSize int) []ApplicationProfileSpec {
+	shards := []ApplicationProfileSpec{{}}
+	currentSize := 0
+
+	currentContainer := func() *ContainerProfile {
+		shard := &shards[len(shards)-1]
+		return &shard.Containers[len(shard.Containers)-1]
+	}
+	// Every shard of a container repeats its identity
+	startContainer := func(container *ContainerProfile) {
+		shard := &shards[len(shards)-1]
+		header := ContainerProfile{Name: container.Name, ImageDigest: container.ImageDigest}
+		shard.Containers = append(shard.Containers, header)
+		currentSize += estimateSize(header)
+	}
+	addEntry := func(container *ContainerProfile, entry interface{}, appendEntry func(container *ContainerProfile)) {
+		entrySize := estimateSize(entry)
+		if currentSize > 0 && currentSize+entrySize > maxSize {
+			// Start a new shard and continue the container there
+			shards = append(shards, ApplicationProfileSpec{})
+			currentSize = 0
+			startContainer(container)
+		}
+		appendEntry(currentContainer())
+		currentSize += entrySize
+	}
+
+	for i := range spec.Containers {
+		container := &spec.Containers[i]
+		startContainer(container)
+		for _, syscall := range container.SysCalls {
+			syscall := syscall
+			addEntry(container, syscall, func(c *ContainerProfile) { c.SysCalls = append(c.SysCalls, syscall) })
+		}
+		for _, capability := range container.Capabilities {
+			capability := capability
+			addEntry(container, capability, func(c *ContainerProfile) { c.Capabilities = append(c.Capabilities, capability) })
+		}
+		for _, dns := range container.Dns {
+			dns := dns
+			addEntry(container, dns, func(c *ContainerProfile) { c.Dns = append(c.Dns, dns) })
+		}
+		for _, exec := range container.Execs {
+			exec := exec
+			addEntry(container, exec, func(c *ContainerProfile) { c.Execs = append(c.Execs, exec) })
+		}
+		for _, open := range container.Opens {
+			open := open
+			addEntry(container, open, func(c *ContainerProfile) { c.Opens = append(c.Opens, open) })
+		}
+		for _, incoming := range container.NetworkActivity.Incoming {
+			incoming := incoming
+			addEntry(container, incoming, func(c *ContainerProfile) {
+				c.NetworkActivity.Incoming = append(c.NetworkActivity.Incoming, incoming)
+			})
+		}
+		for _, outgoing := range container.NetworkActivity.Outgoing {
+			outgoing := outgoing
+			addEntry(container, outgoing, func(c *ContainerProfile) {
+				c.NetworkActivity.Outgoing = append(c.NetworkActivity.Outgoing, outgoing)
+			})
+		}
+		for _, fileOperation := range container.FileOperations {
+			fileOperation := fileOperation
+			addEntry(container, fileOperation, func(c *ContainerProfile) { c.FileOperations = append(c.FileOperations, fileOperation) })
+		}
+		for _, listeningPort := range container.ListeningPorts {
+			listeningPort := listeningPort
+			addEntry(container, listeningPort, func(c *ContainerProfile) { c.ListeningPorts = append(c.ListeningPorts, listeningPort) })
+		}
+		for _, tcpConnection := range container.TcpConnections {
+			tcpConnection := tcpConnection
+			addEntry(container, tcpConnection, func(c *ContainerProfile) { c.TcpConnections = append(c.TcpConnections, tcpConnection) })
+		}
+		for _, privilegedOperation := range container.PrivilegedOperations {
+			privilegedOperation := privilegedOperation
+			addEntry(container, privilegedOperation, func(c *ContainerProfile) {
+				c.PrivilegedOperations = append(c.PrivilegedOperations, privilegedOperation)
+			})
+		}
+		for _, signal := range container.Signals {
+			signal := signal
+			addEntry(container, signal, func(c *ContainerProfile) { c.Signals = append(c.Signals, signal) })
+		}
+		for _, eventType := range container.EventTypes {
+			eventType := eventType
+			addEntry(container, eventType, func(c *ContainerProfile) { c.EventTypes = append(c.EventTypes, eventType) })
+		}
+	}
+
+	return shards
+}
+
+// joinApplicationProfileSpecs is the inverse of splitApplicationProfileSpec.
+func joinApplicationProfileSpecs(specs []ApplicationProfileSpec) ApplicationProfileSpec {
+	joined := ApplicationProfileSpec{}
+	for _, spec := range specs {
+		for _, container := range spec.Containers {
+			found := false
+			for i := range joined.Containers {
+				if joined.Containers[i].Name == container.Name {
+					existing := &joined.Containers[i]
+					existing.SysCalls = append(existing.SysCalls, container.SysCalls...)
+					existing.Capabilities = append(existing.Capabilities, container.Capabilities...)
+					existing.Dns = append(existing.Dns, container.Dns...)
+					existing.Execs = append(existing.Execs, container.Execs...)
+					existing.Opens = append(existing.Opens, container.Opens...)
+					existing.NetworkActivity.Incoming = append(existing.NetworkActivity.Incoming, container.NetworkActivity.Incoming...)
+					existing.NetworkActivity.Outgoing = append(existing.NetworkActivity.Outgoing, container.NetworkActivity.Outgoing...)
+					existing.EventTypes = append(existing.EventTypes, container.EventTypes...)
+					existing.FileOperations = append(existing.FileOperations, container.FileOperations...)
+					existing.ListeningPorts = append(existing.ListeningPorts, container.ListeningPorts...)
+					existing.TcpConnections = append(existing.TcpConnections, container.TcpConnections...)
+					existing.PrivilegedOperations = append(existing.PrivilegedOperations, container.PrivilegedOperations...)
+					existing.Signals = append(existing.Signals, container.Signals...)
+					if existing.ImageDigest == "" {
+						existing.ImageDigest = container.ImageDigest
+					}
+					found = true
+					break
+				}
+			}
+			if !found {
+				joined.Containers = append(joined.Containers, container)
+			}
+		}
+	}
+	return joined
+}
+
+// splitApplicationProfile returns the main object followed by its shards of the given generation, the main object is
+// returned as is if it fits.
+func splitApplicationProfile(profile *ApplicationProfile, generation string) []*ApplicationProfile {
+	main := &ApplicationProfile{
+		TypeMeta:   profile.TypeMeta,
+		ObjectMeta: *profile.ObjectMeta.DeepCopy(),
+		Spec:       profile.Spec,
+	}
+	if main.Annotations == nil {
+		main.Annotations = map[string]string{}
+	}
+	delete(main.Annotations, ShardsAnnotation)
+	delete(main.Annotations, ShardGenerationAnnotation)
+	if estimateSize(main) <= MaxApplicationProfileSize {
+		return []*ApplicationProfile{main}
+	}
+
+	// Leave room for the object metadata in each of the shards
+	metadataSize := estimateSize(&ApplicationProfile{TypeMeta: main.TypeMeta, ObjectMeta: main.ObjectMeta})
+	specs := splitApplicationProfileSpec(main.Spec, MaxApplicationProfileSize-metadataSize)
+
+	main.Spec = specs[0]
+	main.Annotations[ShardsAnnotation] = strconv.Itoa(len(specs) - 1)
+	main.Annotations[ShardGenerationAnnotation] = generation
+	profiles := []*ApplicationProfile{main}
+	for i, spec := range specs[1:] {
+		profiles = append(profiles, &ApplicationProfile{
+			TypeMeta: v1.TypeMeta{
+				Kind:       ApplicationProfileKind,
+				APIVersion: ApplicationProfileApiVersion,
+			},
+			ObjectMeta: v1.ObjectMeta{
+				Name:            GetApplicationProfileShardName(main.Name, generation, i+1),
+				Labels:          map[string]string{ShardLabel: "true"},
+				Annotations:     map[string]string{ShardOfAnnotation: main.Name},
+				OwnerReferences: applicationProfileShardOwner(main),
+			},
+			Spec: spec,
+		})
+	}
+	return profiles
+}
+
+func getApplicationProfileObject(ctx context.Context, client dynamic.Interface, namespace string, name string) (*ApplicationProfile, error) {
+	profileRaw, err := client.Resource(AppProfileGvr).Namespace(namespace).Get(ctx, name, v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	profile := &ApplicationProfile{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(profileRaw.Object, profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// GetApplicationProfile returns the application profile with all of its shards joined back.
+func GetApplicationProfile(ctx context.Context, client dynamic.Interface, namespace string, name string) (*ApplicationProfile, error) {
+	profile, err := getApplicationProfileObject(ctx, client, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	shards, err := getApplicationProfileShards(ctx, client, namespace, profile)
+	if apierrors.IsNotFound(err) {
+		// The profile was written with new shards since the main object was read, the previous ones are deleted
+		profile, err = getApplicationProfileObject(ctx, client, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		shards, err = getApplicationProfileShards(ctx, client, namespace, profile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(shards) > 0 {
+		profile.Spec = joinApplicationProfileSpecs(append([]ApplicationProfileSpec{profile.Spec}, shards...))
+	}
+	return profile, nil
+}
+
+// getApplicationProfileShards returns the specs of the shards of the generation the main object points to
+func getApplicationProfileShards(ctx context.Context, client dynamic.Interface, namespace string, profile *ApplicationProfile) ([]ApplicationProfileSpec, error) {
+	specs := []ApplicationProfileSpec{}
+	for i := 1; i <= getShardCount(profile); i++ {
+		shard, err := getApplicationProfileObject(ctx, client, namespace, GetApplicationProfileShardName(profile.Name, getShardGeneration(profile), i))
+		if err != nil {
+			return nil, fmt.Errorf("error getting shard %d of application profile %s: %w", i, profile.Name, err)
+		}
+		specs = append(specs, shard.Spec)
+	}
+	return specs, nil
+}
+
+func writeApplicationProfileObject(ctx context.Context, client dynamic.Interface, namespace string, profile *ApplicationProfile, create bool) (*unstructured.Unstructured, error) {
+	profileRaw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(profile)
+	if err != nil {
+		return nil, err
+	}
+	if create {
+		return client.Resource(AppProfileGvr).Namespace(namespace).Create(ctx, &unstructured.Unstructured{Object: profileRaw}, v1.CreateOptions{})
+	}
+	return client.Resource(AppProfileGvr).Namespace(namespace).Update(ctx, &unstructured.Unstructured{Object: profileRaw}, v1.UpdateOptions{})
+}
+
+func writeApplicationProfileShard(ctx context.Context, client dynamic.Interface, namespace string, shard *ApplicationProfile) error {
+	existing, err := client.Resource(AppProfileGvr).Namespace(namespace).Get(ctx, shard.Name, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = writeApplicationProfileObject(ctx, client, namespace, shard, true)
+		return err
+	} else if err != nil {
+		return err
+	}
+	shard.ResourceVersion = existing.GetResourceVersion()
+	_, err = writeApplicationProfileObject(ctx, client, namespace, shard, false)
+	return err
+}
+
+// setApplicationProfileShardsOwner sets the owner of the shards written before their main object was created, so that
+// they are garbage collected with it.
+func setApplicationProfileShardsOwner(ctx context.Context, client dynamic.Interface, namespace string, main *ApplicationProfile, shards []*ApplicationProfile) {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"ownerReferences": applicationProfileShardOwner(main)},
+	})
+	if err != nil {
+		log.Printf("error marshaling the owner of the shards of application profile %s: %s\n", main.Name, err)
+		return
+	}
+	for _, shard := range shards {
+		_, err := client.Resource(AppProfileGvr).Namespace(namespace).Patch(ctx, shard.Name, types.MergePatchType, patch, v1.PatchOptions{})
+		if err != nil {
+			log.Printf("error setting the owner of shard %s of application profile %s: %s\n", shard.Name, main.Name, err)
+		}
+	}
+}
+
+func deleteApplicationProfileShards(ctx context.Context, client dynamic.Interface, namespace string, name string, generation string, count int) {
+	// The shards of a failed write are removed even if the write was cancelled
+	ctx = context.WithoutCancel(ctx)
+	for i := 1; i <= count; i++ {
+		err := client.Resource(AppProfileGvr).Namespace(namespace).Delete(ctx, GetApplicationProfileShardName(name, generation, i), v1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("error deleting shard %d of application profile %s: %s\n", i, name, err)
+		}
+	}
+}
+
+// writeApplicationProfile writes the shards of a new generation and then the main object pointing to them, so that
+// readers never join the main object with the shards of another write. The shards are deleted if the main object
+// could not be written.
+func writeApplicationProfile(ctx context.Context, client dynamic.Interface, namespace string, profile *ApplicationProfile, create bool) error {
+	profiles := splitApplicationProfile(profile, newShardGeneration())
+	main := profiles[0]
+	for _, shard := range profiles[1:] {
+		if err := writeApplicationProfileShard(ctx, client, namespace, shard); err != nil {
+			deleteApplicationProfileShards(ctx, client, namespace, main.Name, getShardGeneration(main), len(profiles)-1)
+			return err
+		}
+	}
+	written, err := writeApplicationProfileObject(ctx, client, namespace, main, create)
+	if err != nil {
+		deleteApplicationProfileShards(ctx, client, namespace, main.Name, getShardGeneration(main), len(profiles)-1)
+		return err
+	}
+	if main.UID == "" && written.GetUID() != "" && len(profiles) > 1 {
+		main.UID = written.GetUID()
+		setApplicationProfileShardsOwner(ctx, client, namespace, main, profiles[1:])
+	}
+	return nil
+}
+
+// CreateApplicationProfile creates the application profile, splitting it into shards if it is too big for a single object.
+func CreateApplicationProfile(ctx context.Context, client dynamic.Interface, namespace string, profile *ApplicationProfile) error {
+	return writeApplicationProfile(ctx, client, namespace, profile, true)
+}
+
+// UpdateApplicationProfile updates an application profile that was read with GetApplicationProfile.
+func UpdateApplicationProfile(ctx context.Context, client dynamic.Interface, namespace string, profile *ApplicationProfile) error {
+	if err := writeApplicationProfile(ctx, client, namespace, profile, false); err != nil {
+		return err
+	}
+	// Remove the shards of the previous write now that the main object does not point to them anymore
+	deleteApplicationProfileShards(ctx, client, namespace, profile.Name, getShardGeneration(profile), getShardCount(profile))
+	return nil
+}
+
+// DeleteApplicationProfile deletes the application profile and all of its shards.
+func DeleteApplicationProfile(ctx context.Context, client dynamic.Interface, namespace string, name string) error {
+	profile, err := getApplicationProfileObject(ctx, client, namespace, name)
+	if err != nil {
+		return err
+	}
+	err = client.Resource(AppProfileGvr).Namespace(namespace).Delete(ctx, name, v1.DeleteOptions{})
+	if err != nil {
+		return err
+	}
+	deleteApplicationProfileShards(ctx, client, namespace, name, getShardGeneration(profile), getShardCount(profile))
+	return nil
+}
@@ -0,0 +1,224 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestDynamicClient() *fake.FakeDynamicClient {
+	return fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		AppProfileGvr: "ApplicationProfileList",
+	})
+}
+
+func newLargeApplicationProfile(name string, opens int) *ApplicationProfile {
+	container := ContainerProfile{
+		Name:        "app",
+		SysCalls:    []string{"open", "close"},
+		Execs:       []ExecCalls{{Path: "/bin/server", Args: []string{"--port", "8080"}, Envs: []string{}}},
+		ImageDigest: "sha256:0123456789abcdef",
+	}
+	longPath := "/var/lib/app/" + strings.Repeat("x", 200)
+	for i := 0; i < opens; i++ {
+		container.Opens = append(container.Opens, OpenCalls{Path: fmt.Sprintf("%s/%d", longPath, i), Flags: []string{"O_RDONLY"}})
+	}
+	return &ApplicationProfile{
+		TypeMeta: v1.TypeMeta{
+			Kind:       ApplicationProfileKind,
+			APIVersion: ApplicationProfileApiVersion,
+		},
+		ObjectMeta: v1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"kapprofiler.kubescape.io/partial": "true"},
+		},
+		Spec: ApplicationProfileSpec{
+			Containers: []ContainerProfile{container, {Name: "sidecar", SysCalls: []string{"read"}}},
+		},
+	}
+}
+
+func TestSplitApplicationProfileSpec(t *testing.T) {
+	spec := newLargeApplicationProfile("pod-nginx", 100).Spec
+
+	shards := splitApplicationProfileSpec(spec, 4096)
+	if len(shards) < 2 {
+		t.Fatalf("expected more than one shard, got %d\n", len(shards))
+	}
+	for i, shard := range shards {
+		// A single entry may go over the budget, but never by more than the size of an entry
+		if size := estimateSize(shard); size > 4096+512 {
+			t.Errorf("shard %d is too big: %d\n", i, size)
+		}
+	}
+
+	if joined := joinApplicationProfileSpecs(shards); !reflect.DeepEqual(spec, joined) {
+		t.Errorf("joined spec does not match the original spec\n")
+	}
+}
+
+func TestSplitApplicationProfileFits(t *testing.T) {
+	profile := newLargeApplicationProfile("pod-nginx", 10)
+	profiles := splitApplicationProfile(profile, newShardGeneration())
+	if len(profiles) != 1 {
+		t.Fatalf("expected 1 object, got %d\n", len(profiles))
+	}
+	if _, ok := profiles[0].Annotations[ShardsAnnotation]; ok {
+		t.Errorf("expected no %s annotation\n", ShardsAnnotation)
+	}
+}
+
+func TestApplicationProfileShardsLifecycle(t *testing.T) {
+	client := newTestDynamicClient()
+	profile := newLargeApplicationProfile("pod-nginx", 6000)
+
+	if err := CreateApplicationProfile(context.Background(), client, "default", profile); err != nil {
+		t.Fatalf("error creating application profile: %s\n", err)
+	}
+
+	main, err := getApplicationProfileObject(context.Background(), client, "default", "pod-nginx")
+	if err != nil {
+		t.Fatalf("error getting main object: %s\n", err)
+	}
+	shardCount := getShardCount(main)
+	if shardCount < 1 {
+		t.Fatalf("expected the application profile to be sharded\n")
+	}
+	if main.Labels["kapprofiler.kubescape.io/partial"] != "true" {
+		t.Errorf("expected labels to be kept on the main object\n")
+	}
+
+	stored, err := GetApplicationProfile(context.Background(), client, "default", "pod-nginx")
+	if err != nil {
+		t.Fatalf("error getting application profile: %s\n", err)
+	}
+	if !reflect.DeepEqual(profile.Spec, stored.Spec) {
+		t.Fatalf("stored spec does not match the original spec\n")
+	}
+
+	// Shrink the profile, the shards that are not needed anymore should be removed
+	stored.Spec.Containers[0].Opens = stored.Spec.Containers[0].Opens[:10]
+	if err := UpdateApplicationProfile(context.Background(), client, "default", stored); err != nil {
+		t.Fatalf("error updating application profile: %s\n", err)
+	}
+	updated, err := GetApplicationProfile(context.Background(), client, "default", "pod-nginx")
+	if err != nil {
+		t.Fatalf("error getting application profile: %s\n", err)
+	}
+	if getShardCount(updated) != 0 {
+		t.Errorf("expected no shards, got %d\n", getShardCount(updated))
+	}
+	if len(updated.Spec.Containers[0].Opens) != 10 {
+		t.Errorf("expected 10 opens, got %d\n", len(updated.Spec.Containers[0].Opens))
+	}
+	if _, err := getApplicationProfileObject(context.Background(), client, "default", GetApplicationProfileShardName("pod-nginx", getShardGeneration(main), 1)); err == nil {
+		t.Errorf("expected shard 1 to be deleted\n")
+	}
+
+	if err := DeleteApplicationProfile(context.Background(), client, "default", "pod-nginx"); err != nil {
+		t.Fatalf("error deleting application profile: %s\n", err)
+	}
+	if _, err := GetApplicationProfile(context.Background(), client, "default", "pod-nginx"); err == nil {
+		t.Errorf("expected application profile to be deleted\n")
+	}
+}
+
+func TestUpdateApplicationProfileShardsConflict(t *testing.T) {
+	client := newTestDynamicClient()
+	profile := newLargeApplicationProfile("pod-nginx", 6000)
+	if err := CreateApplicationProfile(context.Background(), client, "default", profile); err != nil {
+		t.Fatalf("error creating application profile: %s\n", err)
+	}
+	stored, err := GetApplicationProfile(context.Background(), client, "default", "pod-nginx")
+	if err != nil {
+		t.Fatalf("error getting application profile: %s\n", err)
+	}
+
+	// Another writer updated the main object since it was read
+	client.PrependReactor("update", "applicationprofiles", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.UpdateAction).GetObject().(*unstructured.Unstructured).GetName() != "pod-nginx" {
+			return false, nil, nil
+		}
+		return true, nil, apierrors.NewConflict(AppProfileGvr.GroupResource(), "pod-nginx", fmt.Errorf("the object has been modified"))
+	})
+	shardCount := getShardCount(stored)
+	stored.Spec.Containers[0].SysCalls = append(stored.Spec.Containers[0].SysCalls, "write")
+	stored.Spec.Containers[0].Opens = append(stored.Spec.Containers[0].Opens, OpenCalls{Path: "/tmp/new", Flags: []string{"O_RDWR"}})
+	if err := UpdateApplicationProfile(context.Background(), client, "default", stored); !apierrors.IsConflict(err) {
+		t.Fatalf("expected a conflict, got %v\n", err)
+	}
+
+	// Readers still get the profile that was stored, and the shards of the failed update are removed
+	read, err := GetApplicationProfile(context.Background(), client, "default", "pod-nginx")
+	if err != nil {
+		t.Fatalf("error getting application profile: %s\n", err)
+	}
+	if !reflect.DeepEqual(profile.Spec, read.Spec) {
+		t.Errorf("stored spec does not match the original spec after the conflict\n")
+	}
+	list, err := client.Resource(AppProfileGvr).Namespace("default").List(context.Background(), v1.ListOptions{})
+	if err != nil {
+		t.Fatalf("error listing application profiles: %s\n", err)
+	}
+	if expected := 1 + shardCount; len(list.Items) != expected {
+		t.Errorf("expected %d objects, got %d\n", expected, len(list.Items))
+	}
+}
+
+func TestApplicationProfileShardNames(t *testing.T) {
+	// A pod named like a shard gets a profile name different from the shards of the profile of another pod
+	if shard, profile := GetApplicationProfileShardName("pod-nginx", "abcde", 1), ApplicationProfileName("Pod", "nginx-shard-abcde-1", "default", false); shard == profile {
+		t.Errorf("expected the shard name %s to differ from the profile name\n", shard)
+	}
+	if shard := GetApplicationProfileShardName("pod-nginx", "abcde", 1); !strings.HasPrefix(shard, "shard.") {
+		t.Errorf("expected the shard name to start with shard., got %s\n", shard)
+	}
+}
+
+func TestCreateApplicationProfileShardsOwner(t *testing.T) {
+	client := newTestDynamicClient()
+	// The API server sets the UID of the created objects
+	client.PrependReactor("create", "applicationprofiles", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		object := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		object.SetUID(types.UID("uid-" + object.GetName()))
+		return false, nil, nil
+	})
+	if err := CreateApplicationProfile(context.Background(), client, "default", newLargeApplicationProfile("pod-nginx", 6000)); err != nil {
+		t.Fatalf("error creating application profile: %s\n", err)
+	}
+
+	main, err := getApplicationProfileObject(context.Background(), client, "default", "pod-nginx")
+	if err != nil {
+		t.Fatalf("error getting main object: %s\n", err)
+	}
+	for i := 1; i <= getShardCount(main); i++ {
+		shard, err := getApplicationProfileObject(context.Background(), client, "default", GetApplicationProfileShardName("pod-nginx", getShardGeneration(main), i))
+		if err != nil {
+			t.Fatalf("error getting shard %d: %s\n", i, err)
+		}
+		if owners := shard.OwnerReferences; len(owners) != 1 || owners[0].Name != "pod-nginx" || owners[0].UID != main.UID {
+			t.Errorf("expected shard %d to be owned by the main object, got %+v\n", i, owners)
+		}
+	}
+
+	// Shards written for an existing main object get their owner right away
+	stored, err := GetApplicationProfile(context.Background(), client, "default", "pod-nginx")
+	if err != nil {
+		t.Fatalf("error getting application profile: %s\n", err)
+	}
+	profiles := splitApplicationProfile(stored, newShardGeneration())
+	if owners := profiles[1].OwnerReferences; len(owners) != 1 || owners[0].UID != main.UID {
+		t.Errorf("expected the shard to be owned by the main object, got %+v\n", owners)
+	}
+}
@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+	"golang.org/x/exp/slices"
+)
+
+func TestBuildContainerProfileSignals(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	id := &ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}
+	reload := &tracing.SignalEvent{
+		GeneralEvent:  tracing.GeneralEvent{ProcessDetails: tracing.ProcessDetails{Comm: "nginx"}},
+		Signal:        "SIGHUP",
+		TargetPid:     7,
+		ExePath:       "/usr/sbin/nginx",
+		TargetExePath: "/usr/sbin/nginx",
+	}
+	group := &tracing.SignalEvent{
+		GeneralEvent: tracing.GeneralEvent{ProcessDetails: tracing.ProcessDetails{Comm: "sh"}},
+		Signal:       "SIGTERM",
+		TargetPid:    uint32(0xffffffff),
+		ExePath:      "/bin/sh",
+	}
+	totalEvents := &TotalEvents{SignalEvents: []*tracing.SignalEvent{reload, group, reload}}
+	if !shouldProcessEvents(totalEvents) {
+		t.Fatalf("expected the signals to be processed")
+	}
+
+	profile := cm.buildContainerProfile(id, &ContainerState{}, totalEvents)
+	expected := []SignalCalls{
+		{Signal: "SIGHUP", Comm: "nginx", Exe: "/usr/sbin/nginx", TargetExe: "/usr/sbin/nginx"},
+		{Signal: "SIGTERM", Comm: "sh", Exe: "/bin/sh"},
+	}
+	if !slices.Equal(profile.Signals, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, profile.Signals)
+	}
+
+	// Merging only adds the new signals
+	existing := &ApplicationProfile{Spec: ApplicationProfileSpec{Containers: []ContainerProfile{{
+		Name:    "app",
+		Signals: []SignalCalls{expected[1]},
+	}}}}
+	merged, _ := cm.mergeApplicationProfiles(existing, &profile, id)
+	if signals := merged.Spec.Containers[0].Signals; len(signals) != 2 {
+		t.Errorf("expected 2 signals, got %+v", signals)
+	}
+
+	// Shadowed containers report the signals their baseline does not list
+	delta := subtractContainerProfile(profile, ContainerProfile{Name: "app", Signals: expected[1:]})
+	if !slices.Equal(delta.Signals, expected[:1]) {
+		t.Errorf("expected %+v, got %+v", expected[:1], delta.Signals)
+	}
+}
@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/tracing"
+	"golang.org/x/exp/slices"
+)
+
+func tcpConnectEvent(address string, port uint16, comm string, exe string, success bool) *tracing.TcpConnectEvent {
+	return &tracing.TcpConnectEvent{
+		GeneralEvent: tracing.GeneralEvent{ProcessDetails: tracing.ProcessDetails{Comm: comm}},
+		DstAddress:   address,
+		DstPort:      port,
+		Success:      success,
+		ExePath:      exe,
+	}
+}
+
+func TestBuildContainerProfileTcpConnections(t *testing.T) {
+	cm := newTestCollectorManager(newTestDynamicClient())
+	id := &ContainerId{Namespace: "default", PodName: "nginx", Container: "app"}
+	totalEvents := &TotalEvents{TcpConnectEvents: []*tracing.TcpConnectEvent{
+		tcpConnectEvent("10.0.0.1", 5432, "server", "/usr/bin/server", true),
+		tcpConnectEvent("10.0.0.1", 5432, "server", "/usr/bin/server", true),
+		tcpConnectEvent("10.0.0.1", 5432, "server", "/usr/bin/server", false),
+		tcpConnectEvent("10.0.0.1", 5432, "curl", "/usr/bin/curl", false),
+	}}
+	if !shouldProcessEvents(totalEvents) {
+		t.Fatalf("expected the tcp connect events to be processed")
+	}
+
+	profile := cm.buildContainerProfile(id, &ContainerState{}, totalEvents)
+	expected := []TcpConnectionCalls{
+		{DstEndpoint: "10.0.0.1", Port: 5432, Comm: "server", Exe: "/usr/bin/server", Successes: 2, Failures: 1},
+		{DstEndpoint: "10.0.0.1", Port: 5432, Comm: "curl", Exe: "/usr/bin/curl", Failures: 1},
+	}
+	if !slices.Equal(profile.TcpConnections, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, profile.TcpConnections)
+	}
+
+	// Merging adds up the counts of the known connections
+	existing := &ApplicationProfile{Spec: ApplicationProfileSpec{Containers: []ContainerProfile{{
+		Name:           "app",
+		TcpConnections: []TcpConnectionCalls{{DstEndpoint: "10.0.0.1", Port: 5432, Comm: "server", Exe: "/usr/bin/server", Successes: 10}},
+	}}}}
+	merged, _ := cm.mergeApplicationProfiles(existing, &profile, id)
+	expected = []TcpConnectionCalls{
+		{DstEndpoint: "10.0.0.1", Port: 5432, Comm: "server", Exe: "/usr/bin/server", Successes: 12, Failures: 1},
+		{DstEndpoint: "10.0.0.1", Port: 5432, Comm: "curl", Exe: "/usr/bin/curl", Failures: 1},
+	}
+	if tcpConnections := merged.Spec.Containers[0].TcpConnections; !slices.Equal(tcpConnections, expected) {
+		t.Errorf("expected %+v, got %+v", expected, tcpConnections)
+	}
+}
@@ -1,6 +1,8 @@
 package collector
 
 import (
+	"golang.org/x/exp/slices"
+
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
@@ -9,6 +11,12 @@ type ExecCalls struct {
 	Path string   `json:"path" yaml:"path"`
 	Args []string `json:"args" yaml:"args"`
 	Envs []string `json:"envs" yaml:"envs"`
+	// Executable of the process that ran the exec, empty if it is not known
+	ParentPath string `json:"parentPath,omitempty" yaml:"parentPath,omitempty"`
+	// User, group and working directory of the exec, nil or empty for the execs recorded before they were kept
+	Uid *uint32 `json:"uid,omitempty" yaml:"uid,omitempty"`
+	Gid *uint32 `json:"gid,omitempty" yaml:"gid,omitempty"`
+	Cwd string  `json:"cwd,omitempty" yaml:"cwd,omitempty"`
 }
 
 type NetworkCalls struct {
@@ -22,9 +30,17 @@ type NetworkActivity struct {
 	Outgoing []NetworkCalls `json:"outgoing" yaml:"outgoing"`
 }
 
+// OpenExecutable identifies an executable that opened a file
+type OpenExecutable struct {
+	Comm string `json:"comm" yaml:"comm"`
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
 type OpenCalls struct {
 	Path  string   `json:"path" yaml:"path"`
 	Flags []string `json:"flags" yaml:"flags"`
+	// Executables that opened the file, only recorded when enabled
+	Executables []OpenExecutable `json:"executables,omitempty" yaml:"executables,omitempty"`
 }
 
 type CapabilitiesCalls struct {
@@ -37,6 +53,66 @@ type DnsCalls struct {
 	Addresses []string `json:"addresses" yaml:"addresses"`
 }
 
+// FileOperationCalls is a file mutation made by the container
+type FileOperationCalls struct {
+	// One of unlink, rmdir, rename, chmod, chown, mkdir and write
+	Operation string `json:"operation" yaml:"operation"`
+	// Absolute path operated on, empty if it was not traced
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	Comm string `json:"comm" yaml:"comm"`
+}
+
+// ListeningPortCalls is a port the container bound a socket to
+type ListeningPortCalls struct {
+	Protocol string `json:"protocol" yaml:"protocol"`
+	Address  string `json:"address" yaml:"address"`
+	Port     uint16 `json:"port" yaml:"port"`
+	// Command name and executable of the process that bound the socket, the executable is empty if it was not found
+	Comm string `json:"comm" yaml:"comm"`
+	Exe  string `json:"exe,omitempty" yaml:"exe,omitempty"`
+}
+
+// TcpConnectionCalls is an outgoing TCP connection of the container with the number of connects that got the
+// connection established and that failed
+type TcpConnectionCalls struct {
+	DstEndpoint string `json:"dstEndpoint" yaml:"dstEndpoint"`
+	Port        uint16 `json:"port" yaml:"port"`
+	// Command name and executable of the process that connected, the executable is empty if it was not found
+	Comm      string `json:"comm" yaml:"comm"`
+	Exe       string `json:"exe,omitempty" yaml:"exe,omitempty"`
+	Successes uint64 `json:"successes" yaml:"successes"`
+	Failures  uint64 `json:"failures" yaml:"failures"`
+}
+
+// PrivilegedOperationCalls is a namespace, mount, identity, tracing or kernel module operation of the container
+type PrivilegedOperationCalls struct {
+	// One of mount, umount, setns, unshare, pivot_root, ptrace, setuid, setgid and load_module
+	Operation string `json:"operation" yaml:"operation"`
+	// Namespaces created by unshare or entered by setns, separated by commas
+	Namespaces string `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	// Ids set by setuid and setgid, in the order of the syscall arguments and -1 for the ones left unchanged
+	TargetIds string `json:"targetIds,omitempty" yaml:"targetIds,omitempty"`
+	// Source, target and filesystem type of the mounts, only the target is set for the umounts. The target of
+	// pivot_root is the new root and the source the directory the old root is moved to.
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+	Target string `json:"target,omitempty" yaml:"target,omitempty"`
+	FsType string `json:"fsType,omitempty" yaml:"fsType,omitempty"`
+	// Command name and executable of the process, the executable is empty if it was not found
+	Comm string `json:"comm" yaml:"comm"`
+	Exe  string `json:"exe,omitempty" yaml:"exe,omitempty"`
+}
+
+// SignalCalls is a signal a process of the container sent to another process
+type SignalCalls struct {
+	// Name of the signal, like SIGTERM
+	Signal string `json:"signal" yaml:"signal"`
+	// Command name and executable of the sender, and executable of the target. The executables are empty if they
+	// were not found, the target is not found when the signal was sent to a process group.
+	Comm      string `json:"comm" yaml:"comm"`
+	Exe       string `json:"exe,omitempty" yaml:"exe,omitempty"`
+	TargetExe string `json:"targetExe,omitempty" yaml:"targetExe,omitempty"`
+}
+
 type ContainerProfile struct {
 	Name            string              `json:"name" yaml:"name"`
 	Execs           []ExecCalls         `json:"execs" yaml:"execs"`
@@ -45,6 +121,20 @@ type ContainerProfile struct {
 	Capabilities    []CapabilitiesCalls `json:"capabilities" yaml:"capabilities"`
 	Dns             []DnsCalls          `json:"dns" yaml:"dns"`
 	SysCalls        []string            `json:"syscalls" yaml:"syscalls"`
+	// Digest of the image the container was recorded from
+	ImageDigest string `json:"imageDigest,omitempty" yaml:"imageDigest,omitempty"`
+	// Categories of events that were collected for the container
+	EventTypes []string `json:"eventTypes,omitempty" yaml:"eventTypes,omitempty"`
+	// File mutations, only recorded when the file-operations event type is traced
+	FileOperations []FileOperationCalls `json:"fileOperations,omitempty" yaml:"fileOperations,omitempty"`
+	// Ports the container listens on
+	ListeningPorts []ListeningPortCalls `json:"listeningPorts,omitempty" yaml:"listeningPorts,omitempty"`
+	// Outgoing TCP connections by executable
+	TcpConnections []TcpConnectionCalls `json:"tcpConnections,omitempty" yaml:"tcpConnections,omitempty"`
+	// Privileged operations that were allowed
+	PrivilegedOperations []PrivilegedOperationCalls `json:"privilegedOperations,omitempty" yaml:"privilegedOperations,omitempty"`
+	// Signals sent by the processes of the container
+	Signals []SignalCalls `json:"signals,omitempty" yaml:"signals,omitempty"`
 }
 
 type ApplicationProfileSpec struct {
@@ -89,23 +179,48 @@ func (a ExecCalls) Equals(b ExecCalls) bool {
 			return false
 		}
 	}
-	// TODO: compare envs
-	return true
+	if a.ParentPath != b.ParentPath || a.Cwd != b.Cwd || !equalIds(a.Uid, b.Uid) || !equalIds(a.Gid, b.Gid) {
+		return false
+	}
+	return slices.Equal(a.Envs, b.Envs)
+}
+
+func equalIds(a *uint32, b *uint32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
 func (a OpenCalls) Equals(b OpenCalls) bool {
 	if a.Path != b.Path {
 		return false
 	}
-	if len(a.Flags) != len(b.Flags) {
+	return sameOpenFlags(a.Flags, b.Flags)
+}
+
+// sameOpenFlags checks if two lists of open flags hold the same flags in any order, the conversions between the
+// profile versions move the access mode first.
+func sameOpenFlags(a []string, b []string) bool {
+	if len(a) != len(b) {
 		return false
 	}
-	for i, flag := range a.Flags {
-		if flag != b.Flags[i] {
-			return false
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// AddExecutables adds the executables that are not yet known to open the file, up to MaxOpenExecutables.
+func (a *OpenCalls) AddExecutables(executables []OpenExecutable) {
+	for _, executable := range executables {
+		if len(a.Executables) >= MaxOpenExecutables {
+			return
+		}
+		if !slices.Contains(a.Executables, executable) {
+			a.Executables = append(a.Executables, executable)
 		}
 	}
-	return true
 }
 
 func (a CapabilitiesCalls) Equals(b CapabilitiesCalls) bool {
@@ -170,3 +285,38 @@ func (a NetworkActivity) Equals(b NetworkActivity) bool {
 	}
 	return true
 }
+
+func (a FileOperationCalls) Equals(b FileOperationCalls) bool {
+	return a.Operation == b.Operation && a.Path == b.Path && a.Comm == b.Comm
+}
+
+func (a ListeningPortCalls) Equals(b ListeningPortCalls) bool {
+	return a.Protocol == b.Protocol && a.Address == b.Address && a.Port == b.Port && a.Comm == b.Comm && a.Exe == b.Exe
+}
+
+func (a PrivilegedOperationCalls) Equals(b PrivilegedOperationCalls) bool {
+	return a == b
+}
+
+func (a SignalCalls) Equals(b SignalCalls) bool {
+	return a == b
+}
+
+// Equals compares the connections, regardless of their counts
+func (a TcpConnectionCalls) Equals(b TcpConnectionCalls) bool {
+	return a.DstEndpoint == b.DstEndpoint && a.Port == b.Port && a.Comm == b.Comm && a.Exe == b.Exe
+}
+
+// AddTcpConnection adds the counts of a connection to its entry, the connection is added if it has none and there
+// are less than MaxNetworkEvents connections.
+func AddTcpConnection(connections []TcpConnectionCalls, connection TcpConnectionCalls) []TcpConnectionCalls {
+	if index := slices.IndexFunc(connections, connection.Equals); index != -1 {
+		connections[index].Successes += connection.Successes
+		connections[index].Failures += connection.Failures
+		return connections
+	}
+	if len(connections) >= MaxNetworkEvents {
+		return connections
+	}
+	return append(connections, connection)
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CallStats holds the observation metadata of a single profile entry.
+type CallStats struct {
+	Count     uint64  `json:"count,omitempty" yaml:"count,omitempty"`
+	FirstSeen v1.Time `json:"firstSeen,omitempty" yaml:"firstSeen,omitempty"`
+	LastSeen  v1.Time `json:"lastSeen,omitempty" yaml:"lastSeen,omitempty"`
+}
+
+type ExecCallsV2 struct {
+	Path       string     `json:"path" yaml:"path"`
+	Args       []string   `json:"args" yaml:"args"`
+	Envs       []string   `json:"envs" yaml:"envs"`
+	ParentPath string     `json:"parentPath,omitempty" yaml:"parentPath,omitempty"`
+	Uid        *uint32    `json:"uid,omitempty" yaml:"uid,omitempty"`
+	Gid        *uint32    `json:"gid,omitempty" yaml:"gid,omitempty"`
+	Cwd        string     `json:"cwd,omitempty" yaml:"cwd,omitempty"`
+	Stats      *CallStats `json:"stats,omitempty" yaml:"stats,omitempty"`
+}
+
+type OpenFlags struct {
+	// Access mode of the open (O_RDONLY, O_WRONLY or O_RDWR)
+	Access string `json:"access" yaml:"access"`
+	// All the other flags passed to open
+	Modifiers []string `json:"modifiers" yaml:"modifiers"`
+}
+
+type OpenCallsV2 struct {
+	Path        string           `json:"path" yaml:"path"`
+	Flags       OpenFlags        `json:"flags" yaml:"flags"`
+	Executables []OpenExecutable `json:"executables,omitempty" yaml:"executables,omitempty"`
+	Stats       *CallStats       `json:"stats,omitempty" yaml:"stats,omitempty"`
+}
+
+// NetworkPeer identifies the Kubernetes object behind a network endpoint.
+type NetworkPeer struct {
+	Kind      string `json:"kind" yaml:"kind"`
+	Name      string `json:"name" yaml:"name"`
+	Namespace string `json:"namespace" yaml:"namespace"`
+}
+
+type NetworkCallsV2 struct {
+	Protocol    string       `json:"protocol" yaml:"protocol"`
+	Port        uint16       `json:"port" yaml:"port"`
+	DstEndpoint string       `json:"dstEndpoint" yaml:"dstEndpoint"`
+	Peer        *NetworkPeer `json:"peer,omitempty" yaml:"peer,omitempty"`
+	Stats       *CallStats   `json:"stats,omitempty" yaml:"stats,omitempty"`
+}
+
+type NetworkActivityV2 struct {
+	Incoming []NetworkCallsV2 `json:"incoming" yaml:"incoming"`
+	Outgoing []NetworkCallsV2 `json:"outgoing" yaml:"outgoing"`
+}
+
+type ContainerProfileV2 struct {
+	Name                 string                     `json:"name" yaml:"name"`
+	Execs                []ExecCallsV2              `json:"execs" yaml:"execs"`
+	Opens                []OpenCallsV2              `json:"opens" yaml:"opens"`
+	NetworkActivity      NetworkActivityV2          `json:"networkActivity" yaml:"networkActivity"`
+	Capabilities         []CapabilitiesCalls        `json:"capabilities" yaml:"capabilities"`
+	Dns                  []DnsCalls                 `json:"dns" yaml:"dns"`
+	SysCalls             []string                   `json:"syscalls" yaml:"syscalls"`
+	EventTypes           []string                   `json:"eventTypes,omitempty" yaml:"eventTypes,omitempty"`
+	ImageDigest          string                     `json:"imageDigest,omitempty" yaml:"imageDigest,omitempty"`
+	FileOperations       []FileOperationCalls       `json:"fileOperations,omitempty" yaml:"fileOperations,omitempty"`
+	ListeningPorts       []ListeningPortCalls       `json:"listeningPorts,omitempty" yaml:"listeningPorts,omitempty"`
+	TcpConnections       []TcpConnectionCalls       `json:"tcpConnections,omitempty" yaml:"tcpConnections,omitempty"`
+	PrivilegedOperations []PrivilegedOperationCalls `json:"privilegedOperations,omitempty" yaml:"privilegedOperations,omitempty"`
+	Signals              []SignalCalls              `json:"signals,omitempty" yaml:"signals,omitempty"`
+}
+
+type ApplicationProfileSpecV2 struct {
+	Containers []ContainerProfileV2 `json:"containers" yaml:"containers"`
+}
+
+type ApplicationProfileV2 struct {
+	v1.TypeMeta   `json:",inline"`
+	v1.ObjectMeta `json:"metadata,omitempty"`
+	// Specification of the desired behavior of the ApplicationProfile.
+	Spec ApplicationProfileSpecV2 `json:"spec,omitempty"`
+}
+
+const (
+	// ApplicationProfileVersionV2 is the second version of ApplicationProfile
+	ApplicationProfileVersionV2 string = "v2"
+	// ApplicationProfileApiVersionV2 is the api version of the second version of ApplicationProfile
+	ApplicationProfileApiVersionV2 string = ApplicationProfileGroup + "/" + ApplicationProfileVersionV2
+)
+
+var AppProfileGvrV2 schema.GroupVersionResource = schema.GroupVersionResource{
+	Group:    ApplicationProfileGroup,
+	Version:  ApplicationProfileVersionV2,
+	Resource: ApplicationProfilePlural,
+}
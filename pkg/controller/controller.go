@@ -2,10 +2,7 @@ package controller
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"log"
-	"strings"
 
 	"github.com/kubescape/kapprofiler/pkg/collector"
 	"github.com/kubescape/kapprofiler/pkg/watcher"
@@ -18,7 +15,6 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	apitypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -27,15 +23,21 @@ import (
 // AppProfile controller struct
 type Controller struct {
 	config         *rest.Config
-	staticClient   *kubernetes.Clientset
-	dynamicClient  *dynamic.DynamicClient
+	staticClient   kubernetes.Interface
+	dynamicClient  dynamic.Interface
 	appProfileGvr  schema.GroupVersionResource
 	watcher        watcher.WatcherInterface
 	storeNamespace string
+	// Node of the controller, only the pods of the node are annotated
+	nodeName string
+	// Names of the application profiles of the workloads
+	profileNames *collector.ApplicationProfileNameCache
+	// Watchers of the operator annotations on workloads
+	workloadWatchers []watcher.WatcherInterface
 }
 
 // Create a new controller based on given config
-func NewController(config *rest.Config, storeNamespace string) *Controller {
+func NewController(config *rest.Config, storeNamespace string, nodeName string) *Controller {
 
 	// Initialize clients and channels
 	staticClient, _ := kubernetes.NewForConfig(config)
@@ -47,6 +49,8 @@ func NewController(config *rest.Config, storeNamespace string) *Controller {
 		dynamicClient:  dynamicClient,
 		appProfileGvr:  collector.AppProfileGvr,
 		storeNamespace: storeNamespace,
+		nodeName:       nodeName,
+		profileNames:   collector.NewApplicationProfileNameCache(dynamicClient, storeNamespace),
 	}
 }
 
@@ -68,6 +72,10 @@ func (c *Controller) StartController() {
 
 		},
 		DeleteFunc: func(obj *unstructured.Unstructured) {
+			// The profile of the workload may be created again under another name
+			if kind, name, namespace, _, ok := getApplicationProfileWorkload(obj); ok {
+				c.profileNames.Forget(namespace, kind, name)
+			}
 			c.handleApplicationProfile(obj)
 		},
 	}, collector.AppProfileGvr, metav1.ListOptions{})
@@ -80,6 +88,8 @@ func (c *Controller) StartController() {
 	// Set the watcher
 	c.watcher = appProfileWatcher
 
+	// Start watching the operator annotations of the workloads
+	c.startWorkloadWatchers()
 }
 
 // Stop the AppProfile controller
@@ -87,6 +97,9 @@ func (c *Controller) StopController() {
 	if c.watcher != nil {
 		c.watcher.Stop()
 	}
+	for _, workloadWatcher := range c.workloadWatchers {
+		workloadWatcher.Stop()
+	}
 }
 
 func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *unstructured.Unstructured) {
@@ -95,37 +108,47 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 		return
 	}
 
-	// Get Object name from ApplicationProfile. Application profile name has the kind in as the the prefix like deployment-nginx
-	var objectName string
-	var namespace string
-	if c.storeNamespace == "" {
-		objectName = strings.Join(strings.Split(applicationProfileUnstructured.GetName(), "-")[1:], "-")
-		namespace = applicationProfileUnstructured.GetNamespace()
-	} else {
-		namespace = applicationProfileUnstructured.GetLabels()["kapprofiler.kubescape.io/namespace"]
-		// Trim the namespace from the application profile name
-		objectName = strings.Join(strings.Split(applicationProfileUnstructured.GetName(), "-")[1:], "-")
-		objectName = strings.TrimSuffix(objectName, fmt.Sprintf("-%s", namespace))
+	// Shards are handled together with the application profile they belong to
+	if applicationProfileUnstructured.GetLabels()[collector.ShardLabel] == "true" {
+		return
+	}
+
+	// Delta profiles extend a final profile and are not propagated
+	if applicationProfileUnstructured.GetLabels()[collector.DeltaLabel] == "true" {
+		return
 	}
 
-	// Get pod to which the ApplicationProfile belongs to
-	pod, err := c.staticClient.CoreV1().Pods(namespace).Get(context.TODO(), objectName, metav1.GetOptions{})
-	if err != nil { // Ensures that the ApplicationProfile belongs to a pod or a replicaset
+	// Get the workload the ApplicationProfile belongs to from its labels
+	objectKind, objectName, namespace, objectUID, ok := getApplicationProfileWorkload(applicationProfileUnstructured)
+	if !ok {
+		return
+	}
+
+	// Ensures that the ApplicationProfile belongs to a pod or a replicaset
+	var pod *v1.Pod
+	switch objectKind {
+	case "pod":
+		var err error
+		pod, err = c.staticClient.CoreV1().Pods(namespace).Get(context.TODO(), objectName, metav1.GetOptions{})
+		if err != nil || !matchesUID(pod, objectUID) {
+			return
+		}
+	case "replicaset":
 		replicaSet, err := c.staticClient.AppsV1().ReplicaSets(namespace).Get(context.TODO(), objectName, metav1.GetOptions{})
-		if err != nil { // ApplicationProfile belongs to neither
+		if err != nil || !matchesUID(replicaSet, objectUID) {
 			return
 		}
 
 		if len(replicaSet.OwnerReferences) > 0 && replicaSet.OwnerReferences[0].Kind == "Deployment" { // If owner of replicaset is a deployment
-			profileName := fmt.Sprintf("deployment-%v", replicaSet.OwnerReferences[0].Name)
+			deploymentName := replicaSet.OwnerReferences[0].Name
+			profileName := c.profileNames.Get(replicaSet.Namespace, "deployment", deploymentName)
 			replicaSetNamespace := replicaSet.GetNamespace()
 			if c.storeNamespace != "" {
-				profileName = fmt.Sprintf("%s-%s", profileName, replicaSet.Namespace)
 				replicaSetNamespace = c.storeNamespace
 			}
-			existingApplicationProfile, err := c.dynamicClient.Resource(collector.AppProfileGvr).Namespace(replicaSetNamespace).Get(context.TODO(), profileName, metav1.GetOptions{})
+			existingApplicationProfile, err := collector.GetApplicationProfile(context.TODO(), c.dynamicClient, replicaSetNamespace, profileName)
 			if err != nil { // ApplicationProfile doesn't exist for deployment
-				applicationProfile, err := getApplicationProfileFromUnstructured(applicationProfileUnstructured)
+				applicationProfile, err := c.getFullApplicationProfile(applicationProfileUnstructured)
 				if err != nil {
 					return
 				}
@@ -142,11 +165,8 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 						Containers: applicationProfile.Spec.Containers,
 					},
 				}
-				deploymentApplicationProfileRaw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deploymentApplicationProfile)
-				if err != nil {
-					return
-				}
-				_, err = c.dynamicClient.Resource(collector.AppProfileGvr).Namespace(replicaSetNamespace).Create(context.TODO(), &unstructured.Unstructured{Object: deploymentApplicationProfileRaw}, metav1.CreateOptions{})
+				collector.SetApplicationProfileWorkload(deploymentApplicationProfile, "deployment", deploymentName, replicaSet.Namespace, string(replicaSet.OwnerReferences[0].UID))
+				err = collector.CreateApplicationProfile(context.TODO(), c.dynamicClient, replicaSetNamespace, deploymentApplicationProfile)
 				if err != nil {
 					return
 				}
@@ -157,28 +177,28 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 					return
 				}
 
-				applicationProfile, err := getApplicationProfileFromUnstructured(applicationProfileUnstructured)
+				applicationProfile, err := c.getFullApplicationProfile(applicationProfileUnstructured)
 				if err != nil {
 					return
 				}
 
-				deploymentApplicationProfile := &collector.ApplicationProfile{}
-				deploymentApplicationProfile.Labels = applicationProfile.GetLabels()
-				deploymentApplicationProfile.Spec.Containers = applicationProfile.Spec.Containers
-				deploymentApplicationProfileRaw, _ := json.Marshal(deploymentApplicationProfile)
-				_, err = c.dynamicClient.Resource(collector.AppProfileGvr).Namespace(replicaSetNamespace).Patch(context.TODO(), profileName, apitypes.MergePatchType, deploymentApplicationProfileRaw, metav1.PatchOptions{})
+				collector.SetApplicationProfileWorkload(existingApplicationProfile, "deployment", deploymentName, replicaSet.Namespace, string(replicaSet.OwnerReferences[0].UID))
+				err = updateApplicationProfile(c.dynamicClient, replicaSetNamespace, existingApplicationProfile, applicationProfile.GetLabels(), applicationProfile.Spec.Containers)
 				if err != nil {
 					return
 				}
 			}
 		} else {
 			log.Printf("ApplicationProfile %v doesn't belong to a deployment", applicationProfileUnstructured.GetName())
-			return
 		}
+		return
+	default:
+		return
 	}
 
 	var podControllerName string
 	var podControllerKind string
+	var podControllerUID string
 	var pods *v1.PodList
 
 	// Skip if the pod has no owner
@@ -198,6 +218,7 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 			return
 		}
 		podControllerName = replicaSet.GetName()
+		podControllerUID = string(replicaSet.GetUID())
 		podControllerKind = "replicaset"
 	case "DaemonSet":
 		daemonSet, err := c.staticClient.AppsV1().DaemonSets(pod.Namespace).Get(context.TODO(), pod.OwnerReferences[0].Name, metav1.GetOptions{})
@@ -209,6 +230,7 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 			return
 		}
 		podControllerName = daemonSet.GetName()
+		podControllerUID = string(daemonSet.GetUID())
 		podControllerKind = "daemonset"
 	case "StatefulSet":
 		statefulSet, err := c.staticClient.AppsV1().StatefulSets(pod.Namespace).Get(context.TODO(), pod.OwnerReferences[0].Name, metav1.GetOptions{})
@@ -220,6 +242,7 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 			return
 		}
 		podControllerName = statefulSet.GetName()
+		podControllerUID = string(statefulSet.GetUID())
 		podControllerKind = "statefulset"
 	case "CronJob":
 		cronJob, err := c.staticClient.BatchV1beta1().CronJobs(pod.Namespace).Get(context.TODO(), pod.OwnerReferences[0].Name, metav1.GetOptions{})
@@ -231,6 +254,7 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 			return
 		}
 		podControllerName = cronJob.GetName()
+		podControllerUID = string(cronJob.GetUID())
 		podControllerKind = "cronjob"
 	case "Job":
 		job, err := c.staticClient.BatchV1().Jobs(pod.Namespace).Get(context.TODO(), pod.OwnerReferences[0].Name, metav1.GetOptions{})
@@ -242,6 +266,7 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 			return
 		}
 		podControllerName = job.GetName()
+		podControllerUID = string(job.GetUID())
 		podControllerKind = "job"
 	default:
 		// If the pod controller is not a replicaset, daemonset or statefulset, then skip
@@ -252,20 +277,13 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 
 	// Merge all the container information of all the pods
 	for i := 0; i < len(pods.Items); i++ {
-		appProfileNameForPod := fmt.Sprintf("pod-%s", pods.Items[i].GetName())
-		podNamespace := pods.Items[i].GetNamespace()
-		if c.storeNamespace != "" {
-			appProfileNameForPod = fmt.Sprintf("%s-%s", appProfileNameForPod, podNamespace)
-			podNamespace = c.storeNamespace
-		}
-		typedObj, err := c.dynamicClient.Resource(collector.AppProfileGvr).Namespace(podNamespace).Get(context.TODO(), appProfileNameForPod, metav1.GetOptions{})
+		podApplicationProfileObj, err := c.getWorkloadApplicationProfile("pod", pods.Items[i].GetName(), pods.Items[i].GetNamespace())
 		if err != nil {
 			log.Printf("ApplicationProfile for pod %v doesn't exist", pods.Items[i].GetName())
 			return
 		}
-		podApplicationProfileObj, err := getApplicationProfileFromUnstructured(typedObj)
-		if err != nil {
-			log.Printf("ApplicationProfile for pod %v doesn't exist", pods.Items[i].GetName())
+		if !matchesUID(&pods.Items[i], podApplicationProfileObj.GetLabels()[collector.WorkloadUIDLabel]) {
+			log.Printf("ApplicationProfile for pod %v belongs to a previous pod with the same name", pods.Items[i].GetName())
 			return
 		}
 
@@ -280,6 +298,17 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 					}
 				}
 
+				// Merge EventTypes
+				for _, eventType := range podApplicationProfileObj.Spec.Containers[containerIndex].EventTypes {
+					if !slices.Contains(mapContainer.EventTypes, eventType) {
+						mapContainer.EventTypes = append(mapContainer.EventTypes, eventType)
+					}
+				}
+
+				if mapContainer.ImageDigest == "" {
+					mapContainer.ImageDigest = podApplicationProfileObj.Spec.Containers[containerIndex].ImageDigest
+				}
+
 				// Merge Execs
 				for _, exec := range podApplicationProfileObj.Spec.Containers[containerIndex].Execs {
 					contains := false
@@ -311,9 +340,10 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 				// Merge Opens
 				for _, open := range podApplicationProfileObj.Spec.Containers[containerIndex].Opens {
 					contains := false
-					for _, mapOpen := range mapContainer.Opens {
+					for i, mapOpen := range mapContainer.Opens {
 						if mapOpen.Equals(open) {
 							contains = true
+							mapContainer.Opens[i].AddExecutables(open.Executables)
 							break
 						}
 					}
@@ -363,6 +393,67 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 					}
 				}
 
+				// Merge FileOperations
+				for _, fileOperation := range podApplicationProfileObj.Spec.Containers[containerIndex].FileOperations {
+					contains := false
+					for _, mapFileOperation := range mapContainer.FileOperations {
+						if mapFileOperation.Equals(fileOperation) {
+							contains = true
+							break
+						}
+					}
+					if !contains {
+						mapContainer.FileOperations = append(mapContainer.FileOperations, fileOperation)
+					}
+				}
+
+				// Merge ListeningPorts
+				for _, listeningPort := range podApplicationProfileObj.Spec.Containers[containerIndex].ListeningPorts {
+					contains := false
+					for _, mapListeningPort := range mapContainer.ListeningPorts {
+						if mapListeningPort.Equals(listeningPort) {
+							contains = true
+							break
+						}
+					}
+					if !contains {
+						mapContainer.ListeningPorts = append(mapContainer.ListeningPorts, listeningPort)
+					}
+				}
+
+				// Merge TcpConnections, adding up their counts
+				for _, tcpConnection := range podApplicationProfileObj.Spec.Containers[containerIndex].TcpConnections {
+					mapContainer.TcpConnections = collector.AddTcpConnection(mapContainer.TcpConnections, tcpConnection)
+				}
+
+				// Merge PrivilegedOperations
+				for _, privilegedOperation := range podApplicationProfileObj.Spec.Containers[containerIndex].PrivilegedOperations {
+					contains := false
+					for _, mapPrivilegedOperation := range mapContainer.PrivilegedOperations {
+						if mapPrivilegedOperation.Equals(privilegedOperation) {
+							contains = true
+							break
+						}
+					}
+					if !contains {
+						mapContainer.PrivilegedOperations = append(mapContainer.PrivilegedOperations, privilegedOperation)
+					}
+				}
+
+				// Merge Signals
+				for _, signal := range podApplicationProfileObj.Spec.Containers[containerIndex].Signals {
+					contains := false
+					for _, mapSignal := range mapContainer.Signals {
+						if mapSignal.Equals(signal) {
+							contains = true
+							break
+						}
+					}
+					if !contains {
+						mapContainer.Signals = append(mapContainer.Signals, signal)
+					}
+				}
+
 				containersMap[podApplicationProfileObj.Spec.Containers[containerIndex].Name] = mapContainer
 			} else {
 				containersMap[podApplicationProfileObj.Spec.Containers[containerIndex].Name] = podApplicationProfileObj.Spec.Containers[containerIndex]
@@ -375,14 +466,13 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 		containers = append(containers, container)
 	}
 
-	applicationProfileNameForController := fmt.Sprintf("%s-%s", podControllerKind, podControllerName)
+	applicationProfileNameForController := c.profileNames.Get(pod.Namespace, podControllerKind, podControllerName)
 	controllerApplicationProfileNamespace := pod.Namespace
 	if c.storeNamespace != "" {
-		applicationProfileNameForController = fmt.Sprintf("%s-%s", applicationProfileNameForController, controllerApplicationProfileNamespace)
 		controllerApplicationProfileNamespace = c.storeNamespace
 	}
 	// Fetch ApplicationProfile of the controller
-	existingApplicationProfile, err := c.dynamicClient.Resource(collector.AppProfileGvr).Namespace(controllerApplicationProfileNamespace).Get(context.TODO(), applicationProfileNameForController, metav1.GetOptions{})
+	existingApplicationProfile, err := collector.GetApplicationProfile(context.TODO(), c.dynamicClient, controllerApplicationProfileNamespace, applicationProfileNameForController)
 	if err != nil { // ApplicationProfile of controller doesn't exist so create a new one
 		controllerApplicationProfile := &collector.ApplicationProfile{
 			TypeMeta: metav1.TypeMeta{
@@ -397,12 +487,8 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 				Containers: containers,
 			},
 		}
-		controllerApplicationProfileRaw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(controllerApplicationProfile)
-		if err != nil {
-			log.Printf("Error converting ApplicationProfile of controller %v", err)
-			return
-		}
-		_, err = c.dynamicClient.Resource(collector.AppProfileGvr).Namespace(controllerApplicationProfileNamespace).Create(context.TODO(), &unstructured.Unstructured{Object: controllerApplicationProfileRaw}, metav1.CreateOptions{})
+		collector.SetApplicationProfileWorkload(controllerApplicationProfile, podControllerKind, podControllerName, pod.Namespace, podControllerUID)
+		err = collector.CreateApplicationProfile(context.TODO(), c.dynamicClient, controllerApplicationProfileNamespace, controllerApplicationProfile)
 		if err != nil {
 			log.Printf("Error creating ApplicationProfile of controller %v", err)
 			return
@@ -413,11 +499,8 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 			// Don't update the application profile
 			return
 		}
-		controllerApplicationProfile := &collector.ApplicationProfile{}
-		controllerApplicationProfile.Labels = applicationProfileUnstructured.GetLabels()
-		controllerApplicationProfile.Spec.Containers = containers
-		controllerApplicationProfileRaw, _ := json.Marshal(controllerApplicationProfile)
-		_, err = c.dynamicClient.Resource(collector.AppProfileGvr).Namespace(controllerApplicationProfileNamespace).Patch(context.TODO(), applicationProfileNameForController, apitypes.MergePatchType, controllerApplicationProfileRaw, metav1.PatchOptions{})
+		collector.SetApplicationProfileWorkload(existingApplicationProfile, podControllerKind, podControllerName, pod.Namespace, podControllerUID)
+		err = updateApplicationProfile(c.dynamicClient, controllerApplicationProfileNamespace, existingApplicationProfile, applicationProfileUnstructured.GetLabels(), containers)
 		if err != nil {
 			log.Printf("Error updating ApplicationProfile of controller %v", err)
 			return
@@ -425,6 +508,39 @@ func (c *Controller) handleApplicationProfile(applicationProfileUnstructured *un
 	}
 }
 
+// Helper function to get the ApplicationProfile of a workload with all of its shards, using the cached profile names
+func (c *Controller) getWorkloadApplicationProfile(kind string, name string, namespace string) (*collector.ApplicationProfile, error) {
+	profileNamespace := namespace
+	if c.storeNamespace != "" {
+		profileNamespace = c.storeNamespace
+	}
+	return collector.GetApplicationProfile(context.TODO(), c.dynamicClient, profileNamespace, c.profileNames.Get(namespace, kind, name))
+}
+
+// Helper function to get the ApplicationProfile of a watch event with all of its shards
+func (c *Controller) getFullApplicationProfile(typedObj *unstructured.Unstructured) (*collector.ApplicationProfile, error) {
+	if typedObj.GetAnnotations()[collector.ShardsAnnotation] == "" {
+		return getApplicationProfileFromUnstructured(typedObj)
+	}
+	return collector.GetApplicationProfile(context.TODO(), c.dynamicClient, typedObj.GetNamespace(), typedObj.GetName())
+}
+
+// Helper function to replace the containers of an existing ApplicationProfile and add the given labels to it, except
+// the labels identifying the workload: the labels come from the profile of a child workload
+func updateApplicationProfile(client dynamic.Interface, namespace string, existingApplicationProfile *collector.ApplicationProfile, labels map[string]string, containers []collector.ContainerProfile) error {
+	if existingApplicationProfile.Labels == nil {
+		existingApplicationProfile.Labels = map[string]string{}
+	}
+	for key, value := range labels {
+		if key == collector.WorkloadKindLabel || key == collector.WorkloadNameLabel || key == collector.WorkloadNamespaceLabel || key == collector.WorkloadUIDLabel {
+			continue
+		}
+		existingApplicationProfile.Labels[key] = value
+	}
+	existingApplicationProfile.Spec.Containers = containers
+	return collector.UpdateApplicationProfile(context.TODO(), client, namespace, existingApplicationProfile)
+}
+
 // Helper function to convert interface to ApplicationProfile
 func getApplicationProfileFromUnstructured(typedObj *unstructured.Unstructured) (*collector.ApplicationProfile, error) {
 	var applicationProfileObj collector.ApplicationProfile
@@ -434,3 +550,23 @@ func getApplicationProfileFromUnstructured(typedObj *unstructured.Unstructured)
 	}
 	return &applicationProfileObj, nil
 }
+
+// Helper function to get the kind, name, namespace and UID of the workload of an ApplicationProfile from its labels.
+// The UID is empty for the profiles written before it was recorded.
+func getApplicationProfileWorkload(applicationProfileUnstructured *unstructured.Unstructured) (string, string, string, string, bool) {
+	profileLabels := applicationProfileUnstructured.GetLabels()
+	kind, ok := profileLabels[collector.WorkloadKindLabel]
+	if !ok {
+		return "", "", "", "", false
+	}
+	name := applicationProfileUnstructured.GetAnnotations()[collector.WorkloadNameAnnotation]
+	if name == "" {
+		name = profileLabels[collector.WorkloadNameLabel]
+	}
+	return kind, name, profileLabels[collector.WorkloadNamespaceLabel], profileLabels[collector.WorkloadUIDLabel], true
+}
+
+// Helper function to check that an object is the one with the UID of an ApplicationProfile, if the UID is known
+func matchesUID(obj metav1.Object, uid string) bool {
+	return uid == "" || string(obj.GetUID()) == uid
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/collector"
+	"golang.org/x/exp/slices"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestController(objects ...runtime.Object) *Controller {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		collector.AppProfileGvr: "ApplicationProfileList",
+	})
+	return &Controller{
+		staticClient:  fake.NewSimpleClientset(objects...),
+		dynamicClient: dynamicClient,
+		appProfileGvr: collector.AppProfileGvr,
+		nodeName:      "node-a",
+		profileNames:  collector.NewApplicationProfileNameCache(dynamicClient, ""),
+	}
+}
+
+// handleStoredApplicationProfile runs the controller on the stored application profile of a workload, as the watcher does
+func handleStoredApplicationProfile(t *testing.T, c *Controller, kind string, name string) *collector.ApplicationProfile {
+	profileName, err := collector.FindApplicationProfileName(c.dynamicClient, "", kind, name, "default")
+	if err != nil {
+		t.Fatalf("no application profile for %s %s: %s", kind, name, err)
+	}
+	obj, err := c.dynamicClient.Resource(collector.AppProfileGvr).Namespace("default").Get(context.TODO(), profileName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting the application profile of %s %s: %s", kind, name, err)
+	}
+	c.handleApplicationProfile(obj)
+	profile, err := collector.GetApplicationProfile(context.TODO(), c.dynamicClient, "default", profileName)
+	if err != nil {
+		t.Fatalf("error getting the application profile of %s %s: %s", kind, name, err)
+	}
+	return profile
+}
+
+func TestHandleApplicationProfileAggregatesDeployment(t *testing.T) {
+	isController := true
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", UID: types.UID("deployment-uid")}}
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "nginx-7f9c",
+			Namespace:       "default",
+			UID:             types.UID("replicaset-uid"),
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "nginx", UID: deployment.UID, Controller: &isController}},
+		},
+		Spec: appsv1.ReplicaSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}}},
+	}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            "nginx-7f9c-x2kq",
+		Namespace:       "default",
+		UID:             types.UID("pod-uid"),
+		Labels:          map[string]string{"app": "nginx"},
+		OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: replicaSet.Name, UID: replicaSet.UID, Controller: &isController}},
+	}}
+	c := newTestController(deployment, replicaSet, pod)
+
+	podProfileName, _ := collector.FindApplicationProfileName(c.dynamicClient, "", "pod", pod.Name, pod.Namespace)
+	podProfile := &collector.ApplicationProfile{
+		TypeMeta:   metav1.TypeMeta{Kind: collector.ApplicationProfileKind, APIVersion: collector.ApplicationProfileApiVersion},
+		ObjectMeta: metav1.ObjectMeta{Name: podProfileName},
+		Spec:       collector.ApplicationProfileSpec{Containers: []collector.ContainerProfile{{Name: "app", SysCalls: []string{"open"}}}},
+	}
+	collector.SetApplicationProfileWorkload(podProfile, "pod", pod.Name, pod.Namespace, string(pod.UID))
+	if err := collector.CreateApplicationProfile(context.TODO(), c.dynamicClient, "default", podProfile); err != nil {
+		t.Fatalf("error creating the pod application profile: %s", err)
+	}
+
+	// The first pass creates the profiles of the replicaset and of the deployment, the second one updates them
+	for pass, syscalls := range [][]string{{"open"}, {"open", "close"}} {
+		if pass > 0 {
+			podProfile, err := collector.GetApplicationProfile(context.TODO(), c.dynamicClient, "default", podProfileName)
+			if err != nil {
+				t.Fatalf("error getting the pod application profile: %s", err)
+			}
+			podProfile.Spec.Containers[0].SysCalls = syscalls
+			if err := collector.UpdateApplicationProfile(context.TODO(), c.dynamicClient, "default", podProfile); err != nil {
+				t.Fatalf("error updating the pod application profile: %s", err)
+			}
+		}
+
+		handleStoredApplicationProfile(t, c, "pod", pod.Name)
+		replicaSetProfile := handleStoredApplicationProfile(t, c, "replicaset", replicaSet.Name)
+		if uid := replicaSetProfile.GetLabels()[collector.WorkloadUIDLabel]; uid != string(replicaSet.UID) {
+			t.Fatalf("pass %d: expected the replicaset profile to have the replicaset UID, got %s", pass, uid)
+		}
+
+		deploymentProfileName, _ := collector.FindApplicationProfileName(c.dynamicClient, "", "deployment", deployment.Name, deployment.Namespace)
+		deploymentProfile, err := collector.GetApplicationProfile(context.TODO(), c.dynamicClient, "default", deploymentProfileName)
+		if err != nil {
+			t.Fatalf("pass %d: error getting the deployment application profile: %s", pass, err)
+		}
+		if uid := deploymentProfile.GetLabels()[collector.WorkloadUIDLabel]; uid != string(deployment.UID) {
+			t.Errorf("pass %d: expected the deployment profile to have the deployment UID, got %s", pass, uid)
+		}
+		if kind := deploymentProfile.GetLabels()[collector.WorkloadKindLabel]; kind != "deployment" {
+			t.Errorf("pass %d: expected the deployment profile to have the deployment kind, got %s", pass, kind)
+		}
+		if len(deploymentProfile.Spec.Containers) != 1 || !slices.Equal(deploymentProfile.Spec.Containers[0].SysCalls, syscalls) {
+			t.Errorf("pass %d: expected the syscalls %v in the deployment profile, got %+v", pass, syscalls, deploymentProfile.Spec.Containers)
+		}
+	}
+}
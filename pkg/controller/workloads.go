@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/kubescape/kapprofiler/pkg/collector"
+	"github.com/kubescape/kapprofiler/pkg/watcher"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+// Workloads whose operator annotations are passed on to their pods
+var workloadGvrs = map[string]schema.GroupVersionResource{
+	"deployment":  {Group: "apps", Version: "v1", Resource: "deployments"},
+	"replicaset":  {Group: "apps", Version: "v1", Resource: "replicasets"},
+	"statefulset": {Group: "apps", Version: "v1", Resource: "statefulsets"},
+	"daemonset":   {Group: "apps", Version: "v1", Resource: "daemonsets"},
+	"job":         {Group: "batch", Version: "v1", Resource: "jobs"},
+}
+
+func (c *Controller) startWorkloadWatchers() {
+	for kind, gvr := range workloadGvrs {
+		kind, gvr := kind, gvr
+		workloadWatcher := watcher.NewWatcher(c.dynamicClient, false)
+		err := workloadWatcher.Start(watcher.WatchNotifyFunctions{
+			AddFunc: func(obj *unstructured.Unstructured) {
+				c.handleWorkloadAnnotations(kind, gvr, obj)
+			},
+			UpdateFunc: func(obj *unstructured.Unstructured) {
+				c.handleWorkloadAnnotations(kind, gvr, obj)
+			},
+			DeleteFunc: func(obj *unstructured.Unstructured) {},
+		}, gvr, metav1.ListOptions{})
+		if err != nil {
+			log.Printf("Error starting %s watcher %v", kind, err)
+			continue
+		}
+		c.workloadWatchers = append(c.workloadWatchers, workloadWatcher)
+	}
+}
+
+// handleWorkloadAnnotations passes the finalize-now and relearn annotations of a workload on to its pods of the node,
+// where the collector handles them, and applies them to the application profile of the workload. The profile and
+// workload patches are the same on every node.
+func (c *Controller) handleWorkloadAnnotations(kind string, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) {
+	handled := map[string]string{}
+	for _, annotation := range []string{collector.RelearnAnnotation, collector.FinalizeNowAnnotation} {
+		if value, ok := obj.GetAnnotations()[annotation]; ok {
+			handled[annotation] = value
+		}
+	}
+	if len(handled) == 0 {
+		return
+	}
+
+	// Apply the annotations to the application profile of the workload before the pods: the collectors do not record
+	// the pods again while the profile of their workload is final
+	profileName := c.profileNames.Get(obj.GetNamespace(), kind, obj.GetName())
+	profileNamespace := obj.GetNamespace()
+	if c.storeNamespace != "" {
+		profileNamespace = c.storeNamespace
+	}
+	if _, ok := handled[collector.RelearnAnnotation]; ok {
+		if err := collector.UnfinalizeApplicationProfile(c.dynamicClient, profileNamespace, profileName); err != nil {
+			log.Printf("Error unfinalizing ApplicationProfile %s: %v", profileName, err)
+		}
+	}
+	if _, ok := handled[collector.FinalizeNowAnnotation]; ok {
+		if err := collector.SetApplicationProfileFinal(c.dynamicClient, profileNamespace, profileName, collector.FinalizationReasonManual); err != nil {
+			log.Printf("Error finalizing ApplicationProfile %s: %v", profileName, err)
+		}
+	}
+
+	// An empty selector would match every pod of the namespace
+	matchLabels, _, err := unstructured.NestedStringMap(obj.Object, "spec", "selector", "matchLabels")
+	if err == nil && len(matchLabels) > 0 {
+		pods, err := c.staticClient.CoreV1().Pods(obj.GetNamespace()).List(context.TODO(), metav1.ListOptions{LabelSelector: labels.Set(matchLabels).AsSelector().String()})
+		if err != nil {
+			log.Printf("Error listing pods of %s %s/%s: %v", kind, obj.GetNamespace(), obj.GetName(), err)
+			return
+		}
+		patch := annotationsPatch(handled)
+		for _, pod := range pods.Items {
+			// Every node handles the pods it runs, so that the pods are annotated once
+			if pod.Spec.NodeName != c.nodeName {
+				continue
+			}
+			_, err := c.staticClient.CoreV1().Pods(pod.Namespace).Patch(context.TODO(), pod.Name, apitypes.MergePatchType, patch, metav1.PatchOptions{})
+			if err != nil {
+				log.Printf("Error annotating pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			}
+		}
+	}
+
+	// Remove the handled annotations from the workload
+	keys := make([]string, 0, len(handled))
+	for key := range handled {
+		keys = append(keys, key)
+	}
+	_, err = c.dynamicClient.Resource(gvr).Namespace(obj.GetNamespace()).Patch(context.TODO(), obj.GetName(), apitypes.MergePatchType, collector.RemoveAnnotationsPatch(keys...), metav1.PatchOptions{})
+	if err != nil {
+		log.Printf("Error removing annotations %s from %s %s/%s: %v", strings.Join(keys, ","), kind, obj.GetNamespace(), obj.GetName(), err)
+	}
+}
+
+// Helper function to build a merge patch that sets the given annotations
+func annotationsPatch(annotations map[string]string) []byte {
+	values := make([]string, 0, len(annotations))
+	for key, value := range annotations {
+		values = append(values, fmt.Sprintf("%q:%q", key, value))
+	}
+	return []byte(fmt.Sprintf("{\"metadata\":{\"annotations\":{%s}}}", strings.Join(values, ",")))
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/collector"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestHandleWorkloadAnnotationsUnfinalizesBeforePods(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx-0", Namespace: "default", Labels: map[string]string{"app": "nginx"}}, Spec: v1.PodSpec{NodeName: "node-a"}}
+	// The pods of the other nodes are annotated by their controllers
+	otherPod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx-1", Namespace: "default", Labels: map[string]string{"app": "nginx"}}, Spec: v1.PodSpec{NodeName: "node-b"}}
+	c := newTestController(pod, otherPod)
+
+	profileName, _ := collector.FindApplicationProfileName(c.dynamicClient, "", "statefulset", "nginx", "default")
+	profile := &collector.ApplicationProfile{
+		TypeMeta:   metav1.TypeMeta{Kind: collector.ApplicationProfileKind, APIVersion: collector.ApplicationProfileApiVersion},
+		ObjectMeta: metav1.ObjectMeta{Name: profileName, Labels: map[string]string{"kapprofiler.kubescape.io/final": "true"}},
+	}
+	collector.SetApplicationProfileWorkload(profile, "statefulset", "nginx", "default", "")
+	if err := collector.CreateApplicationProfile(context.TODO(), c.dynamicClient, "default", profile); err != nil {
+		t.Fatalf("error creating application profile: %s", err)
+	}
+
+	// The collectors check the workload profile as soon as the pods are annotated
+	patched := 0
+	c.staticClient.(*fake.Clientset).PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patched++
+		profile, err := collector.GetApplicationProfile(context.TODO(), c.dynamicClient, "default", profileName)
+		if err != nil {
+			t.Errorf("error getting application profile: %s", err)
+		} else if _, ok := profile.Labels["kapprofiler.kubescape.io/final"]; ok {
+			t.Errorf("expected the workload profile to be unfinalized before the pods are annotated")
+		}
+		return false, nil, nil
+	})
+
+	statefulSet := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "StatefulSet",
+		"metadata": map[string]interface{}{
+			"name":        "nginx",
+			"namespace":   "default",
+			"annotations": map[string]interface{}{collector.RelearnAnnotation: "true"},
+		},
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "nginx"}},
+		},
+	}}
+	c.handleWorkloadAnnotations("statefulset", workloadGvrs["statefulset"], statefulSet)
+
+	if patched != 1 {
+		t.Fatalf("expected the pod to be annotated once, got %d patches", patched)
+	}
+	annotatedPod, err := c.staticClient.CoreV1().Pods("default").Get(context.TODO(), pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting pod: %s", err)
+	}
+	if _, ok := annotatedPod.Annotations[collector.RelearnAnnotation]; !ok {
+		t.Errorf("expected the %s annotation on the pod, got %v", collector.RelearnAnnotation, annotatedPod.Annotations)
+	}
+	otherPod, err = c.staticClient.CoreV1().Pods("default").Get(context.TODO(), otherPod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting pod: %s", err)
+	}
+	if _, ok := otherPod.Annotations[collector.RelearnAnnotation]; ok {
+		t.Errorf("expected the pod of the other node not to be annotated")
+	}
+}
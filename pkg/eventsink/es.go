@@ -26,6 +26,21 @@ type EventSink struct {
 	networkEventChannel chan *tracing.NetworkEvent
 	networkEventDB      *inmemorymapdb.InMemoryMapDB[*tracing.NetworkEvent]
 
+	fileOperationEventChannel chan *tracing.FileOperationEvent
+	fileOperationEventDB      *inmemorymapdb.InMemoryMapDB[*tracing.FileOperationEvent]
+
+	bindEventChannel chan *tracing.BindEvent
+	bindEventDB      *inmemorymapdb.InMemoryMapDB[*tracing.BindEvent]
+
+	tcpConnectEventChannel chan *tracing.TcpConnectEvent
+	tcpConnectEventDB      *inmemorymapdb.InMemoryMapDB[*tracing.TcpConnectEvent]
+
+	privilegedOperationEventChannel chan *tracing.PrivilegedOperationEvent
+	privilegedOperationEventDB      *inmemorymapdb.InMemoryMapDB[*tracing.PrivilegedOperationEvent]
+
+	signalEventChannel chan *tracing.SignalEvent
+	signalEventDB      *inmemorymapdb.InMemoryMapDB[*tracing.SignalEvent]
+
 	eventFilters []*EventSinkFilter
 }
 
@@ -55,6 +70,21 @@ func (es *EventSink) Start() error {
 	// Create the channel for the network events
 	es.networkEventChannel = make(chan *tracing.NetworkEvent, 10000)
 	es.networkEventDB = inmemorymapdb.NewInMemoryMapDB[*tracing.NetworkEvent](100)
+	// Create the channel for the file operation events
+	es.fileOperationEventChannel = make(chan *tracing.FileOperationEvent, 10000)
+	es.fileOperationEventDB = inmemorymapdb.NewInMemoryMapDB[*tracing.FileOperationEvent](100)
+	// Create the channel for the bind events
+	es.bindEventChannel = make(chan *tracing.BindEvent, 10000)
+	es.bindEventDB = inmemorymapdb.NewInMemoryMapDB[*tracing.BindEvent](100)
+	// Create the channel for the tcp connect events
+	es.tcpConnectEventChannel = make(chan *tracing.TcpConnectEvent, 10000)
+	es.tcpConnectEventDB = inmemorymapdb.NewInMemoryMapDB[*tracing.TcpConnectEvent](100)
+	// Create the channel for the privileged operation events
+	es.privilegedOperationEventChannel = make(chan *tracing.PrivilegedOperationEvent, 10000)
+	es.privilegedOperationEventDB = inmemorymapdb.NewInMemoryMapDB[*tracing.PrivilegedOperationEvent](100)
+	// Create the channel for the signal events
+	es.signalEventChannel = make(chan *tracing.SignalEvent, 10000)
+	es.signalEventDB = inmemorymapdb.NewInMemoryMapDB[*tracing.SignalEvent](100)
 	// Start the execve event worker
 	go es.execveEventWorker()
 
@@ -70,6 +100,21 @@ func (es *EventSink) Start() error {
 	// Start the network event worker
 	go es.networkEventWorker()
 
+	// Start the file operation event worker
+	go es.fileOperationEventWorker()
+
+	// Start the bind event worker
+	go es.bindEventWorker()
+
+	// Start the tcp connect event worker
+	go es.tcpConnectEventWorker()
+
+	// Start the privileged operation event worker
+	go es.privilegedOperationEventWorker()
+
+	// Start the signal event worker
+	go es.signalEventWorker()
+
 	return nil
 }
 
@@ -89,6 +134,21 @@ func (es *EventSink) Stop() error {
 	// Close the channel for network events
 	close(es.networkEventChannel)
 
+	// Close the channel for file operation events
+	close(es.fileOperationEventChannel)
+
+	// Close the channel for bind events
+	close(es.bindEventChannel)
+
+	// Close the channel for tcp connect events
+	close(es.tcpConnectEventChannel)
+
+	// Close the channel for privileged operation events
+	close(es.privilegedOperationEventChannel)
+
+	// Close the channel for signal events
+	close(es.signalEventChannel)
+
 	return nil
 }
 
@@ -103,13 +163,60 @@ func (es *EventSink) AddFilter(filter *EventSinkFilter) {
 }
 
 func (es *EventSink) RemoveFilter(filter *EventSinkFilter) {
-	// Check that it exists
-	for i, f := range es.eventFilters {
+	// Remove the matching filters, AllEventType matches all the filters of the container
+	eventFilters := []*EventSinkFilter{}
+	for _, f := range es.eventFilters {
 		if f.ContainerID == filter.ContainerID && (f.EventType == filter.EventType || filter.EventType == tracing.AllEventType) {
-			es.eventFilters = append(es.eventFilters[:i], es.eventFilters[i+1:]...)
-			return
+			continue
 		}
+		eventFilters = append(eventFilters, f)
+	}
+	es.eventFilters = eventFilters
+}
+
+func (es *EventSink) fileOperationEventWorker() error {
+	for event := range es.fileOperationEventChannel {
+		bucket := fmt.Sprintf("fileoperation-%s-%s-%s", event.Namespace, event.PodName, event.ContainerName)
+		es.fileOperationEventDB.Put(bucket, event)
 	}
+
+	return nil
+}
+
+func (es *EventSink) bindEventWorker() error {
+	for event := range es.bindEventChannel {
+		bucket := fmt.Sprintf("bind-%s-%s-%s", event.Namespace, event.PodName, event.ContainerName)
+		es.bindEventDB.Put(bucket, event)
+	}
+
+	return nil
+}
+
+func (es *EventSink) tcpConnectEventWorker() error {
+	for event := range es.tcpConnectEventChannel {
+		bucket := fmt.Sprintf("tcpconnect-%s-%s-%s", event.Namespace, event.PodName, event.ContainerName)
+		es.tcpConnectEventDB.Put(bucket, event)
+	}
+
+	return nil
+}
+
+func (es *EventSink) privilegedOperationEventWorker() error {
+	for event := range es.privilegedOperationEventChannel {
+		bucket := fmt.Sprintf("privilegedoperation-%s-%s-%s", event.Namespace, event.PodName, event.ContainerName)
+		es.privilegedOperationEventDB.Put(bucket, event)
+	}
+
+	return nil
+}
+
+func (es *EventSink) signalEventWorker() error {
+	for event := range es.signalEventChannel {
+		bucket := fmt.Sprintf("signal-%s-%s-%s", event.Namespace, event.PodName, event.ContainerName)
+		es.signalEventDB.Put(bucket, event)
+	}
+
+	return nil
 }
 
 func (es *EventSink) networkEventWorker() error {
@@ -173,9 +280,49 @@ func (es *EventSink) CleanupContainer(namespace string, podName string, containe
 	bucket = fmt.Sprintf("network-%s-%s-%s", namespace, podName, containerID)
 	es.networkEventDB.Delete(bucket)
 
+	bucket = fmt.Sprintf("signal-%s-%s-%s", namespace, podName, containerID)
+	es.signalEventDB.Delete(bucket)
+
+	bucket = fmt.Sprintf("privilegedoperation-%s-%s-%s", namespace, podName, containerID)
+	es.privilegedOperationEventDB.Delete(bucket)
+
+	bucket = fmt.Sprintf("tcpconnect-%s-%s-%s", namespace, podName, containerID)
+	es.tcpConnectEventDB.Delete(bucket)
+
+	bucket = fmt.Sprintf("bind-%s-%s-%s", namespace, podName, containerID)
+	es.bindEventDB.Delete(bucket)
+
+	bucket = fmt.Sprintf("fileoperation-%s-%s-%s", namespace, podName, containerID)
+	es.fileOperationEventDB.Delete(bucket)
+
 	return nil
 }
 
+func (es *EventSink) GetFileOperationEvents(namespace string, podName string, containerID string) ([]*tracing.FileOperationEvent, error) {
+	bucket := fmt.Sprintf("fileoperation-%s-%s-%s", namespace, podName, containerID)
+	return es.fileOperationEventDB.GetNClean(bucket), nil
+}
+
+func (es *EventSink) GetBindEvents(namespace string, podName string, containerID string) ([]*tracing.BindEvent, error) {
+	bucket := fmt.Sprintf("bind-%s-%s-%s", namespace, podName, containerID)
+	return es.bindEventDB.GetNClean(bucket), nil
+}
+
+func (es *EventSink) GetTcpConnectEvents(namespace string, podName string, containerID string) ([]*tracing.TcpConnectEvent, error) {
+	bucket := fmt.Sprintf("tcpconnect-%s-%s-%s", namespace, podName, containerID)
+	return es.tcpConnectEventDB.GetNClean(bucket), nil
+}
+
+func (es *EventSink) GetPrivilegedOperationEvents(namespace string, podName string, containerID string) ([]*tracing.PrivilegedOperationEvent, error) {
+	bucket := fmt.Sprintf("privilegedoperation-%s-%s-%s", namespace, podName, containerID)
+	return es.privilegedOperationEventDB.GetNClean(bucket), nil
+}
+
+func (es *EventSink) GetSignalEvents(namespace string, podName string, containerID string) ([]*tracing.SignalEvent, error) {
+	bucket := fmt.Sprintf("signal-%s-%s-%s", namespace, podName, containerID)
+	return es.signalEventDB.GetNClean(bucket), nil
+}
+
 func (es *EventSink) GetNetworkEvents(namespace string, podName string, containerID string) ([]*tracing.NetworkEvent, error) {
 	bucket := fmt.Sprintf("network-%s-%s-%s", namespace, podName, containerID)
 	return es.networkEventDB.GetNClean(bucket), nil
@@ -281,6 +428,86 @@ func (es *EventSink) SendNetworkEvent(event *tracing.NetworkEvent) {
 	}
 }
 
+func (es *EventSink) SendFileOperationEvent(event *tracing.FileOperationEvent) {
+	if !es.filterEvents {
+		es.fileOperationEventChannel <- event
+		return
+	} else {
+		// Check that there is a matching filter
+		for _, filter := range es.eventFilters {
+			if filter.ContainerID == event.ContainerID &&
+				(filter.EventType == tracing.AllEventType || filter.EventType == tracing.FileOperationEventType) {
+				es.fileOperationEventChannel <- event
+				return
+			}
+		}
+	}
+}
+
+func (es *EventSink) SendBindEvent(event *tracing.BindEvent) {
+	if !es.filterEvents {
+		es.bindEventChannel <- event
+		return
+	} else {
+		// Check that there is a matching filter
+		for _, filter := range es.eventFilters {
+			if filter.ContainerID == event.ContainerID &&
+				(filter.EventType == tracing.AllEventType || filter.EventType == tracing.BindEventType) {
+				es.bindEventChannel <- event
+				return
+			}
+		}
+	}
+}
+
+func (es *EventSink) SendTcpConnectEvent(event *tracing.TcpConnectEvent) {
+	if !es.filterEvents {
+		es.tcpConnectEventChannel <- event
+		return
+	} else {
+		// Check that there is a matching filter
+		for _, filter := range es.eventFilters {
+			if filter.ContainerID == event.ContainerID &&
+				(filter.EventType == tracing.AllEventType || filter.EventType == tracing.TcpConnectEventType) {
+				es.tcpConnectEventChannel <- event
+				return
+			}
+		}
+	}
+}
+
+func (es *EventSink) SendPrivilegedOperationEvent(event *tracing.PrivilegedOperationEvent) {
+	if !es.filterEvents {
+		es.privilegedOperationEventChannel <- event
+		return
+	} else {
+		// Check that there is a matching filter
+		for _, filter := range es.eventFilters {
+			if filter.ContainerID == event.ContainerID &&
+				(filter.EventType == tracing.AllEventType || filter.EventType == tracing.PrivilegedOperationEventType) {
+				es.privilegedOperationEventChannel <- event
+				return
+			}
+		}
+	}
+}
+
+func (es *EventSink) SendSignalEvent(event *tracing.SignalEvent) {
+	if !es.filterEvents {
+		es.signalEventChannel <- event
+		return
+	} else {
+		// Check that there is a matching filter
+		for _, filter := range es.eventFilters {
+			if filter.ContainerID == event.ContainerID &&
+				(filter.EventType == tracing.AllEventType || filter.EventType == tracing.SignalEventType) {
+				es.signalEventChannel <- event
+				return
+			}
+		}
+	}
+}
+
 func (es *EventSink) ReportError(eventType tracing.EventType, err error) {
 	// There is not a lot we can do here
 	log.Printf("Error reported for event type %d: %s", eventType, err)
@@ -292,6 +519,11 @@ func (es *EventSink) Close() error {
 	es.capabilitiesEventDB.Close()
 	es.dnsEventDB.Close()
 	es.networkEventDB.Close()
+	es.signalEventDB.Close()
+	es.privilegedOperationEventDB.Close()
+	es.tcpConnectEventDB.Close()
+	es.bindEventDB.Close()
+	es.fileOperationEventDB.Close()
 
 	return nil
 }
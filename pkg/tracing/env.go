@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// RedactedValue replaces the values of the redacted environment variables
+	RedactedValue = "<redacted>"
+	// Execs whose environment could not be read between two reports of the count
+	execEnvMissReportInterval = 100
+)
+
+// DefaultExecEnvRedact are the names of the environment variables whose values are redacted by default
+var DefaultExecEnvRedact = []string{"*_TOKEN", "*PASSWORD*", "*SECRET*", "*_KEY", "*APIKEY*", "*CREDENTIAL*", "*_AUTH*", "*_DSN", "DATABASE_URL"}
+
+// URLs with a password in their user info, like the DSNs of databases
+var urlWithPassword = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*://[^/@\s]*:[^/@\s]*@`)
+
+// ExecEnvConfig selects the environment variables captured for the execs. The names are matched against shell
+// patterns, ignoring case. Variables are captured if they match an allow pattern, or if there are none, and match
+// no deny pattern. The values of the variables matching a redact pattern, and the URLs with a password, are replaced
+// with RedactedValue.
+type ExecEnvConfig struct {
+	Capture bool
+	Allow   []string
+	Deny    []string
+	Redact  []string
+}
+
+func matchesEnvName(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToUpper(pattern), strings.ToUpper(name)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// filterEnv applies the allow, deny and redact patterns to an environment, returned sorted by name.
+func (config *ExecEnvConfig) filterEnv(env []string) []string {
+	filtered := []string{}
+	for _, variable := range env {
+		name, value, found := strings.Cut(variable, "=")
+		if !found || name == "" {
+			continue
+		}
+		if len(config.Allow) > 0 && !matchesEnvName(config.Allow, name) {
+			continue
+		}
+		if matchesEnvName(config.Deny, name) {
+			continue
+		}
+		if matchesEnvName(config.Redact, name) || urlWithPassword.MatchString(value) {
+			variable = name + "=" + RedactedValue
+		}
+		filtered = append(filtered, variable)
+	}
+	sort.Strings(filtered)
+	return filtered
+}
@@ -1,5 +1,7 @@
 package tracing
 
+import "fmt"
+
 const (
 	ContainerActivityEventStart    = "start"
 	ContainerActivityEventAttached = "attached"
@@ -16,8 +18,52 @@ const (
 	NetworkEventType
 	SyscallEventType
 	AllEventType
+	FileOperationEventType
+	BindEventType
+	TcpConnectEventType
+	PrivilegedOperationEventType
+	SignalEventType
 )
 
+// Event types that are traced per container, AllEventType stands for all of them
+var ContainerEventTypes = []EventType{NetworkEventType, DnsEventType, ExecveEventType, CapabilitiesEventType, OpenEventType, FileOperationEventType, BindEventType, TcpConnectEventType, PrivilegedOperationEventType, SignalEventType}
+
+// Event types that are traced per container when none are selected. File operations are recorded from all the
+// syscalls of the containers, they are only traced on demand.
+var DefaultEventTypes = []EventType{NetworkEventType, DnsEventType, ExecveEventType, CapabilitiesEventType, OpenEventType, BindEventType, TcpConnectEventType, PrivilegedOperationEventType, SignalEventType}
+
+var eventTypeNames = map[EventType]string{
+	ExecveEventType:              "exec",
+	OpenEventType:                "open",
+	CapabilitiesEventType:        "capabilities",
+	DnsEventType:                 "dns",
+	NetworkEventType:             "network",
+	SyscallEventType:             "syscall",
+	AllEventType:                 "all",
+	FileOperationEventType:       "file-operations",
+	BindEventType:                "bind",
+	TcpConnectEventType:          "tcp",
+	PrivilegedOperationEventType: "privileged",
+	SignalEventType:              "signal",
+}
+
+func (eventType EventType) String() string {
+	if name, ok := eventTypeNames[eventType]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(eventType))
+}
+
+// ParseEventType returns the event type of a name returned by EventType.String
+func ParseEventType(name string) (EventType, error) {
+	for eventType, eventTypeName := range eventTypeNames {
+		if eventTypeName == name {
+			return eventType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown event type %q", name)
+}
+
 type ContainerActivityEventListener interface {
 	// OnContainerActivityEvent is called when a container activity event is received
 	OnContainerActivityEvent(event *ContainerActivityEvent)
@@ -26,12 +72,14 @@ type ContainerActivityEventListener interface {
 type ContainerActivityEvent struct {
 	ContainerName string
 	PodName       string
+	PodUID        string
 	Namespace     string
 	Activity      string
 	// Low level container information
 	ContainerID string
 	NsMntId     uint64
 	Pid         uint32
+	ImageDigest string
 }
 
 type ProcessDetails struct {
@@ -60,6 +108,8 @@ type ExecveEvent struct {
 	PathName string
 	Args     []string
 	Env      []string
+	// Executable of the parent process when the exec was traced, empty if it was not found
+	ParentPathName string
 }
 
 type OpenEvent struct {
@@ -69,6 +119,8 @@ type OpenEvent struct {
 	TaskId   uint32
 	PathName string
 	Flags    []string
+	// Executable of the process that opened the file, empty if it was not found
+	ExePath string
 }
 
 type CapabilitiesEvent struct {
@@ -94,6 +146,67 @@ type NetworkEvent struct {
 	DstEndpoint string
 }
 
+type FileOperationEvent struct {
+	GeneralEvent
+
+	// One of the FileOperation constants
+	Operation string
+	Syscall   string
+	// Absolute path operated on, empty if it was not read
+	Path string
+}
+
+type BindEvent struct {
+	GeneralEvent
+
+	Protocol string
+	Address  string
+	Port     uint16
+	// Executable of the process that bound the socket, empty if it was not found
+	ExePath string
+}
+
+type TcpConnectEvent struct {
+	GeneralEvent
+
+	DstAddress string
+	DstPort    uint16
+	// Whether the connection got established
+	Success bool
+	// Executable of the process that connected, empty if it was not found
+	ExePath string
+}
+
+type PrivilegedOperationEvent struct {
+	GeneralEvent
+
+	// One of the PrivilegedOperation constants
+	Operation string
+	Syscall   string
+	// Namespaces created by unshare or entered by setns, separated by commas
+	Namespaces string
+	// Ids set by setuid and setgid, in the order of the syscall arguments and -1 for the ones left unchanged
+	TargetIds string
+	// Source, target and filesystem type of the mounts, only the target is set for the umounts. The target of
+	// pivot_root is the new root and the source the directory the old root is moved to.
+	Source string
+	Target string
+	FsType string
+	// Executable of the process, empty if it was not found
+	ExePath string
+}
+
+type SignalEvent struct {
+	GeneralEvent
+
+	Signal string
+	// Pid of the target in the pid namespace of the sender
+	TargetPid uint32
+	// Executables of the sender and of the target, empty if they were not found
+	ExePath       string
+	TargetExePath string
+}
+
 type SyscallEvent struct {
 	GeneralEvent
 
@@ -111,6 +224,16 @@ type EventSink interface {
 	SendDnsEvent(event *DnsEvent)
 	// SendNetworkEvent sends a Network event to the sink
 	SendNetworkEvent(event *NetworkEvent)
+	// SendFileOperationEvent sends a file operation event to the sink
+	SendFileOperationEvent(event *FileOperationEvent)
+	// SendBindEvent sends a bind event to the sink
+	SendBindEvent(event *BindEvent)
+	// SendTcpConnectEvent sends a TCP connect event to the sink
+	SendTcpConnectEvent(event *TcpConnectEvent)
+	// SendPrivilegedOperationEvent sends a privileged operation event to the sink
+	SendPrivilegedOperationEvent(event *PrivilegedOperationEvent)
+	// SendSignalEvent sends a signal event to the sink
+	SendSignalEvent(event *SignalEvent)
 	// ReportError reports an error to the sink
 	ReportError(eventType EventType, err error)
 }
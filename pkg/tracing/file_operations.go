@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"path/filepath"
+
+	tracertraceloopType "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/traceloop/types"
+)
+
+// Operations of the file operation events
+const (
+	FileOperationUnlink = "unlink"
+	FileOperationRmdir  = "rmdir"
+	FileOperationRename = "rename"
+	FileOperationChmod  = "chmod"
+	FileOperationChown  = "chown"
+	FileOperationMkdir  = "mkdir"
+	FileOperationWrite  = "write"
+)
+
+// Flag of unlinkat removing a directory
+const atRemoveDir = 0x200
+
+// Flags of the opens that write to a file: O_WRONLY, O_RDWR, O_CREAT and O_TRUNC
+const openWriteFlags = 0x243
+
+// Syscalls of the file operations, by the operation they perform
+var fileOperationSyscalls = map[string]string{
+	"unlink":    FileOperationUnlink,
+	"unlinkat":  FileOperationUnlink,
+	"rmdir":     FileOperationRmdir,
+	"rename":    FileOperationRename,
+	"renameat":  FileOperationRename,
+	"renameat2": FileOperationRename,
+	"chmod":     FileOperationChmod,
+	"fchmod":    FileOperationChmod,
+	"fchmodat":  FileOperationChmod,
+	"fchmodat2": FileOperationChmod,
+	"chown":     FileOperationChown,
+	"fchown":    FileOperationChown,
+	"lchown":    FileOperationChown,
+	"fchownat":  FileOperationChown,
+	"mkdir":     FileOperationMkdir,
+	"mkdirat":   FileOperationMkdir,
+	"open":      FileOperationWrite,
+	"openat":    FileOperationWrite,
+	"creat":     FileOperationWrite,
+	"truncate":  FileOperationWrite,
+	"ftruncate": FileOperationWrite,
+}
+
+// Parameters of the flags of the opens, only the opens that can write to a file are file operations
+var openFlagsParams = map[string]int{
+	"open":   1,
+	"openat": 2,
+}
+
+// fileOperation returns the operation of a successful file operation syscall recorded by traceloop, with the path
+// it operates on. Traceloop only reads the paths of mkdir, open and openat, and the paths relative to the working
+// directory or to a directory descriptor are not resolved, so the path is empty for the other syscalls and for the
+// relative paths. The operation is empty for the other syscalls, the failed ones and the ones whose parameters were
+// not recorded.
+func fileOperation(event *tracertraceloopType.Event) (operation string, path string) {
+	operation, ok := fileOperationSyscalls[event.Syscall]
+	if !ok || !syscallSucceeded(event) || len(event.Parameters) == 0 {
+		return "", ""
+	}
+	if flagsParam, ok := openFlagsParams[event.Syscall]; ok {
+		if flags, ok := syscallParam(event, flagsParam); !ok || flags&openWriteFlags == 0 {
+			return "", ""
+		}
+	}
+	if event.Syscall == "unlinkat" {
+		if flags, ok := syscallParam(event, 2); ok && flags&atRemoveDir != 0 {
+			operation = FileOperationRmdir
+		}
+	}
+
+	for i := range event.Parameters {
+		if content := syscallParamContent(event, i); filepath.IsAbs(content) {
+			return operation, filepath.Clean(content)
+		}
+	}
+	return operation, ""
+}
@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"testing"
+
+	tracertraceloopType "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/traceloop/types"
+)
+
+// traceloopEvent returns a syscall recorded by traceloop with the values of its parameters and the content of the
+// first one
+func traceloopEvent(syscall string, retval string, content string, values ...string) *tracertraceloopType.Event {
+	event := &tracertraceloopType.Event{Syscall: syscall, Retval: retval}
+	for i, value := range values {
+		parameter := tracertraceloopType.SyscallParam{Value: value}
+		if i == 0 && content != "" {
+			parameter.Content = &content
+		}
+		event.Parameters = append(event.Parameters, parameter)
+	}
+	return event
+}
+
+func TestFileOperation(t *testing.T) {
+	tests := []struct {
+		name      string
+		event     *tracertraceloopType.Event
+		operation string
+		path      string
+	}{
+		{"mkdir", traceloopEvent("mkdir", "0", "/var/cache/../cache/nginx", "0x7ffd", "448"), FileOperationMkdir, "/var/cache/nginx"},
+		{"relative path", traceloopEvent("mkdir", "0", "cache", "0x7ffd", "448"), FileOperationMkdir, ""},
+		{"unlink", traceloopEvent("unlink", "0", "", "0x7ffd"), FileOperationUnlink, ""},
+		{"directory removal", traceloopEvent("unlinkat", "0", "", "18446744073709551516", "0x7ffd", "512"), FileOperationRmdir, ""},
+		{"write open", traceloopEvent("open", "3", "/var/log/app.log", "0x7ffd", "577", "420"), FileOperationWrite, "/var/log/app.log"},
+		{"read only open", traceloopEvent("open", "3", "/etc/passwd", "0x7ffd", "524288", "0"), "", ""},
+		{"ftruncate", traceloopEvent("ftruncate", "0", "", "3", "0"), FileOperationWrite, ""},
+		{"failed", traceloopEvent("chmod", "-1 (operation not permitted)", "", "0x7ffd", "420"), "", ""},
+		{"unfinished", traceloopEvent("chmod", "unfinished", "", "0x7ffd", "420"), "", ""},
+		{"parameters not recorded", traceloopEvent("chmod", "0", ""), "", ""},
+		{"other syscall", traceloopEvent("read", "0", "", "3", "0x7ffd", "4096"), "", ""},
+	}
+	for _, test := range tests {
+		operation, path := fileOperation(test.event)
+		if operation != test.operation || path != test.path {
+			t.Errorf("%s: expected %s %q, got %s %q", test.name, test.operation, test.path, operation, path)
+		}
+	}
+}
+
+func TestSyscallRecorderReport(t *testing.T) {
+	recorded := map[EventType][]string{}
+	recorder := &syscallRecorder{callbacks: map[EventType]func(event *tracertraceloopType.Event){}, containers: map[uint32]*recordedContainer{}}
+	for _, eventType := range []EventType{FileOperationEventType, PrivilegedOperationEventType} {
+		eventType := eventType
+		recorder.tracerFor(eventType, func(event *tracertraceloopType.Event) {
+			recorded[eventType] = append(recorded[eventType], event.Syscall)
+		})
+	}
+
+	container := &recordedContainer{eventTypes: map[EventType]bool{FileOperationEventType: true}}
+	recorder.report(container, []*tracertraceloopType.Event{{Syscall: "mkdir"}, {Syscall: "setuid"}})
+	if len(recorded[FileOperationEventType]) != 2 || len(recorded[PrivilegedOperationEventType]) != 0 {
+		t.Errorf("expected the syscalls to be reported to the file operations only, got %v", recorded)
+	}
+
+	// An event type that is closed no longer gets the syscalls of the containers
+	container.eventTypes[PrivilegedOperationEventType] = true
+	recorder.close(FileOperationEventType)
+	recorder.report(container, []*tracertraceloopType.Event{{Syscall: "setuid"}})
+	if len(recorded[FileOperationEventType]) != 2 || len(recorded[PrivilegedOperationEventType]) != 1 {
+		t.Errorf("expected the syscall to be reported to the privileged operations only, got %v", recorded)
+	}
+}
@@ -3,19 +3,31 @@ package tracing
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/cilium/ebpf"
 	tracerseccomp "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/advise/seccomp/tracer"
+	tracerbind "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/bind/tracer"
+	tracerbindtype "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/bind/types"
 	tracercapabilities "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/capabilities/tracer"
 	tracercapabilitiestype "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/capabilities/types"
 	tracerdns "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/dns/tracer"
 	tracerdnstype "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/dns/types"
 	tracerexec "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/exec/tracer"
 	tracerexectype "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/exec/types"
+	tracermount "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/mount/tracer"
+	tracermounttype "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/mount/types"
 	tracernetwork "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/network/tracer"
 	tracernetworktype "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/network/types"
 	traceropen "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/open/tracer"
 	traceropentype "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/open/types"
+	tracersignal "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/signal/tracer"
+	tracersignaltype "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/signal/types"
+	tracertcp "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/tcp/tracer"
+	tracertcptype "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/tcp/types"
+	tracertcpconnect "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/tcpconnect/tracer"
+	tracertcpconnecttype "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/tcpconnect/types"
+	tracertraceloopType "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/traceloop/types"
 	tracercollection "github.com/inspektor-gadget/inspektor-gadget/pkg/tracer-collection"
 	eventtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/utils/host"
@@ -27,6 +39,10 @@ const openTraceName = "trace_open"
 const capabilitiesTraceName = "trace_capabilities"
 const dnsTraceName = "trace_dns"
 const networkTraceName = "trace_network"
+const bindTraceName = "trace_bind"
+const tcpConnectTraceName = "trace_tcpconnect"
+const privilegedTraceName = "trace_privileged"
+const signalTraceName = "trace_signal"
 
 func createEbpfMountNsMap(tracerId string) (*ebpf.Map, error) {
 	mntnsSpec := &ebpf.MapSpec{
@@ -83,9 +99,75 @@ func (t *Tracer) startAppBehaviorTracing() error {
 		return err
 	}
 
+	// Start tracing bind
+	err = t.startBindTracing()
+	if err != nil {
+		log.Printf("error starting bind tracing: %s\n", err)
+		return err
+	}
+
+	// Start tracing tcp connects
+	err = t.startTcpConnectTracing()
+	if err != nil {
+		log.Printf("error starting tcp connect tracing: %s\n", err)
+		return err
+	}
+
+	// Start tracing privileged operations
+	err = t.startPrivilegedOperationsTracing()
+	if err != nil {
+		log.Printf("error starting privileged operations tracing: %s\n", err)
+		return err
+	}
+
+	// Start tracing signals
+	err = t.startSignalTracing()
+	if err != nil {
+		log.Printf("error starting signal tracing: %s\n", err)
+		return err
+	}
+
+	// Start tracing file operations, they are optional as they depend on the syscall definitions of tracefs
+	err = t.startFileOperationsTracing()
+	if err != nil {
+		log.Printf("error starting file operations tracing, file operations are not traced: %s\n", err)
+	}
+
+	return nil
+}
+
+func (t *Tracer) startFileOperationsTracing() error {
+	recorder, err := t.getSyscallRecorder()
+	if err != nil {
+		log.Printf("error creating tracer: %s\n", err)
+		return err
+	}
+
+	t.tracingStateMutex.Lock()
+	t.tracingState[FileOperationEventType] = TracingState{
+		usageReferenceCount:    make(map[uint64]int),
+		eBpfContainerFilterMap: nil,
+		gadget:                 nil,
+		attachable:             recorder.tracerFor(FileOperationEventType, t.fileOperationEventCallback),
+	}
+	t.tracingStateMutex.Unlock()
+
 	return nil
 }
 
+// getSyscallRecorder returns the syscall recorder shared by the event types found from the syscalls, it is created
+// by the first one
+func (t *Tracer) getSyscallRecorder() (*syscallRecorder, error) {
+	if t.syscallRecorder == nil {
+		recorder, err := newSyscallRecorder(t.cCollection)
+		if err != nil {
+			return nil, err
+		}
+		t.syscallRecorder = recorder
+	}
+	return t.syscallRecorder, nil
+}
+
 func (t *Tracer) startNetworkTracing() error {
 	//host.Init(host.Config{AutoMountFilesystems: true})
 
@@ -134,6 +216,127 @@ func (t *Tracer) startCapabilitiesTracing() error {
 	return nil
 }
 
+func (t *Tracer) startBindTracing() error {
+	// Create nsmount map to filter by containers
+	bindMountnsmap, err := createEbpfMountNsMap(bindTraceName)
+	if err != nil {
+		log.Printf("error creating mountnsmap: %s\n", err)
+		return err
+	}
+
+	tracerBind, err := tracerbind.NewTracer(&tracerbind.Config{MountnsMap: bindMountnsmap, IgnoreErrors: true}, t.cCollection, t.bindEventCallback)
+	if err != nil {
+		log.Printf("error creating tracer: %s\n", err)
+		return err
+	}
+
+	t.tracingStateMutex.Lock()
+	t.tracingState[BindEventType] = TracingState{
+		usageReferenceCount:    make(map[uint64]int),
+		eBpfContainerFilterMap: bindMountnsmap,
+		gadget:                 tracerBind,
+		attachable:             nil,
+	}
+	t.tracingStateMutex.Unlock()
+
+	return nil
+}
+
+func (t *Tracer) startTcpConnectTracing() error {
+	// Create nsmount map to filter by containers, it is shared by the connect and the connection tracers
+	tcpConnectMountnsmap, err := createEbpfMountNsMap(tcpConnectTraceName)
+	if err != nil {
+		log.Printf("error creating mountnsmap: %s\n", err)
+		return err
+	}
+
+	t.tcpConnects = newTcpConnects(t.tcpConnectEventCallback)
+	tracerTcpConnect, err := tracertcpconnect.NewTracer(&tracertcpconnect.Config{MountnsMap: tcpConnectMountnsmap}, t.cCollection, t.tcpConnectAttemptCallback)
+	if err != nil {
+		log.Printf("error creating tracer: %s\n", err)
+		return err
+	}
+	tracerTcp, err := tracertcp.NewTracer(&tracertcp.Config{MountnsMap: tcpConnectMountnsmap}, t.cCollection, t.tcpEventCallback)
+	if err != nil {
+		tracerTcpConnect.Stop()
+		log.Printf("error creating tracer: %s\n", err)
+		return err
+	}
+	tracer := &tcpConnectTracer{connectTracer: tracerTcpConnect, tcpTracer: tracerTcp, connects: t.tcpConnects, done: make(chan struct{})}
+	go tracer.run()
+
+	t.tracingStateMutex.Lock()
+	t.tracingState[TcpConnectEventType] = TracingState{
+		usageReferenceCount:    make(map[uint64]int),
+		eBpfContainerFilterMap: tcpConnectMountnsmap,
+		gadget:                 tracer,
+		attachable:             nil,
+	}
+	t.tracingStateMutex.Unlock()
+
+	return nil
+}
+
+func (t *Tracer) startPrivilegedOperationsTracing() error {
+	// Create nsmount map to filter by containers
+	privilegedMountnsmap, err := createEbpfMountNsMap(privilegedTraceName)
+	if err != nil {
+		log.Printf("error creating mountnsmap: %s\n", err)
+		return err
+	}
+
+	tracerMount, err := tracermount.NewTracer(&tracermount.Config{MountnsMap: privilegedMountnsmap}, t.cCollection, t.mountEventCallback)
+	if err != nil {
+		log.Printf("error creating tracer: %s\n", err)
+		return err
+	}
+	// The other operations are found from the recorded syscalls, they are optional as they depend on the syscall
+	// definitions of tracefs
+	var tracerSyscalls AtachableTracer
+	if recorder, err := t.getSyscallRecorder(); err != nil {
+		log.Printf("error creating tracer, only the mounts are traced as privileged operations: %s\n", err)
+	} else {
+		tracerSyscalls = recorder.tracerFor(PrivilegedOperationEventType, t.privilegedOperationEventCallback)
+	}
+
+	t.tracingStateMutex.Lock()
+	t.tracingState[PrivilegedOperationEventType] = TracingState{
+		usageReferenceCount:    make(map[uint64]int),
+		eBpfContainerFilterMap: privilegedMountnsmap,
+		gadget:                 tracerMount,
+		attachable:             tracerSyscalls,
+	}
+	t.tracingStateMutex.Unlock()
+
+	return nil
+}
+
+func (t *Tracer) startSignalTracing() error {
+	// Create nsmount map to filter by containers
+	signalMountnsmap, err := createEbpfMountNsMap(signalTraceName)
+	if err != nil {
+		log.Printf("error creating mountnsmap: %s\n", err)
+		return err
+	}
+
+	tracerSignal, err := tracersignal.NewTracer(&tracersignal.Config{MountnsMap: signalMountnsmap}, t.cCollection, t.signalEventCallback)
+	if err != nil {
+		log.Printf("error creating tracer: %s\n", err)
+		return err
+	}
+
+	t.tracingStateMutex.Lock()
+	t.tracingState[SignalEventType] = TracingState{
+		usageReferenceCount:    make(map[uint64]int),
+		eBpfContainerFilterMap: signalMountnsmap,
+		gadget:                 tracerSignal,
+		attachable:             nil,
+	}
+	t.tracingStateMutex.Unlock()
+
+	return nil
+}
+
 func (t *Tracer) startDnsTracing() error {
 	host.Init(host.Config{AutoMountFilesystems: true})
 
@@ -279,6 +482,220 @@ func (t *Tracer) capabilitiesEventCallback(event *tracercapabilitiestype.Event)
 	}
 }
 
+func (t *Tracer) fileOperationEventCallback(event *tracertraceloopType.Event) {
+	operation, path := fileOperation(event)
+	if operation == "" {
+		return
+	}
+	fileOperationEvent := &FileOperationEvent{
+		GeneralEvent: GeneralEvent{
+			ProcessDetails: ProcessDetails{
+				Pid:  event.Pid,
+				Comm: event.Comm,
+			},
+			ContainerName: event.K8s.ContainerName,
+			ContainerID:   event.Runtime.ContainerID,
+			PodName:       event.K8s.PodName,
+			Namespace:     event.K8s.Namespace,
+			MountNsID:     event.MountNsID,
+			Timestamp:     int64(event.Timestamp),
+			EventType:     FileOperationEventType,
+		},
+		Operation: operation,
+		Syscall:   event.Syscall,
+		Path:      path,
+	}
+	for _, eventSink := range t.eventSinks {
+		eventSink.SendFileOperationEvent(fileOperationEvent)
+	}
+}
+
+func (t *Tracer) bindEventCallback(event *tracerbindtype.Event) {
+	if event.Type == eventtypes.NORMAL {
+		bindEvent := &BindEvent{
+			GeneralEvent: GeneralEvent{
+				ProcessDetails: ProcessDetails{
+					Pid:  event.Pid,
+					Comm: event.Comm,
+					Uid:  event.Uid,
+					Gid:  event.Gid,
+				},
+				ContainerName: event.K8s.ContainerName,
+				ContainerID:   event.Runtime.ContainerID,
+				PodName:       event.K8s.PodName,
+				Namespace:     event.K8s.Namespace,
+				MountNsID:     event.MountNsID,
+				Timestamp:     int64(event.Timestamp),
+				EventType:     BindEventType,
+			},
+			Protocol: event.Protocol,
+			Address:  event.Addr,
+			Port:     event.Port,
+			ExePath:  t.exeCache.get(event.Pid, event.Comm),
+		}
+		for _, eventSink := range t.eventSinks {
+			eventSink.SendBindEvent(bindEvent)
+		}
+	} else if event.Type == eventtypes.ERR {
+		for _, eventSink := range t.eventSinks {
+			eventSink.ReportError(BindEventType, fmt.Errorf("bind ebpf error: %s", event.Message))
+		}
+	}
+}
+
+func (t *Tracer) tcpConnectAttemptCallback(event *tracertcpconnecttype.Event) {
+	if event.Type == eventtypes.NORMAL {
+		tcpConnectEvent := &TcpConnectEvent{
+			GeneralEvent: GeneralEvent{
+				ProcessDetails: ProcessDetails{
+					Pid:  event.Pid,
+					Comm: event.Comm,
+					Uid:  event.Uid,
+					Gid:  event.Gid,
+				},
+				ContainerName: event.K8s.ContainerName,
+				ContainerID:   event.Runtime.ContainerID,
+				PodName:       event.K8s.PodName,
+				Namespace:     event.K8s.Namespace,
+				MountNsID:     event.MountNsID,
+				Timestamp:     int64(event.Timestamp),
+				EventType:     TcpConnectEventType,
+			},
+			DstAddress: event.DstEndpoint.Addr,
+			DstPort:    event.DstEndpoint.Port,
+			ExePath:    t.exeCache.get(event.Pid, event.Comm),
+		}
+		t.tcpConnects.connected(tcpConnectTuple(event.SrcEndpoint, event.DstEndpoint), tcpConnectEvent, time.Now())
+	} else if event.Type == eventtypes.ERR {
+		for _, eventSink := range t.eventSinks {
+			eventSink.ReportError(TcpConnectEventType, fmt.Errorf("tcpconnect ebpf error: %s", event.Message))
+		}
+	}
+}
+
+func (t *Tracer) tcpEventCallback(event *tracertcptype.Event) {
+	if event.Type == eventtypes.NORMAL && event.Operation == "connect" {
+		t.tcpConnects.establish(tcpConnectTuple(event.SrcEndpoint, event.DstEndpoint), time.Now())
+	} else if event.Type == eventtypes.ERR {
+		for _, eventSink := range t.eventSinks {
+			eventSink.ReportError(TcpConnectEventType, fmt.Errorf("tcp ebpf error: %s", event.Message))
+		}
+	}
+}
+
+func (t *Tracer) tcpConnectEventCallback(event *TcpConnectEvent) {
+	for _, eventSink := range t.eventSinks {
+		eventSink.SendTcpConnectEvent(event)
+	}
+}
+
+func (t *Tracer) mountEventCallback(event *tracermounttype.Event) {
+	if event.Type == eventtypes.NORMAL && event.Retval == 0 {
+		privilegedOperationEvent := &PrivilegedOperationEvent{
+			GeneralEvent: GeneralEvent{
+				ProcessDetails: ProcessDetails{
+					Pid:  event.Pid,
+					Comm: event.Comm,
+				},
+				ContainerName: event.K8s.ContainerName,
+				ContainerID:   event.Runtime.ContainerID,
+				PodName:       event.K8s.PodName,
+				Namespace:     event.K8s.Namespace,
+				MountNsID:     event.MountNsID,
+				Timestamp:     int64(event.Timestamp),
+				EventType:     PrivilegedOperationEventType,
+			},
+			Operation: event.Operation,
+			Syscall:   event.Operation,
+			Source:    event.Source,
+			Target:    event.Target,
+			FsType:    event.Fs,
+			ExePath:   t.exeCache.get(event.Pid, event.Comm),
+		}
+		for _, eventSink := range t.eventSinks {
+			eventSink.SendPrivilegedOperationEvent(privilegedOperationEvent)
+		}
+	} else if event.Type == eventtypes.ERR {
+		for _, eventSink := range t.eventSinks {
+			eventSink.ReportError(PrivilegedOperationEventType, fmt.Errorf("mount ebpf error: %s", event.Message))
+		}
+	}
+}
+
+func (t *Tracer) privilegedOperationEventCallback(event *tracertraceloopType.Event) {
+	operation, namespaces, targetIds := privilegedOperation(event)
+	if operation == "" {
+		return
+	}
+	privilegedOperationEvent := &PrivilegedOperationEvent{
+		GeneralEvent: GeneralEvent{
+			ProcessDetails: ProcessDetails{
+				Pid:  event.Pid,
+				Comm: event.Comm,
+			},
+			ContainerName: event.K8s.ContainerName,
+			ContainerID:   event.Runtime.ContainerID,
+			PodName:       event.K8s.PodName,
+			Namespace:     event.K8s.Namespace,
+			MountNsID:     event.MountNsID,
+			Timestamp:     int64(event.Timestamp),
+			EventType:     PrivilegedOperationEventType,
+		},
+		Operation:  operation,
+		Syscall:    event.Syscall,
+		Namespaces: namespaces,
+		TargetIds:  targetIds,
+		ExePath:    t.exeCache.get(event.Pid, event.Comm),
+	}
+	if operation == PrivilegedOperationPivotRoot {
+		// Traceloop reads both paths of pivot_root, the new root and the directory the old root is moved to
+		privilegedOperationEvent.Target = syscallParamContent(event, 0)
+		privilegedOperationEvent.Source = syscallParamContent(event, 1)
+	}
+	for _, eventSink := range t.eventSinks {
+		eventSink.SendPrivilegedOperationEvent(privilegedOperationEvent)
+	}
+}
+
+func (t *Tracer) signalEventCallback(event *tracersignaltype.Event) {
+	// Only the delivered signals are recorded, signal 0 has no name as it only checks that the target exists
+	if event.Type == eventtypes.NORMAL && event.Retval == 0 && event.Signal != "" {
+		signalEvent := &SignalEvent{
+			GeneralEvent: GeneralEvent{
+				ProcessDetails: ProcessDetails{
+					Pid:  event.Pid,
+					Comm: event.Comm,
+					Uid:  event.Uid,
+					Gid:  event.Gid,
+				},
+				ContainerName: event.K8s.ContainerName,
+				ContainerID:   event.Runtime.ContainerID,
+				PodName:       event.K8s.PodName,
+				Namespace:     event.K8s.Namespace,
+				MountNsID:     event.MountNsID,
+				Timestamp:     int64(event.Timestamp),
+				EventType:     SignalEventType,
+			},
+			Signal:    event.Signal,
+			TargetPid: event.TargetPid,
+			ExePath:   t.exeCache.get(event.Pid, event.Comm),
+		}
+		// Signals sent to process groups have no single target, and a killed target may already be gone
+		if int32(event.TargetPid) > 0 {
+			if targetExePath, err := readNamespacedProcessExe(event.Pid, event.TargetPid); err == nil {
+				signalEvent.TargetExePath = targetExePath
+			}
+		}
+		for _, eventSink := range t.eventSinks {
+			eventSink.SendSignalEvent(signalEvent)
+		}
+	} else if event.Type == eventtypes.ERR {
+		for _, eventSink := range t.eventSinks {
+			eventSink.ReportError(SignalEventType, fmt.Errorf("signal ebpf error: %s", event.Message))
+		}
+	}
+}
+
 func (t *Tracer) openEventCallback(event *traceropentype.Event) {
 	if event.Type == eventtypes.NORMAL && event.Ret > -1 {
 		openEvent := &OpenEvent{
@@ -301,6 +718,7 @@ func (t *Tracer) openEventCallback(event *traceropentype.Event) {
 			TaskName: event.Comm,
 			TaskId:   event.Pid,
 			Flags:    event.Flags,
+			ExePath:  t.exeCache.get(event.Pid, event.Comm),
 		}
 		for _, eventSink := range t.eventSinks {
 			eventSink.SendOpenEvent(openEvent)
@@ -336,6 +754,20 @@ func (t *Tracer) execEventCallback(event *tracerexectype.Event) {
 			Args:     event.Args[1:],
 			Env:      []string{},
 		}
+		// The parent usually still runs, the collector falls back to it for the parents it did not see executing
+		if parentPathName, err := readProcessExe(event.Ppid); err == nil {
+			execveEvent.ParentPathName = parentPathName
+		}
+		if t.execEnvConfig != nil && t.execEnvConfig.Capture {
+			// The environment is read after the exec, a process that already exited is reported without it
+			if env, err := readProcessEnv(event.Pid); err == nil {
+				execveEvent.Env = t.execEnvConfig.filterEnv(env)
+			} else if misses := t.execEnvMisses.Add(1); misses == 1 || misses%execEnvMissReportInterval == 0 {
+				for _, eventSink := range t.eventSinks {
+					eventSink.ReportError(ExecveEventType, fmt.Errorf("could not read the environment of %d execs, the processes exited first: %w", misses, err))
+				}
+			}
+		}
 		for _, eventSink := range t.eventSinks {
 			eventSink.SendExecveEvent(execveEvent)
 		}
@@ -351,7 +783,7 @@ func (t *Tracer) startExecTracing() error {
 	execMountnsmap, err := createEbpfMountNsMap(execTraceName)
 
 	// Create the exec tracer
-	tracerExec, err := tracerexec.NewTracer(&tracerexec.Config{MountnsMap: execMountnsmap}, t.cCollection, t.execEventCallback)
+	tracerExec, err := tracerexec.NewTracer(&tracerexec.Config{MountnsMap: execMountnsmap, GetCwd: true}, t.cCollection, t.execEventCallback)
 	if err != nil {
 		log.Printf("error creating tracer: %s\n", err)
 		return err
@@ -416,6 +848,27 @@ func (t *Tracer) stopAppBehaviorTracing() error {
 	if err = t.stopNetworkTracing(); err != nil {
 		log.Printf("error stopping network tracing: %s\n", err)
 	}
+	// Stop bind tracer
+	if err = t.stopBindTracing(); err != nil {
+		log.Printf("error stopping bind tracing: %s\n", err)
+	}
+	// Stop tcp connect tracer
+	if err = t.stopTcpConnectTracing(); err != nil {
+		log.Printf("error stopping tcp connect tracing: %s\n", err)
+	}
+	// Stop privileged operations tracer
+	if err = t.stopPrivilegedOperationsTracing(); err != nil {
+		log.Printf("error stopping privileged operations tracing: %s\n", err)
+	}
+	// Stop signal tracer
+	if err = t.stopSignalTracing(); err != nil {
+		log.Printf("error stopping signal tracing: %s\n", err)
+	}
+	// Stop file operations tracer
+	if err = t.stopFileOperationsTracing(); err != nil {
+		log.Printf("error stopping file operations tracing: %s\n", err)
+	}
+	t.syscallRecorder = nil
 
 	return err
 }
@@ -447,6 +900,54 @@ func (t *Tracer) stopNetworkTracing() error {
 	return nil
 }
 
+func (t *Tracer) stopBindTracing() error {
+	t.tracingStateMutex.Lock()
+	defer t.tracingStateMutex.Unlock()
+	if t.tracingState[BindEventType].gadget != nil {
+		t.tracingState[BindEventType].gadget.Stop()
+	}
+	return nil
+}
+
+func (t *Tracer) stopTcpConnectTracing() error {
+	t.tracingStateMutex.Lock()
+	defer t.tracingStateMutex.Unlock()
+	if t.tracingState[TcpConnectEventType].gadget != nil {
+		t.tracingState[TcpConnectEventType].gadget.Stop()
+	}
+	return nil
+}
+
+func (t *Tracer) stopPrivilegedOperationsTracing() error {
+	t.tracingStateMutex.Lock()
+	defer t.tracingStateMutex.Unlock()
+	if t.tracingState[PrivilegedOperationEventType].gadget != nil {
+		t.tracingState[PrivilegedOperationEventType].gadget.Stop()
+	}
+	if t.tracingState[PrivilegedOperationEventType].attachable != nil {
+		t.tracingState[PrivilegedOperationEventType].attachable.Close()
+	}
+	return nil
+}
+
+func (t *Tracer) stopSignalTracing() error {
+	t.tracingStateMutex.Lock()
+	defer t.tracingStateMutex.Unlock()
+	if t.tracingState[SignalEventType].gadget != nil {
+		t.tracingState[SignalEventType].gadget.Stop()
+	}
+	return nil
+}
+
+func (t *Tracer) stopFileOperationsTracing() error {
+	t.tracingStateMutex.Lock()
+	defer t.tracingStateMutex.Unlock()
+	if t.tracingState[FileOperationEventType].attachable != nil {
+		t.tracingState[FileOperationEventType].attachable.Close()
+	}
+	return nil
+}
+
 func (t *Tracer) stopOpenTracing() error {
 	t.tracingStateMutex.Lock()
 	defer t.tracingStateMutex.Unlock()
@@ -0,0 +1,129 @@
+package tracing
+
+import (
+	"fmt"
+	"strings"
+
+	tracertraceloopType "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/traceloop/types"
+	"golang.org/x/exp/slices"
+)
+
+// Operations of the privileged operation events
+const (
+	PrivilegedOperationMount      = "mount"
+	PrivilegedOperationUmount     = "umount"
+	PrivilegedOperationSetns      = "setns"
+	PrivilegedOperationUnshare    = "unshare"
+	PrivilegedOperationPivotRoot  = "pivot_root"
+	PrivilegedOperationPtrace     = "ptrace"
+	PrivilegedOperationSetuid     = "setuid"
+	PrivilegedOperationSetgid     = "setgid"
+	PrivilegedOperationLoadModule = "load_module"
+)
+
+// Namespace flags of unshare and setns, in the order they are listed in the events
+var namespaceFlags = []struct {
+	flag uint64
+	name string
+}{
+	{0x00020000, "mnt"},
+	{0x02000000, "cgroup"},
+	{0x04000000, "uts"},
+	{0x08000000, "ipc"},
+	{0x10000000, "user"},
+	{0x20000000, "pid"},
+	{0x40000000, "net"},
+	{0x00000080, "time"},
+}
+
+// Flags of unshare creating a namespace, the other ones only unshare attributes of the process
+const unshareNamespaceFlags = 0x7e020080
+
+// Requests of ptrace that start tracing a process: PTRACE_TRACEME, PTRACE_ATTACH and PTRACE_SEIZE
+var ptraceTraceRequests = []uint64{0, 16, 0x4206}
+
+// Id given to the setuid and setgid syscalls to leave an id unchanged
+const unchangedId = 0xffffffff
+
+// privilegedOperationSyscall is a syscall making a privileged operation. The ids it switches to are the first
+// parameters of the syscall.
+type privilegedOperationSyscall struct {
+	operation string
+	ids       int
+}
+
+// Syscalls of the privileged operations, apart from the mounts that are traced with their own gadget. They are picked
+// from the syscalls recorded by traceloop whether a capability is needed or not: switching to the ids a process
+// already has, unsharing a user namespace or tracing a process of the same user are recorded too.
+var privilegedOperationSyscalls = map[string]privilegedOperationSyscall{
+	"unshare":      {PrivilegedOperationUnshare, 0},
+	"setns":        {PrivilegedOperationSetns, 0},
+	"pivot_root":   {PrivilegedOperationPivotRoot, 0},
+	"ptrace":       {PrivilegedOperationPtrace, 0},
+	"setuid":       {PrivilegedOperationSetuid, 1},
+	"setreuid":     {PrivilegedOperationSetuid, 2},
+	"setresuid":    {PrivilegedOperationSetuid, 3},
+	"setfsuid":     {PrivilegedOperationSetuid, 1},
+	"setgid":       {PrivilegedOperationSetgid, 1},
+	"setregid":     {PrivilegedOperationSetgid, 2},
+	"setresgid":    {PrivilegedOperationSetgid, 3},
+	"setfsgid":     {PrivilegedOperationSetgid, 1},
+	"setgroups":    {PrivilegedOperationSetgid, 0},
+	"init_module":  {PrivilegedOperationLoadModule, 0},
+	"finit_module": {PrivilegedOperationLoadModule, 0},
+}
+
+// privilegedOperation returns the operation of a successful privileged operation syscall recorded by traceloop, with
+// the namespaces it enters or creates and the ids it switches to. The namespaces of a setns are only known when its
+// type is given, the type of the namespace a file descriptor refers to is not read. The operation is empty for the
+// other syscalls, the failed ones, the ones whose parameters were not recorded, the unshares that do not create a
+// namespace and the ptrace requests that do not start tracing a process.
+func privilegedOperation(event *tracertraceloopType.Event) (operation string, namespaces string, targetIds string) {
+	syscall, ok := privilegedOperationSyscalls[event.Syscall]
+	if !ok || !syscallSucceeded(event) || len(event.Parameters) == 0 {
+		return "", "", ""
+	}
+
+	switch event.Syscall {
+	case "ptrace":
+		request, _ := syscallParam(event, 0)
+		if !slices.Contains(ptraceTraceRequests, request) {
+			return "", "", ""
+		}
+		return syscall.operation, "", ""
+	case "unshare":
+		flags, _ := syscallParam(event, 0)
+		if flags&unshareNamespaceFlags == 0 {
+			return "", "", ""
+		}
+		return syscall.operation, namespaceNames(flags), ""
+	case "setns":
+		nstype, _ := syscallParam(event, 1)
+		return syscall.operation, namespaceNames(nstype), ""
+	}
+
+	ids := []string{}
+	for i := 0; i < syscall.ids; i++ {
+		id, ok := syscallParam(event, i)
+		if !ok {
+			return syscall.operation, "", ""
+		}
+		if uint32(id) == unchangedId {
+			ids = append(ids, "-1")
+		} else {
+			ids = append(ids, fmt.Sprint(uint32(id)))
+		}
+	}
+	return syscall.operation, "", strings.Join(ids, ",")
+}
+
+// namespaceNames returns the names of the namespaces of namespace flags, separated by commas
+func namespaceNames(flags uint64) string {
+	names := []string{}
+	for _, namespace := range namespaceFlags {
+		if flags&namespace.flag != 0 {
+			names = append(names, namespace.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,38 @@
+package tracing
+
+import (
+	"testing"
+
+	tracertraceloopType "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/traceloop/types"
+)
+
+func TestPrivilegedOperation(t *testing.T) {
+	tests := []struct {
+		name       string
+		event      *tracertraceloopType.Event
+		operation  string
+		namespaces string
+		targetIds  string
+	}{
+		{"unshare", traceloopEvent("unshare", "0", "", "268566528"), PrivilegedOperationUnshare, "mnt,user", ""},
+		{"unshare without namespace", traceloopEvent("unshare", "0", "", "512"), "", "", ""},
+		{"setns with a type", traceloopEvent("setns", "0", "", "3", "1073741824"), PrivilegedOperationSetns, "net", ""},
+		{"setns without type", traceloopEvent("setns", "0", "", "3", "0"), PrivilegedOperationSetns, "", ""},
+		{"pivot_root", traceloopEvent("pivot_root", "0", "/new", "0x7ffd", "0x7ffe"), PrivilegedOperationPivotRoot, "", ""},
+		{"setuid", traceloopEvent("setuid", "0", "", "65534"), PrivilegedOperationSetuid, "", "65534"},
+		{"setresgid", traceloopEvent("setresgid", "0", "", "4294967295", "1000", "18446744073709551615"), PrivilegedOperationSetgid, "", "-1,1000,-1"},
+		{"setgroups", traceloopEvent("setgroups", "0", "", "2", "0x7ffd"), PrivilegedOperationSetgid, "", ""},
+		{"ptrace attach", traceloopEvent("ptrace", "0", "", "16", "42", "0", "0"), PrivilegedOperationPtrace, "", ""},
+		{"ptrace peek", traceloopEvent("ptrace", "0", "", "1", "42", "0x7ffd", "0"), "", "", ""},
+		{"finit_module", traceloopEvent("finit_module", "0", "", "3", "0x7ffd", "0"), PrivilegedOperationLoadModule, "", ""},
+		{"failed", traceloopEvent("setuid", "-1 (operation not permitted)", "", "0"), "", "", ""},
+		{"parameters not recorded", traceloopEvent("setuid", "0", ""), "", "", ""},
+		{"other syscall", traceloopEvent("read", "0", "", "3", "0x7ffd", "4096"), "", "", ""},
+	}
+	for _, test := range tests {
+		operation, namespaces, targetIds := privilegedOperation(test.event)
+		if operation != test.operation || namespaces != test.namespaces || targetIds != test.targetIds {
+			t.Errorf("%s: expected %s %q %q, got %s %q %q", test.name, test.operation, test.namespaces, test.targetIds, operation, namespaces, targetIds)
+		}
+	}
+}
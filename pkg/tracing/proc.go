@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Most processes kept in the executable cache, it starts over when it gets this large
+const maxExeCacheSize = 4096
+
+// procPath returns the path of a file of a process in the proc filesystem of the host
+func procPath(pid uint32, name string) string {
+	return filepath.Join(os.Getenv("HOST_ROOT"), "/proc", fmt.Sprint(pid), name)
+}
+
+// readProcessEnv reads the environment a process was started with
+func readProcessEnv(pid uint32) ([]string, error) {
+	environ, err := os.ReadFile(procPath(pid, "environ"))
+	if err != nil {
+		return nil, err
+	}
+	env := []string{}
+	for _, variable := range bytes.Split(environ, []byte{0}) {
+		if len(variable) > 0 {
+			env = append(env, string(variable))
+		}
+	}
+	return env, nil
+}
+
+// readProcessExe returns the path of the executable a process runs
+func readProcessExe(pid uint32) (string, error) {
+	return os.Readlink(procPath(pid, "exe"))
+}
+
+// readNamespacedProcessExe returns the path of the executable a process runs, the process being identified by its
+// pid in the pid namespace of another process
+func readNamespacedProcessExe(pid uint32, nsPid uint32) (string, error) {
+	return os.Readlink(procPath(pid, filepath.Join("root", "proc", fmt.Sprint(nsPid), "exe")))
+}
+
+type cachedExe struct {
+	comm string
+	exe  string
+}
+
+// exeCache keeps the executables of the processes so that they are not read for every event. The command name of a
+// process changes when it executes another program, which invalidates the entry.
+type exeCache struct {
+	mutex       sync.Mutex
+	executables map[uint32]cachedExe
+}
+
+func newExeCache() *exeCache {
+	return &exeCache{executables: map[uint32]cachedExe{}}
+}
+
+// get returns the executable of a process, empty if it was not found
+func (cache *exeCache) get(pid uint32, comm string) string {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cached, ok := cache.executables[pid]; ok && cached.comm == comm {
+		return cached.exe
+	}
+	exe, err := readProcessExe(pid)
+	if err != nil {
+		// The process is gone, do not remember it as its pid may be reused
+		return ""
+	}
+	if len(cache.executables) >= maxExeCacheSize {
+		cache.executables = map[uint32]cachedExe{}
+	}
+	cache.executables[pid] = cachedExe{comm: comm, exe: exe}
+	return exe
+}
@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestReadProcessEnv(t *testing.T) {
+	env, err := readProcessEnv(uint32(os.Getpid()))
+	if err != nil {
+		t.Skipf("cannot read the environment of the process: %s", err)
+	}
+	if path, ok := os.LookupEnv("PATH"); ok && !slices.Contains(env, "PATH="+path) {
+		t.Errorf("expected PATH=%s in %v", path, env)
+	}
+}
+
+func TestReadProcessExe(t *testing.T) {
+	exe, err := readProcessExe(uint32(os.Getpid()))
+	if err != nil {
+		t.Skipf("cannot read the executable of the process: %s", err)
+	}
+	if expected, err := os.Executable(); err == nil && exe != expected {
+		t.Errorf("expected %s, got %s", expected, exe)
+	}
+}
+
+func TestReadNamespacedProcessExe(t *testing.T) {
+	// The root of the test process has the same proc filesystem, where it has the same pid
+	pid := uint32(os.Getpid())
+	exe, err := readNamespacedProcessExe(pid, pid)
+	if err != nil {
+		t.Skipf("cannot read the executable of the process: %s", err)
+	}
+	if expected, err := os.Executable(); err == nil && exe != expected {
+		t.Errorf("expected %s, got %s", expected, exe)
+	}
+}
+
+func TestExeCache(t *testing.T) {
+	cache := newExeCache()
+	pid := uint32(os.Getpid())
+	exe := cache.get(pid, "test")
+	if exe == "" {
+		t.Skip("cannot read the executable of the process")
+	}
+	// Cached entries are used as long as the command name does not change
+	cache.executables[pid] = cachedExe{comm: "test", exe: "/cached"}
+	if cached := cache.get(pid, "test"); cached != "/cached" {
+		t.Errorf("expected the cached executable, got %s", cached)
+	}
+	if fresh := cache.get(pid, "other"); fresh != exe {
+		t.Errorf("expected %s, got %s", exe, fresh)
+	}
+}
@@ -0,0 +1,210 @@
+package tracing
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	containercollection "github.com/inspektor-gadget/inspektor-gadget/pkg/container-collection"
+	tracertraceloop "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/traceloop/tracer"
+	tracertraceloopType "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/traceloop/types"
+)
+
+// Interval between two reads of the syscalls recorded for a container. The syscalls are recorded in an overwritable
+// buffer, the oldest ones are lost if a container makes more syscalls than the buffer holds in this interval.
+const syscallRecorderReadInterval = time.Second
+
+type recordedContainer struct {
+	containerID string
+	mntns       uint64
+	// Event types the syscalls of the container are reported to
+	eventTypes map[EventType]bool
+}
+
+// syscallRecorder records the syscalls of the traced containers with the traceloop gadget, and reports them to the
+// event types that trace the container. It is shared by the event types found from the syscalls, so that the
+// syscalls of a container are only recorded once.
+type syscallRecorder struct {
+	tracer      *tracertraceloop.Tracer
+	cCollection *containercollection.ContainerCollection
+
+	mutex      sync.Mutex
+	callbacks  map[EventType]func(event *tracertraceloopType.Event)
+	containers map[uint32]*recordedContainer
+	done       chan struct{}
+}
+
+// syscallRecorderTracer traces the containers of an event type with a syscall recorder
+type syscallRecorderTracer struct {
+	recorder  *syscallRecorder
+	eventType EventType
+}
+
+func newSyscallRecorder(cCollection *containercollection.ContainerCollection) (*syscallRecorder, error) {
+	tracer, err := tracertraceloop.NewTracer(cCollection)
+	if err != nil {
+		return nil, err
+	}
+	recorder := &syscallRecorder{
+		tracer:      tracer,
+		cCollection: cCollection,
+		callbacks:   map[EventType]func(event *tracertraceloopType.Event){},
+		containers:  map[uint32]*recordedContainer{},
+		done:        make(chan struct{}),
+	}
+	go recorder.run()
+	return recorder, nil
+}
+
+// tracerFor returns the tracer of an event type, the syscalls of the containers it traces are reported to the
+// callback. The recorder is stopped once the tracers of all the event types are closed.
+func (r *syscallRecorder) tracerFor(eventType EventType, callback func(event *tracertraceloopType.Event)) *syscallRecorderTracer {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.callbacks[eventType] = callback
+	return &syscallRecorderTracer{recorder: r, eventType: eventType}
+}
+
+func (s *syscallRecorderTracer) Attach(pid uint32) error {
+	return s.recorder.attach(pid, s.eventType)
+}
+
+func (s *syscallRecorderTracer) Detach(pid uint32) error {
+	return s.recorder.detach(pid, s.eventType)
+}
+
+func (s *syscallRecorderTracer) Close() {
+	s.recorder.close(s.eventType)
+}
+
+func (r *syscallRecorder) attach(pid uint32, eventType EventType) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if container, ok := r.containers[pid]; ok {
+		container.eventTypes[eventType] = true
+		return nil
+	}
+
+	var found *containercollection.Container
+	r.cCollection.ContainerRange(func(c *containercollection.Container) {
+		if c.Pid == pid {
+			found = c
+		}
+	})
+	if found == nil {
+		return fmt.Errorf("no container with pid %d", pid)
+	}
+	if err := r.tracer.Attach(found.Runtime.ContainerID, found.Mntns); err != nil {
+		return err
+	}
+	r.containers[pid] = &recordedContainer{
+		containerID: found.Runtime.ContainerID,
+		mntns:       found.Mntns,
+		eventTypes:  map[EventType]bool{eventType: true},
+	}
+	return nil
+}
+
+func (r *syscallRecorder) detach(pid uint32, eventType EventType) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	container, ok := r.containers[pid]
+	if !ok || !container.eventTypes[eventType] {
+		return fmt.Errorf("no traced container with pid %d", pid)
+	}
+	// Report the syscalls since the last read before the event type stops getting them
+	r.read(container)
+	delete(container.eventTypes, eventType)
+	if len(container.eventTypes) > 0 {
+		return nil
+	}
+	delete(r.containers, pid)
+	if err := r.tracer.Detach(container.mntns); err != nil {
+		return err
+	}
+	return r.tracer.Delete(container.containerID)
+}
+
+func (r *syscallRecorder) close(eventType EventType) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.callbacks[eventType]; !ok {
+		return
+	}
+	delete(r.callbacks, eventType)
+	for _, container := range r.containers {
+		delete(container.eventTypes, eventType)
+	}
+	if len(r.callbacks) > 0 {
+		return
+	}
+	close(r.done)
+	r.tracer.Stop()
+	r.containers = map[uint32]*recordedContainer{}
+}
+
+func (r *syscallRecorder) run() {
+	ticker := time.NewTicker(syscallRecorderReadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.mutex.Lock()
+			for _, container := range r.containers {
+				r.read(container)
+			}
+			r.mutex.Unlock()
+		}
+	}
+}
+
+func (r *syscallRecorder) read(container *recordedContainer) {
+	events, err := r.tracer.Read(container.containerID)
+	if err != nil {
+		log.Printf("error reading the syscalls of container %s: %s\n", container.containerID, err)
+		return
+	}
+	r.report(container, events)
+}
+
+// report sends the syscalls of a container to the event types that trace it
+func (r *syscallRecorder) report(container *recordedContainer, events []*tracertraceloopType.Event) {
+	for eventType := range container.eventTypes {
+		if callback, ok := r.callbacks[eventType]; ok {
+			for _, event := range events {
+				callback(event)
+			}
+		}
+	}
+}
+
+// syscallSucceeded checks the return value of a syscall recorded by traceloop. Failures are formatted as
+// "-1 (<error>)", the syscalls whose exit was not recorded as "unfinished" and the ones without exit as "X".
+func syscallSucceeded(event *tracertraceloopType.Event) bool {
+	retval, err := strconv.ParseInt(event.Retval, 10, 64)
+	return err == nil && retval >= 0
+}
+
+// syscallParam returns the value of a parameter of a syscall recorded by traceloop. It is not found if the entry of
+// the syscall was not recorded, only its exit.
+func syscallParam(event *tracertraceloopType.Event, index int) (uint64, bool) {
+	if index >= len(event.Parameters) {
+		return 0, false
+	}
+	// Pointers are formatted in hexadecimal and the other parameters in decimal
+	value, err := strconv.ParseUint(event.Parameters[index].Value, 0, 64)
+	return value, err == nil
+}
+
+// syscallParamContent returns the string a parameter of a syscall recorded by traceloop points to. Traceloop only
+// reads the strings of a few syscalls, such as the paths of mkdir, open, openat and pivot_root.
+func syscallParamContent(event *tracertraceloopType.Event, index int) string {
+	if index >= len(event.Parameters) || event.Parameters[index].Content == nil {
+		return ""
+	}
+	return *event.Parameters[index].Content
+}
@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	tracertcp "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/tcp/tracer"
+	tracertcpconnect "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/tcpconnect/tracer"
+	eventtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
+)
+
+// Time a connect has to get established in, it failed otherwise
+const tcpConnectTimeout = 30 * time.Second
+
+// Most connects waiting to be established, the oldest ones are reported as failed when there are more
+const maxPendingTcpConnects = 16384
+
+type pendingTcpConnect struct {
+	event *TcpConnectEvent
+	since time.Time
+}
+
+// tcpConnects pairs the connects started by the processes with the connections that got established. The tcpconnect
+// gadget reports the connects, and the tcp gadget the connections once established, so the connects that are not
+// established within tcpConnectTimeout are reported as failed.
+type tcpConnects struct {
+	mutex sync.Mutex
+	// Connects waiting to be established, and the connections established before their connect was reported, by tuple
+	pending     map[string]pendingTcpConnect
+	established map[string]time.Time
+	report      func(event *TcpConnectEvent)
+}
+
+func newTcpConnects(report func(event *TcpConnectEvent)) *tcpConnects {
+	return &tcpConnects{
+		pending:     map[string]pendingTcpConnect{},
+		established: map[string]time.Time{},
+		report:      report,
+	}
+}
+
+func tcpConnectTuple(src eventtypes.L4Endpoint, dst eventtypes.L4Endpoint) string {
+	return fmt.Sprintf("%s-%s", src.String(), dst.String())
+}
+
+// connected records a connect of a process, it is reported once its connection is established or timed out
+func (c *tcpConnects) connected(tuple string, event *TcpConnectEvent, now time.Time) {
+	c.mutex.Lock()
+	if _, ok := c.established[tuple]; ok {
+		delete(c.established, tuple)
+		c.mutex.Unlock()
+		event.Success = true
+		c.report(event)
+		return
+	}
+	var oldest *TcpConnectEvent
+	if len(c.pending) >= maxPendingTcpConnects {
+		oldestTuple := ""
+		for pendingTuple, pending := range c.pending {
+			if oldest == nil || pending.since.Before(c.pending[oldestTuple].since) {
+				oldestTuple, oldest = pendingTuple, pending.event
+			}
+		}
+		delete(c.pending, oldestTuple)
+	}
+	c.pending[tuple] = pendingTcpConnect{event: event, since: now}
+	c.mutex.Unlock()
+	if oldest != nil {
+		c.report(oldest)
+	}
+}
+
+// establish records a connection that got established and reports its connect
+func (c *tcpConnects) establish(tuple string, now time.Time) {
+	c.mutex.Lock()
+	pending, ok := c.pending[tuple]
+	if !ok {
+		if len(c.established) < maxPendingTcpConnects {
+			c.established[tuple] = now
+		}
+		c.mutex.Unlock()
+		return
+	}
+	delete(c.pending, tuple)
+	c.mutex.Unlock()
+	pending.event.Success = true
+	c.report(pending.event)
+}
+
+// expire reports the connects that did not get established in time as failed
+func (c *tcpConnects) expire(now time.Time) {
+	failed := []*TcpConnectEvent{}
+	c.mutex.Lock()
+	for tuple, pending := range c.pending {
+		if now.Sub(pending.since) >= tcpConnectTimeout {
+			delete(c.pending, tuple)
+			failed = append(failed, pending.event)
+		}
+	}
+	for tuple, since := range c.established {
+		if now.Sub(since) >= tcpConnectTimeout {
+			delete(c.established, tuple)
+		}
+	}
+	c.mutex.Unlock()
+	for _, event := range failed {
+		c.report(event)
+	}
+}
+
+// tcpConnectTracer runs the tcpconnect and tcp gadgets with the same mount namespace filter
+type tcpConnectTracer struct {
+	connectTracer *tracertcpconnect.Tracer
+	tcpTracer     *tracertcp.Tracer
+	connects      *tcpConnects
+	done          chan struct{}
+}
+
+func (t *tcpConnectTracer) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case now := <-ticker.C:
+			t.connects.expire(now)
+		}
+	}
+}
+
+func (t *tcpConnectTracer) Stop() {
+	close(t.done)
+	t.connectTracer.Stop()
+	t.tcpTracer.Stop()
+}
@@ -0,0 +1,35 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTcpConnects(t *testing.T) {
+	reported := map[string]bool{}
+	connects := newTcpConnects(func(event *TcpConnectEvent) { reported[event.DstAddress] = event.Success })
+	now := time.Now()
+
+	// Established after the connect was reported, and before
+	connects.connected("a", &TcpConnectEvent{DstAddress: "10.0.0.1"}, now)
+	connects.establish("a", now)
+	connects.establish("b", now)
+	connects.connected("b", &TcpConnectEvent{DstAddress: "10.0.0.2"}, now)
+	// Never established
+	connects.connected("c", &TcpConnectEvent{DstAddress: "10.0.0.3"}, now)
+
+	if len(reported) != 2 || !reported["10.0.0.1"] || !reported["10.0.0.2"] {
+		t.Fatalf("expected the established connects to succeed, got %v", reported)
+	}
+	connects.expire(now.Add(tcpConnectTimeout - time.Second))
+	if len(reported) != 2 {
+		t.Fatalf("expected the pending connect to wait, got %v", reported)
+	}
+	connects.expire(now.Add(tcpConnectTimeout))
+	if success, ok := reported["10.0.0.3"]; !ok || success {
+		t.Errorf("expected the pending connect to fail, got %v", reported)
+	}
+	if len(connects.pending) != 0 || len(connects.established) != 0 {
+		t.Errorf("expected no pending connects, got %v and %v", connects.pending, connects.established)
+	}
+}
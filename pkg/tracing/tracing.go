@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"sync"
+	"sync/atomic"
 
 	containercollection "github.com/inspektor-gadget/inspektor-gadget/pkg/container-collection"
 	igtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
@@ -45,6 +46,19 @@ type Tracer struct {
 
 	// Container activity listener
 	containerActivityListener []ContainerActivityEventListener
+
+	// Environment variables captured for the execs, and the number of execs whose environment could not be read
+	execEnvConfig *ExecEnvConfig
+	execEnvMisses atomic.Uint64
+
+	// Executables of the processes that open files, bind sockets and connect
+	exeCache *exeCache
+
+	// Connects waiting for their connection to be established
+	tcpConnects *tcpConnects
+
+	// Syscalls of the containers, shared by the event types found from them
+	syscallRecorder *syscallRecorder
 }
 
 func NewTracer(nodeName string, k8sConfig *rest.Config, eventSinks []EventSink, filterByLabel bool) *Tracer {
@@ -57,6 +71,7 @@ func NewTracer(nodeName string, k8sConfig *rest.Config, eventSinks []EventSink,
 		k8sConfig:                 k8sConfig,
 		eventSinks:                eventSinks,
 		tracingState:              tracingState,
+		exeCache:                  newExeCache(),
 		containerActivityListener: []ContainerActivityEventListener{}}
 }
 
@@ -124,6 +139,14 @@ func (t *Tracer) RemoveEventSink(sink EventSink) {
 	}
 }
 
+// SetExecEnvConfig sets the environment variables captured for the execs, none are captured by default. It must be
+// called before the tracer is started.
+func (t *Tracer) SetExecEnvConfig(config *ExecEnvConfig) {
+	if t != nil {
+		t.execEnvConfig = config
+	}
+}
+
 func (t *Tracer) AddContainerActivityListener(listener ContainerActivityEventListener) {
 	if t != nil && t.containerActivityListener != nil {
 		t.containerActivityListener = append(t.containerActivityListener, listener)
@@ -228,11 +251,13 @@ func (t *Tracer) containerEventHandler(notif containercollection.PubSubEvent) {
 	if t.containerActivityListener != nil && len(t.containerActivityListener) > 0 {
 		activityEvent := &ContainerActivityEvent{
 			PodName:       notif.Container.K8s.PodName,
+			PodUID:        notif.Container.K8s.PodUID,
 			Namespace:     notif.Container.K8s.Namespace,
 			ContainerName: notif.Container.K8s.ContainerName,
 			NsMntId:       notif.Container.Mntns,
 			ContainerID:   notif.Container.Runtime.ContainerID,
 			Pid:           notif.Container.Pid,
+			ImageDigest:   notif.Container.Runtime.ContainerImageDigest,
 		}
 		if notif.Type == containercollection.EventTypeAddContainer {
 			activityEvent.Activity = ContainerActivityEventStart
@@ -253,11 +278,15 @@ func (t *Tracer) StartTraceContainer(mntns uint64, pid uint32, eventType EventTy
 	}
 	var eventTypesToStart []EventType
 	if eventType == AllEventType {
-		eventTypesToStart = []EventType{NetworkEventType, DnsEventType, ExecveEventType, CapabilitiesEventType, OpenEventType}
+		eventTypesToStart = ContainerEventTypes
 	} else {
 		eventTypesToStart = append(eventTypesToStart, eventType)
 	}
 	for _, startEventType := range eventTypesToStart {
+		// An event type may be traced by both kinds of gadgets
+		if t.tracingState[startEventType].gadget == nil && t.tracingState[startEventType].attachable == nil {
+			return fmt.Errorf("not a tracable event type")
+		}
 		if t.tracingState[startEventType].gadget != nil {
 			// Tracing gadget with nsmap control
 			t.tracingStateMutex.Lock()
@@ -266,13 +295,12 @@ func (t *Tracer) StartTraceContainer(mntns uint64, pid uint32, eventType EventTy
 			t.tracingState[startEventType].eBpfContainerFilterMap.Put(&mntnsC, &one)
 			t.tracingState[startEventType].usageReferenceCount[mntns]++
 			t.tracingStateMutex.Unlock()
-		} else if t.tracingState[startEventType].attachable != nil {
+		}
+		if t.tracingState[startEventType].attachable != nil {
 			// Tracing gadget with peekable interface
 			t.tracingStateMutex.Lock()
 			t.tracingState[startEventType].attachable.Attach(pid)
 			t.tracingStateMutex.Unlock()
-		} else {
-			return fmt.Errorf("not a tracable event type")
 		}
 	}
 	return nil
@@ -286,27 +314,27 @@ func (t *Tracer) StopTraceContainer(mntns uint64, pid uint32, eventType EventTyp
 	defer t.tracingStateMutex.Unlock()
 	var eventTypesToStop []EventType
 	if eventType == AllEventType {
-		eventTypesToStop = []EventType{NetworkEventType, DnsEventType, ExecveEventType, CapabilitiesEventType, OpenEventType}
+		eventTypesToStop = ContainerEventTypes
 	} else {
 		eventTypesToStop = append(eventTypesToStop, eventType)
 	}
 	for _, stopEventType := range eventTypesToStop {
-		if t.tracingState[stopEventType].gadget != nil {
+		// An event type may be traced by both kinds of gadgets
+		if t.tracingState[stopEventType].gadget == nil && t.tracingState[stopEventType].attachable == nil {
+			return fmt.Errorf("not a tracable event type")
+		}
+		if t.tracingState[stopEventType].gadget != nil && t.tracingState[stopEventType].usageReferenceCount[mntns] > 0 {
 			// Tracing gadget with nsmap control
-			if t.tracingState[stopEventType].usageReferenceCount[mntns] == 0 {
-				continue
-			}
 			t.tracingState[stopEventType].usageReferenceCount[mntns]--
 			if t.tracingState[stopEventType].usageReferenceCount[mntns] == 0 {
 				zero := uint32(0)
 				mntnsC := uint64(mntns)
 				t.tracingState[stopEventType].eBpfContainerFilterMap.Put(&mntnsC, &zero)
 			}
-		} else if t.tracingState[stopEventType].attachable != nil {
+		}
+		if t.tracingState[stopEventType].attachable != nil {
 			// Tracing gadget with peekable interface
 			t.tracingState[stopEventType].attachable.Detach(pid)
-		} else {
-			return fmt.Errorf("not a tracable event type")
 		}
 	}
 	return nil
@@ -322,11 +350,13 @@ func (t *Tracer) GetListOfRunningContainers() (*[]ContainerActivityEvent, error)
 	for _, container := range containers {
 		containerActivityEvents = append(containerActivityEvents, ContainerActivityEvent{
 			PodName:       container.K8s.PodName,
+			PodUID:        container.K8s.PodUID,
 			Namespace:     container.K8s.Namespace,
 			ContainerName: container.K8s.ContainerName,
 			NsMntId:       container.Mntns,
 			ContainerID:   container.Runtime.ContainerID,
 			Pid:           container.Pid,
+			ImageDigest:   container.Runtime.ContainerImageDigest,
 			Activity:      ContainerActivityEventStart,
 		})
 	}
@@ -0,0 +1,158 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/kubescape/kapprofiler/pkg/collector"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// ConversionPath is the path the API server calls to convert ApplicationProfiles
+	ConversionPath = "/convert"
+	// ConversionReviewApiVersion is the api version of the ConversionReview objects
+	ConversionReviewApiVersion = "apiextensions.k8s.io/v1"
+	// ConversionReviewKind is the kind of the ConversionReview objects
+	ConversionReviewKind = "ConversionReview"
+)
+
+// ConversionReview mirrors apiextensions.k8s.io/v1 ConversionReview
+type ConversionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *ConversionRequest  `json:"request,omitempty"`
+	Response        *ConversionResponse `json:"response,omitempty"`
+}
+
+type ConversionRequest struct {
+	UID               apitypes.UID           `json:"uid"`
+	DesiredAPIVersion string                 `json:"desiredAPIVersion"`
+	Objects           []runtime.RawExtension `json:"objects"`
+}
+
+type ConversionResponse struct {
+	UID              apitypes.UID           `json:"uid"`
+	ConvertedObjects []runtime.RawExtension `json:"convertedObjects"`
+	Result           metav1.Status          `json:"result"`
+}
+
+type ConversionWebhook struct {
+	server   *http.Server
+	certFile string
+	keyFile  string
+}
+
+// Create a new conversion webhook serving TLS on the given address with the tls.crt and tls.key from certDir
+func NewConversionWebhook(address string, certDir string) *ConversionWebhook {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ConversionPath, HandleConversion)
+	return &ConversionWebhook{
+		server: &http.Server{
+			Addr:              address,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		certFile: filepath.Join(certDir, "tls.crt"),
+		keyFile:  filepath.Join(certDir, "tls.key"),
+	}
+}
+
+func (w *ConversionWebhook) Start() error {
+	// Fail early if the certificates cannot be loaded
+	if _, err := tls.LoadX509KeyPair(w.certFile, w.keyFile); err != nil {
+		return err
+	}
+	go func() {
+		if err := w.server.ListenAndServeTLS(w.certFile, w.keyFile); err != nil && err != http.ErrServerClosed {
+			log.Printf("conversion webhook error: %s\n", err)
+		}
+	}()
+	return nil
+}
+
+func (w *ConversionWebhook) Stop() error {
+	return w.server.Shutdown(context.Background())
+}
+
+// HandleConversion handles ConversionReview requests of the API server
+func HandleConversion(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading request body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	review := ConversionReview{}
+	if err := json.Unmarshal(body, &review); err != nil {
+		http.Error(w, fmt.Sprintf("error unmarshalling conversion review: %s", err), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(w, "conversion review has no request", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = ConvertObjects(review.Request)
+	review.Request = nil
+	review.APIVersion = ConversionReviewApiVersion
+	review.Kind = ConversionReviewKind
+
+	responseRaw, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error marshalling conversion review: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseRaw)
+}
+
+// ConvertObjects converts all the objects of a conversion request to the desired api version
+func ConvertObjects(request *ConversionRequest) *ConversionResponse {
+	response := &ConversionResponse{
+		UID:              request.UID,
+		ConvertedObjects: []runtime.RawExtension{},
+	}
+	for _, object := range request.Objects {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(object.Raw); err != nil {
+			return conversionFailure(request.UID, err)
+		}
+		if obj.GetKind() != collector.ApplicationProfileKind {
+			return conversionFailure(request.UID, fmt.Errorf("unexpected kind %s", obj.GetKind()))
+		}
+		converted, err := collector.ConvertApplicationProfile(obj, request.DesiredAPIVersion)
+		if err != nil {
+			return conversionFailure(request.UID, err)
+		}
+		convertedRaw, err := converted.MarshalJSON()
+		if err != nil {
+			return conversionFailure(request.UID, err)
+		}
+		response.ConvertedObjects = append(response.ConvertedObjects, runtime.RawExtension{Raw: convertedRaw})
+	}
+	response.Result = metav1.Status{Status: metav1.StatusSuccess}
+	return response
+}
+
+func conversionFailure(uid apitypes.UID, err error) *ConversionResponse {
+	log.Printf("error converting application profile: %s\n", err)
+	return &ConversionResponse{
+		UID:              uid,
+		ConvertedObjects: []runtime.RawExtension{},
+		Result: metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+		},
+	}
+}
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kubescape/kapprofiler/pkg/collector"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestHandleConversion(t *testing.T) {
+	profile := &collector.ApplicationProfile{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       collector.ApplicationProfileKind,
+			APIVersion: collector.ApplicationProfileApiVersion,
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-nginx", Namespace: "default"},
+		Spec: collector.ApplicationProfileSpec{
+			Containers: []collector.ContainerProfile{
+				{Name: "app", Opens: []collector.OpenCalls{{Path: "/etc/hosts", Flags: []string{"O_RDONLY"}}}},
+			},
+		},
+	}
+	profileRaw, err := json.Marshal(profile)
+	if err != nil {
+		t.Fatalf("error marshalling profile: %s\n", err)
+	}
+	reviewRaw, err := json.Marshal(ConversionReview{
+		TypeMeta: metav1.TypeMeta{Kind: ConversionReviewKind, APIVersion: ConversionReviewApiVersion},
+		Request: &ConversionRequest{
+			UID:               "1234",
+			DesiredAPIVersion: collector.ApplicationProfileApiVersionV2,
+			Objects:           []runtime.RawExtension{{Raw: profileRaw}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error marshalling review: %s\n", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	HandleConversion(recorder, httptest.NewRequest(http.MethodPost, ConversionPath, bytes.NewReader(reviewRaw)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d\n", recorder.Code)
+	}
+
+	review := ConversionReview{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &review); err != nil {
+		t.Fatalf("error unmarshalling response: %s\n", err)
+	}
+	if review.Response == nil || review.Response.UID != "1234" {
+		t.Fatalf("expected response with uid 1234, got %+v\n", review.Response)
+	}
+	if review.Response.Result.Status != metav1.StatusSuccess {
+		t.Fatalf("expected success, got %+v\n", review.Response.Result)
+	}
+	if len(review.Response.ConvertedObjects) != 1 {
+		t.Fatalf("expected 1 converted object, got %d\n", len(review.Response.ConvertedObjects))
+	}
+
+	converted := &unstructured.Unstructured{}
+	if err := converted.UnmarshalJSON(review.Response.ConvertedObjects[0].Raw); err != nil {
+		t.Fatalf("error unmarshalling converted object: %s\n", err)
+	}
+	if converted.GetAPIVersion() != collector.ApplicationProfileApiVersionV2 {
+		t.Errorf("expected api version %s, got %s\n", collector.ApplicationProfileApiVersionV2, converted.GetAPIVersion())
+	}
+	profileV2 := &collector.ApplicationProfileV2{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(converted.Object, profileV2); err != nil {
+		t.Fatalf("error converting from unstructured: %s\n", err)
+	}
+	if profileV2.Spec.Containers[0].Opens[0].Flags.Access != "O_RDONLY" {
+		t.Errorf("expected access O_RDONLY, got %s\n", profileV2.Spec.Containers[0].Opens[0].Flags.Access)
+	}
+}
+
+func TestHandleConversionFailure(t *testing.T) {
+	response := ConvertObjects(&ConversionRequest{
+		UID:               "1234",
+		DesiredAPIVersion: collector.ApplicationProfileApiVersionV2,
+		Objects:           []runtime.RawExtension{{Raw: []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"nginx"}}`)}},
+	})
+	if response.Result.Status != metav1.StatusFailure {
+		t.Errorf("expected failure, got %+v\n", response.Result)
+	}
+}